@@ -4,42 +4,58 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/johan/polymarket-collector/internal/collector"
 	"github.com/johan/polymarket-collector/internal/config"
+	"github.com/johan/polymarket-collector/internal/logging"
+	"github.com/johan/polymarket-collector/internal/metrics"
 )
 
 func main() {
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
+	logLevel := flag.String("log-level", "", "Override logging.level (debug, info, warn, error)")
 	flag.Parse()
 
 	// Load configuration
 	cfg, err := config.Load(*configPath)
+	defaults := false
 	if err != nil {
 		// If config file doesn't exist, use defaults
 		if os.IsNotExist(err) {
-			log.Printf("Config file not found, using defaults")
+			defaults = true
 			cfg = config.DefaultConfig()
 		} else {
 			log.Fatalf("Error loading config: %v", err)
 		}
 	}
+	if *logLevel != "" {
+		cfg.Logging.Level = *logLevel
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	logger, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+	if defaults {
+		logger.Info("Config file not found, using defaults", "path", *configPath)
+	}
+
 	// Create service
 	svc, err := collector.NewService(cfg)
 	if err != nil {
-		log.Fatalf("Error creating service: %v", err)
+		fatal(logger, "Error creating service", "err", err)
 	}
+	svc.WithLogger(logger)
 	defer svc.Close()
 
 	// Setup context with cancellation
@@ -51,16 +67,34 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigChan
-		fmt.Printf("\nReceived signal %v, shutting down...\n", sig)
+		logger.Info("Received signal, shutting down", "signal", sig.String())
 		cancel()
 	}()
 
+	// Serve Prometheus metrics if configured
+	if cfg.Metrics.Port > 0 {
+		m := metrics.New()
+		svc.WithMetrics(m)
+		go func() {
+			if err := m.Serve(ctx, cfg.Metrics.Addr()); err != nil {
+				logger.Warn("Metrics endpoint stopped", "err", err)
+			}
+		}()
+		logger.Info("Serving metrics", "url", "http://localhost"+cfg.Metrics.Addr()+"/metrics")
+	}
+
 	// Run the service
 	if err := svc.Run(ctx); err != nil {
 		if ctx.Err() != context.Canceled {
-			log.Fatalf("Service error: %v", err)
+			fatal(logger, "Service error", "err", err)
 		}
 	}
 
-	log.Println("Collector shutdown complete")
+	logger.Info("Collector shutdown complete")
+}
+
+// fatal logs an error and exits.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
 }
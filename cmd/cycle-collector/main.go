@@ -4,21 +4,31 @@ import (
 	"context"
 	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/johan/polymarket-collector/internal/admin"
+	"github.com/johan/polymarket-collector/internal/alert"
+	"github.com/johan/polymarket-collector/internal/clob"
 	"github.com/johan/polymarket-collector/internal/config"
 	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/logging"
 	"github.com/johan/polymarket-collector/internal/manager"
+	"github.com/johan/polymarket-collector/internal/metrics"
+	"github.com/johan/polymarket-collector/internal/pipeline"
+	"github.com/johan/polymarket-collector/internal/verifier"
 )
 
 func main() {
 	configPath := flag.String("config", "config.cycle.yaml", "Path to configuration file")
 	outputDir := flag.String("output", "", "Override output directory")
 	noGzip := flag.Bool("no-gzip", false, "Disable gzip compression (enabled by default)")
+	raw := flag.Bool("raw", false, "Archive raw WebSocket frames byte-for-byte")
+	logLevel := flag.String("log-level", "", "Override logging.level (debug, info, warn, error)")
 	flag.Parse()
 
 	useGzip := !*noGzip
@@ -34,20 +44,36 @@ func main() {
 		cfg.Storage.OutputDir = *outputDir
 	}
 
-	// Validate configuration
+	if *raw {
+		cfg.Storage.Raw = true
+	}
+	if *logLevel != "" {
+		cfg.Logging.Level = *logLevel
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	logger, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+
+	// Validate series
 	if len(cfg.Manager.Series) == 0 {
-		log.Fatal("No series configured in manager.series")
+		fatal(logger, "No series configured in manager.series")
 	}
 
 	enabledCount := 0
 	for _, s := range cfg.Manager.Series {
 		if s.Enabled {
 			enabledCount++
-			log.Printf("Tracking series: %s", s.Slug)
+			logger.Info("Tracking series", "series", s.Slug)
 		}
 	}
 	if enabledCount == 0 {
-		log.Fatal("No series enabled in configuration")
+		fatal(logger, "No series enabled in configuration")
 	}
 
 	// Create HTTP client with timeout
@@ -59,31 +85,100 @@ func main() {
 	gammaClient := gamma.NewClient(httpClient)
 
 	// Create market manager
-	mgr := manager.NewMarketManager(gammaClient, &cfg.Manager, cfg.Storage, useGzip)
+	mgr := manager.NewMarketManager(gammaClient, &cfg.Manager, cfg.Storage, useGzip).
+		WithLogger(logger).
+		WithPipeline(pipeline.Config{
+			QueueSize: cfg.Pipeline.QueueSize,
+			BatchSize: cfg.Pipeline.BatchSize,
+			Overflow:  pipeline.OverflowPolicy(cfg.Pipeline.Overflow),
+			SpillDir:  cfg.Pipeline.SpillDir,
+		}).
+		WithWebSocket(cfg.WebSocket)
+
+	// Enable REST order book verification if configured
+	if cfg.REST.VerifyInterval > 0 {
+		clobClient := clob.NewClient(&http.Client{Timeout: cfg.REST.Timeout})
+		if cfg.REST.URL != "" {
+			clobClient.WithBaseURL(cfg.REST.URL)
+		}
+		mgr.WithVerifier(verifier.NewRESTVerifier(clobClient, cfg.REST.VerifyInterval).
+			WithMismatchThreshold(cfg.REST.MismatchThreshold))
+	}
+
+	// Send alerts if notifiers are configured
+	alerts, err := alert.FromConfig(cfg.Alerts, logger)
+	if err != nil {
+		fatal(logger, "Invalid alerts configuration", "err", err)
+	}
+	mgr.WithAlerts(alerts)
 
 	// Setup signal handling
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Serve Prometheus metrics if configured
+	if cfg.Metrics.Port > 0 {
+		m := metrics.New()
+		mgr.WithMetrics(m)
+		go func() {
+			if err := m.Serve(ctx, cfg.Metrics.Addr()); err != nil {
+				logger.Warn("Metrics endpoint stopped", "err", err)
+			}
+		}()
+	}
+
+	// Serve the status and admin API if configured
+	if cfg.Admin.Listen != "" {
+		go func() {
+			if err := admin.NewServer(mgr).Serve(ctx, cfg.Admin.Listen); err != nil {
+				logger.Warn("Admin API stopped", "err", err)
+			}
+		}()
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		sig := <-sigCh
-		log.Printf("Received signal %v, shutting down...", sig)
+		logger.Info("Received signal, shutting down", "signal", sig.String())
 		cancel()
 	}()
 
 	// Run the manager
-	log.Printf("Starting cycle collector with %d series...", enabledCount)
-	log.Printf("Output directory: %s", cfg.Storage.OutputDir)
-	log.Printf("Gzip compression: %v", useGzip)
-	log.Printf("Scan interval: %v", cfg.Manager.ScanInterval)
-	log.Printf("Grace period: %v", cfg.Manager.GracePeriod)
+	logger.Info("Starting cycle collector",
+		"series", enabledCount,
+		"output_dir", cfg.Storage.OutputDir,
+		"gzip", useGzip,
+		"raw", cfg.Storage.Raw)
+	logger.Info("Write pipeline",
+		"queue", cfg.Pipeline.QueueSize, "batch", cfg.Pipeline.BatchSize, "overflow", cfg.Pipeline.Overflow)
+	logger.Info("WebSocket heartbeat",
+		"ping", cfg.WebSocket.PingInterval, "read_timeout", cfg.WebSocket.ReadTimeout, "stale_timeout", cfg.WebSocket.StaleTimeout)
+	logger.Info("Discovery", "scan_interval", cfg.Manager.ScanInterval, "grace_period", cfg.Manager.GracePeriod,
+		"prestart_lead", cfg.Manager.PrestartLead)
+	if cfg.REST.VerifyInterval > 0 {
+		logger.Info("REST verification", "interval", cfg.REST.VerifyInterval)
+	}
+	if cfg.Metrics.Port > 0 {
+		logger.Info("Serving metrics", "url", "http://localhost"+cfg.Metrics.Addr()+"/metrics")
+	}
+	if alerts != nil {
+		logger.Info("Alerts enabled", "notifiers", len(cfg.Alerts.Notifiers))
+	}
+	if cfg.Admin.Listen != "" {
+		logger.Info("Serving admin API", "url", "http://"+cfg.Admin.Listen+"/api/sessions")
+	}
 
 	if err := mgr.Run(ctx); err != nil && err != context.Canceled {
-		log.Fatalf("Manager error: %v", err)
+		fatal(logger, "Manager error", "err", err)
 	}
 
-	log.Println("Cycle collector stopped")
+	logger.Info("Cycle collector stopped")
+}
+
+// fatal logs an error and exits.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
 }
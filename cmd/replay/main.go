@@ -0,0 +1,155 @@
+// Command replay plays recorded market data back, for backtesting against
+// history without connecting to Polymarket.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/replay"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+func main() {
+	listen := flag.String("listen", "", "Serve the recording as a WebSocket market channel on this address (e.g. :8765)")
+	speed := flag.Float64("speed", replay.RealTime, "Playback speed: 1 = real time, 10 = 10x faster, 0 = as fast as possible")
+	hold := flag.Bool("hold", false, "With --listen, keep serving after playback ends (until Ctrl+C)")
+	verbose := flag.Bool("v", false, "Verbose output")
+
+	flag.Parse()
+	files := flag.Args()
+
+	if len(files) == 0 {
+		fmt.Println("Usage: replay [options] <file.jsonl[.gz]> [more files...]")
+		fmt.Println()
+		fmt.Println("Options:")
+		flag.PrintDefaults()
+		fmt.Println()
+		fmt.Println("Examples:")
+		fmt.Println("  replay --speed 0 data/eth-15m/2026-02-06_1770365700.jsonl.gz > messages.jsonl")
+		fmt.Println("  replay --listen :8765 --speed 10 data/eth-15m/*.jsonl.gz")
+		fmt.Println()
+		fmt.Println("With --listen, point clients at ws://localhost:8765/ws/market.")
+		fmt.Println("Playback starts when the first client subscribes.")
+		os.Exit(1)
+	}
+
+	src, err := replay.Open(files...)
+	if err != nil {
+		log.Fatalf("Error opening recordings: %v", err)
+	}
+	defer src.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle Ctrl+C
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Fprintln(os.Stderr, "\nShutting down...")
+		cancel()
+	}()
+
+	player := replay.NewPlayer(src).
+		WithSpeed(*speed).
+		OnGap(func(gap recording.GapRecord) {
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "[%s] gap: %s for %v\n",
+					gap.Start.Format("15:04:05"), gap.Reason, gap.End.Sub(gap.Start).Round(time.Millisecond))
+			}
+		})
+
+	start := time.Now()
+	if *listen != "" {
+		err = serve(ctx, player, *listen, *hold)
+	} else {
+		err = printMessages(ctx, player, *verbose)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Replay error: %v", err)
+	}
+
+	stats := player.Stats()
+	fmt.Fprintf(os.Stderr, "\n--- Summary ---\n")
+	fmt.Fprintf(os.Stderr, "Frames played:  %d\n", stats.Frames)
+	fmt.Fprintf(os.Stderr, "Gaps:           %d\n", stats.Gaps)
+	fmt.Fprintf(os.Stderr, "Elapsed:        %v\n", time.Since(start).Round(time.Millisecond))
+}
+
+// serve plays the recording to WebSocket clients.
+func serve(ctx context.Context, player *replay.Player, addr string, hold bool) error {
+	srv := replay.NewServer(player)
+	mux := http.NewServeMux()
+	mux.Handle("/ws/market", srv)
+	httpServer := &http.Server{Addr: addr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+	defer httpServer.Close()
+
+	fmt.Fprintf(os.Stderr, "Serving on ws://%s/ws/market, waiting for a subscription...\n", displayAddr(addr))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("listening: %w", err)
+	case err := <-done:
+		if err != nil || !hold {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Playback finished, still serving %d clients (Ctrl+C to stop)\n", srv.Connections())
+	<-ctx.Done()
+	return nil
+}
+
+// printMessages writes each recorded message to stdout as JSON.
+func printMessages(ctx context.Context, player *replay.Player, verbose bool) error {
+	return player.PlayTo(ctx, func(messages []ws.WSMessage) {
+		for _, msg := range messages {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "[%s] %s: asset=%s market=%s\n",
+					time.Unix(0, msg.ReceivedAt).Format("15:04:05.000"),
+					msg.EventType,
+					truncateID(msg.AssetID),
+					truncateID(msg.Market))
+			}
+			data, _ := json.Marshal(msg)
+			fmt.Println(string(data))
+		}
+	})
+}
+
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+func truncateID(id string) string {
+	if len(id) > 20 {
+		return id[:20] + "..."
+	}
+	return id
+}
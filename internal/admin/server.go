@@ -0,0 +1,144 @@
+// Package admin serves the cycle collector's status and admin HTTP API.
+//
+// Endpoints:
+//
+//	GET  /healthz                      liveness: the process is serving
+//	GET  /readyz                       readiness: the initial scan is done
+//	GET  /api/sessions                 active sessions
+//	POST /api/sessions/{id}/stop       stop a session until its market ends
+//	GET  /api/series                   configured series
+//	POST /api/series/{slug}/enable     resume discovery for a series
+//	POST /api/series/{slug}/disable    pause discovery for a series
+//	POST /api/scan                     run a discovery scan now
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/manager"
+)
+
+// Server is the admin API of a MarketManager.
+type Server struct {
+	mgr *manager.MarketManager
+	mux *http.ServeMux
+}
+
+// NewServer creates the admin API for a manager.
+func NewServer(mgr *manager.MarketManager) *Server {
+	s := &Server{mgr: mgr, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /readyz", s.handleReady)
+	s.mux.HandleFunc("GET /api/sessions", s.handleSessions)
+	s.mux.HandleFunc("POST /api/sessions/{id}/stop", s.handleStopSession)
+	s.mux.HandleFunc("GET /api/series", s.handleSeries)
+	s.mux.HandleFunc("POST /api/series/{slug}/enable", s.handleSetSeries(true))
+	s.mux.HandleFunc("POST /api/series/{slug}/disable", s.handleSetSeries(false))
+	s.mux.HandleFunc("POST /api/scan", s.handleScan)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve serves the API on addr until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("serving admin API: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("stopping admin API: %w", err)
+		}
+		return nil
+	}
+}
+
+// status is the response of the probes and admin actions.
+type status struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, status{Status: "ok"})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.mgr.Ready() {
+		writeJSON(w, http.StatusServiceUnavailable, status{Status: "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, status{Status: "ready"})
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.mgr.SessionInfos())
+}
+
+func (s *Server) handleStopSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.mgr.StopSession(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	slog.Info("Admin API stopped session", "market_id", id)
+	writeJSON(w, http.StatusOK, status{Status: "stopped"})
+}
+
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.mgr.Series())
+}
+
+func (s *Server) handleSetSeries(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.PathValue("slug")
+		if err := s.mgr.SetSeriesEnabled(slug, enabled); err != nil {
+			writeError(w, err)
+			return
+		}
+		result := "disabled"
+		if enabled {
+			result = "enabled"
+		}
+		slog.Info("Admin API updated series", "series", slug, "status", result)
+		writeJSON(w, http.StatusOK, status{Status: result})
+	}
+}
+
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	s.mgr.RequestScan()
+	writeJSON(w, http.StatusAccepted, status{Status: "scan requested"})
+}
+
+// writeError maps a manager error to a status code.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, manager.ErrSessionNotFound) || errors.Is(err, manager.ErrSeriesNotFound) {
+		code = http.StatusNotFound
+	}
+	writeJSON(w, code, status{Status: "error", Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,188 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/config"
+	"github.com/johan/polymarket-collector/internal/gamma/gammatest"
+	"github.com/johan/polymarket-collector/internal/manager"
+	"github.com/johan/polymarket-collector/internal/ws/wstest"
+)
+
+// newTestManager runs a manager against the Gamma fixtures and a fake
+// market channel. The fixture series has one market with tokens.
+func newTestManager(t *testing.T) (*manager.MarketManager, *gammatest.Server) {
+	t.Helper()
+	gammaSrv := gammatest.NewFixtureServer()
+	t.Cleanup(gammaSrv.Close)
+	wsSrv := wstest.NewServer()
+	t.Cleanup(wsSrv.Close)
+
+	cfg := &config.ManagerConfig{
+		ScanInterval: time.Hour,
+		GracePeriod:  time.Minute,
+		Series: []config.SeriesConfig{
+			{Slug: gammatest.FixtureSeries, Enabled: true},
+			{Slug: "btc-up-or-down-hourly", Enabled: false},
+		},
+	}
+	storageCfg := config.StorageConfig{OutputDir: t.TempDir()}
+	mgr := manager.NewMarketManager(gammaSrv.Client(), cfg, storageCfg, false).
+		WithWebSocket(config.WebSocketConfig{
+			URL:            wsSrv.URL,
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			BackoffFactor:  2,
+		})
+	return mgr, gammaSrv
+}
+
+func run(t *testing.T, mgr *manager.MarketManager) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mgr.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	waitUntil(t, mgr.Ready)
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// do sends a request and decodes the JSON response into v, if not nil.
+func do(t *testing.T, h http.Handler, method, path string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestServer_Probes(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	srv := NewServer(mgr)
+
+	if code := do(t, srv, http.MethodGet, "/healthz", nil); code != http.StatusOK {
+		t.Errorf("healthz = %d", code)
+	}
+	if code := do(t, srv, http.MethodGet, "/readyz", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before the initial scan = %d, want 503", code)
+	}
+
+	run(t, mgr)
+	if code := do(t, srv, http.MethodGet, "/readyz", nil); code != http.StatusOK {
+		t.Errorf("readyz = %d, want 200", code)
+	}
+}
+
+func TestServer_Sessions(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	srv := NewServer(mgr)
+	run(t, mgr)
+
+	var sessions []manager.SessionInfo
+	waitUntil(t, func() bool {
+		do(t, srv, http.MethodGet, "/api/sessions", &sessions)
+		return len(sessions) == 1 && sessions[0].State == "connected" && sessions[0].MessageCount == 2
+	})
+	s := sessions[0]
+	if s.SeriesSlug != gammatest.FixtureSeries || s.MarketID != "1338378" || len(s.TokenIDs) != 2 {
+		t.Errorf("session = %+v", s)
+	}
+	if s.FilePath == "" || s.EndDate.IsZero() || s.StartTime.IsZero() {
+		t.Errorf("session is missing file path or times: %+v", s)
+	}
+}
+
+func TestServer_StopSession(t *testing.T) {
+	mgr, gammaSrv := newTestManager(t)
+	srv := NewServer(mgr)
+	run(t, mgr)
+	waitUntil(t, func() bool { return mgr.SessionCount() == 1 })
+
+	if code := do(t, srv, http.MethodPost, "/api/sessions/unknown/stop", nil); code != http.StatusNotFound {
+		t.Errorf("stopping an unknown session = %d, want 404", code)
+	}
+	if code := do(t, srv, http.MethodPost, "/api/sessions/1338378/stop", nil); code != http.StatusOK {
+		t.Fatalf("stop = %d", code)
+	}
+	if n := mgr.SessionCount(); n != 0 {
+		t.Fatalf("sessions after stop = %d", n)
+	}
+
+	// A forced scan finds the market again but does not restart it
+	requests := len(gammaSrv.Requests())
+	if code := do(t, srv, http.MethodPost, "/api/scan", nil); code != http.StatusAccepted {
+		t.Fatalf("scan = %d", code)
+	}
+	waitUntil(t, func() bool { return len(gammaSrv.Requests()) > requests })
+	time.Sleep(50 * time.Millisecond)
+	if n := mgr.SessionCount(); n != 0 {
+		t.Errorf("stopped session restarted by scan")
+	}
+}
+
+func TestServer_Series(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	srv := NewServer(mgr)
+
+	if code := do(t, srv, http.MethodPost, "/api/series/btc-up-or-down-hourly/enable", nil); code != http.StatusOK {
+		t.Fatalf("enable = %d", code)
+	}
+	if code := do(t, srv, http.MethodPost, "/api/series/"+gammatest.FixtureSeries+"/disable", nil); code != http.StatusOK {
+		t.Fatalf("disable = %d", code)
+	}
+	if code := do(t, srv, http.MethodPost, "/api/series/unknown/enable", nil); code != http.StatusNotFound {
+		t.Errorf("enabling an unknown series = %d, want 404", code)
+	}
+
+	var series []config.SeriesConfig
+	do(t, srv, http.MethodGet, "/api/series", &series)
+	enabled := map[string]bool{}
+	for _, s := range series {
+		enabled[s.Slug] = s.Enabled
+	}
+	if enabled[gammatest.FixtureSeries] || !enabled["btc-up-or-down-hourly"] {
+		t.Errorf("series = %+v", series)
+	}
+
+	// The disabled series is skipped by discovery
+	run(t, mgr)
+	time.Sleep(50 * time.Millisecond)
+	for _, s := range mgr.SessionInfos() {
+		if s.SeriesSlug == gammatest.FixtureSeries {
+			t.Errorf("session started for disabled series: %+v", s)
+		}
+	}
+}
+
+func TestServer_MethodNotAllowed(t *testing.T) {
+	mgr, _ := newTestManager(t)
+	srv := NewServer(mgr)
+	if code := do(t, srv, http.MethodGet, "/api/scan", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/scan = %d, want 405", code)
+	}
+}
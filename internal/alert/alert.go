@@ -0,0 +1,176 @@
+// Package alert sends notifications when the cycle collector is not
+// collecting data as expected: a silent feed, failing discovery, a session
+// that ended nearly empty, or a disk that is filling up.
+//
+// The manager evaluates the rules; an Alerter rate-limits the resulting
+// alerts and delivers them to the configured notifiers.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/config"
+)
+
+// Alert rules.
+const (
+	RuleFeedSilent       = "feed_silent"
+	RuleDiscoveryFailing = "discovery_failing"
+	RuleLowMessageCount  = "low_message_count"
+	RuleLowDiskSpace     = "low_disk_space"
+)
+
+// Alert is a single notification.
+type Alert struct {
+	Rule     string    `json:"rule"`
+	Series   string    `json:"series,omitempty"`
+	MarketID string    `json:"market_id,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// key identifies the rule and subject for rate limiting.
+func (a Alert) key() string {
+	return a.Rule + "/" + a.Series + "/" + a.MarketID
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Rules holds the alert thresholds. A zero threshold disables its rule.
+type Rules struct {
+	SilentAfter        time.Duration // Session without messages
+	DiscoveryFailures  int           // Consecutive discovery failures per series
+	MinSessionMessages int64         // Messages collected by an ended session
+	MinFreeDisk        uint64        // Free bytes in the output directory
+}
+
+// Alerter rate-limits alerts and delivers them to notifiers. A nil
+// *Alerter is valid: its rules are all disabled and Fire does nothing.
+type Alerter struct {
+	rules     Rules
+	cooldown  time.Duration
+	notifiers []Notifier
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu   sync.Mutex
+	last map[string]time.Time // Last alert per rule and subject
+
+	wg sync.WaitGroup
+}
+
+// New creates an alerter. An alert is suppressed if the same rule fired
+// for the same subject within cooldown.
+func New(rules Rules, cooldown time.Duration, notifiers ...Notifier) *Alerter {
+	return &Alerter{
+		rules:     rules,
+		cooldown:  cooldown,
+		notifiers: notifiers,
+		logger:    slog.Default(),
+		now:       time.Now,
+		last:      make(map[string]time.Time),
+	}
+}
+
+// FromConfig creates an alerter from the alerts settings. It returns nil
+// if no notifiers are configured.
+func FromConfig(cfg config.AlertsConfig, logger *slog.Logger) (*Alerter, error) {
+	if len(cfg.Notifiers) == 0 {
+		return nil, nil
+	}
+
+	var notifiers []Notifier
+	for i, n := range cfg.Notifiers {
+		switch n.Type {
+		case "log":
+			notifiers = append(notifiers, NewLogNotifier(logger))
+		case "webhook":
+			if n.URL == "" {
+				return nil, fmt.Errorf("notifier %d: url required for webhook", i)
+			}
+			notifiers = append(notifiers, NewWebhookNotifier(n.URL, n.Timeout))
+		case "command":
+			if len(n.Command) == 0 {
+				return nil, fmt.Errorf("notifier %d: command required for command notifier", i)
+			}
+			notifiers = append(notifiers, NewCommandNotifier(n.Command, n.Timeout))
+		default:
+			return nil, fmt.Errorf("notifier %d: invalid type: %s", i, n.Type)
+		}
+	}
+
+	rules := Rules{
+		SilentAfter:        cfg.SilentAfter,
+		DiscoveryFailures:  cfg.DiscoveryFailures,
+		MinSessionMessages: cfg.MinSessionMessages,
+	}
+	if cfg.MinFreeDiskMB > 0 {
+		rules.MinFreeDisk = uint64(cfg.MinFreeDiskMB) << 20
+	}
+	return New(rules, cfg.Cooldown, notifiers...).WithLogger(logger), nil
+}
+
+// WithLogger sets the logger for delivery errors.
+func (a *Alerter) WithLogger(logger *slog.Logger) *Alerter {
+	a.logger = logger
+	return a
+}
+
+// Rules returns the alert thresholds.
+func (a *Alerter) Rules() Rules {
+	if a == nil {
+		return Rules{}
+	}
+	return a.rules
+}
+
+// Fire sends an alert to every notifier unless the same rule fired for
+// the same subject within the cooldown. Delivery is asynchronous; Fire
+// reports whether the alert was sent.
+func (a *Alerter) Fire(al Alert) bool {
+	if a == nil {
+		return false
+	}
+	if al.Time.IsZero() {
+		al.Time = a.now()
+	}
+
+	a.mu.Lock()
+	for key, at := range a.last {
+		if al.Time.Sub(at) >= a.cooldown {
+			delete(a.last, key)
+		}
+	}
+	if _, ok := a.last[al.key()]; ok {
+		a.mu.Unlock()
+		return false
+	}
+	a.last[al.key()] = al.Time
+	a.mu.Unlock()
+
+	for _, n := range a.notifiers {
+		a.wg.Add(1)
+		go func(n Notifier) {
+			defer a.wg.Done()
+			if err := n.Notify(context.Background(), al); err != nil {
+				a.logger.Warn("Alert delivery failed", "rule", al.Rule, "err", err)
+			}
+		}(n)
+	}
+	return true
+}
+
+// Wait waits for alerts that are being delivered.
+func (a *Alerter) Wait() {
+	if a == nil {
+		return
+	}
+	a.wg.Wait()
+}
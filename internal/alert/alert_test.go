@@ -0,0 +1,146 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/config"
+)
+
+// recorder is a notifier that keeps the alerts it receives.
+type recorder struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (r *recorder) Notify(ctx context.Context, a Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func (r *recorder) rules() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rules []string
+	for _, a := range r.alerts {
+		rules = append(rules, a.Rule)
+	}
+	return rules
+}
+
+func TestAlerter_NilIsNoop(t *testing.T) {
+	var a *Alerter
+	if a.Fire(Alert{Rule: RuleFeedSilent}) {
+		t.Error("nil alerter fired")
+	}
+	if a.Rules() != (Rules{}) {
+		t.Error("nil alerter has rules")
+	}
+	a.Wait()
+}
+
+func TestAlerter_Cooldown(t *testing.T) {
+	rec := &recorder{}
+	a := New(Rules{}, time.Minute, rec)
+	now := time.Date(2026, 2, 6, 8, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	silent := Alert{Rule: RuleFeedSilent, Series: "eth-up-or-down-15m", MarketID: "1338378"}
+	if !a.Fire(silent) {
+		t.Fatal("first alert suppressed")
+	}
+	now = now.Add(30 * time.Second)
+	if a.Fire(silent) {
+		t.Error("repeated alert within cooldown was sent")
+	}
+
+	// Another subject is not affected
+	other := silent
+	other.MarketID = "1338380"
+	if !a.Fire(other) {
+		t.Error("alert for another market suppressed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !a.Fire(silent) {
+		t.Error("alert after cooldown suppressed")
+	}
+
+	a.Wait()
+	if got := len(rec.rules()); got != 3 {
+		t.Errorf("delivered %d alerts, want 3", got)
+	}
+	if rec.alerts[0].Time.IsZero() {
+		t.Error("alert time not set")
+	}
+}
+
+func TestAlerter_DeliveryFailureIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	a := New(Rules{}, time.Minute, NewCommandNotifier([]string{"false"}, time.Second)).WithLogger(logger)
+
+	a.Fire(Alert{Rule: RuleLowDiskSpace, Message: "10 MB free"})
+	a.Wait()
+	if !strings.Contains(buf.String(), "Alert delivery failed") {
+		t.Errorf("log = %q", buf.String())
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	a, err := FromConfig(config.AlertsConfig{SilentAfter: time.Minute}, slog.Default())
+	if err != nil || a != nil {
+		t.Errorf("without notifiers: got %v, %v; want nil, nil", a, err)
+	}
+
+	a, err = FromConfig(config.AlertsConfig{
+		Cooldown:           5 * time.Minute,
+		SilentAfter:        time.Minute,
+		DiscoveryFailures:  3,
+		MinSessionMessages: 1,
+		MinFreeDiskMB:      2,
+		Notifiers: []config.NotifierConfig{
+			{Type: "log"},
+			{Type: "webhook", URL: "http://localhost:1/hook"},
+			{Type: "command", Command: []string{"true"}},
+		},
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	want := Rules{SilentAfter: time.Minute, DiscoveryFailures: 3, MinSessionMessages: 1, MinFreeDisk: 2 << 20}
+	if got := a.Rules(); got != want {
+		t.Errorf("rules = %+v, want %+v", got, want)
+	}
+	if len(a.notifiers) != 3 {
+		t.Errorf("notifiers = %d, want 3", len(a.notifiers))
+	}
+
+	invalid := []config.NotifierConfig{
+		{Type: "email"},
+		{Type: "webhook"},
+		{Type: "command"},
+	}
+	for _, n := range invalid {
+		if _, err := FromConfig(config.AlertsConfig{Notifiers: []config.NotifierConfig{n}}, slog.Default()); err == nil {
+			t.Errorf("expected an error for %+v", n)
+		}
+	}
+}
+
+func TestFreeDiskSpace(t *testing.T) {
+	free, err := FreeDiskSpace(t.TempDir())
+	if err != nil {
+		t.Skipf("free disk space unsupported: %v", err)
+	}
+	if free == 0 {
+		t.Error("no free space reported")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package alert
+
+import "errors"
+
+// FreeDiskSpace is not supported on this platform, so the low disk space
+// rule never fires.
+func FreeDiskSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
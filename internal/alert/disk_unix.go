@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package alert
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeDiskSpace returns the bytes available to unprivileged users on the
+// file system containing path.
+func FreeDiskSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("checking free space of %s: %w", path, err)
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
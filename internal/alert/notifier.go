@@ -0,0 +1,126 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a webhook request or command run.
+const defaultTimeout = 10 * time.Second
+
+// LogNotifier writes alerts to a logger at warn level.
+type LogNotifier struct {
+	logger *slog.Logger
+}
+
+// NewLogNotifier creates a notifier that logs alerts.
+func NewLogNotifier(logger *slog.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Notify logs the alert.
+func (n *LogNotifier) Notify(ctx context.Context, a Alert) error {
+	args := []any{"rule", a.Rule}
+	if a.Series != "" {
+		args = append(args, "series", a.Series)
+	}
+	if a.MarketID != "" {
+		args = append(args, "market_id", a.MarketID)
+	}
+	args = append(args, "message", a.Message)
+	n.logger.WarnContext(ctx, "Alert", args...)
+	return nil
+}
+
+// WebhookNotifier POSTs alerts as JSON.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that POSTs each alert to url.
+// A zero timeout means 10 seconds.
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Notify sends the alert. Any status other than 2xx is an error.
+func (n *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("encoding alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting alert: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// CommandNotifier runs a local command for each alert. The alert is
+// passed as JSON on stdin and in ALERT_* environment variables.
+type CommandNotifier struct {
+	command []string
+	timeout time.Duration
+}
+
+// NewCommandNotifier creates a notifier that runs command. A zero timeout
+// means 10 seconds.
+func NewCommandNotifier(command []string, timeout time.Duration) *CommandNotifier {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &CommandNotifier{command: command, timeout: timeout}
+}
+
+// Notify runs the command. A non-zero exit status is an error.
+func (n *CommandNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("encoding alert: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.command[0], n.command[1:]...)
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	cmd.Env = append(os.Environ(),
+		"ALERT_RULE="+a.Rule,
+		"ALERT_SERIES="+a.Series,
+		"ALERT_MARKET_ID="+a.MarketID,
+		"ALERT_MESSAGE="+a.Message,
+		"ALERT_TIME="+a.Time.Format(time.RFC3339))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("running %s: %w: %s", n.command[0], err, msg)
+		}
+		return fmt.Errorf("running %s: %w", n.command[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAlert = Alert{
+	Rule:     RuleLowMessageCount,
+	Series:   "eth-up-or-down-15m",
+	MarketID: "1338378",
+	Message:  "session ended with 0 messages, expected at least 1",
+	Time:     time.Date(2026, 2, 6, 8, 16, 0, 0, time.UTC),
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewLogNotifier(slog.New(slog.NewTextHandler(&buf, nil)))
+	if err := n.Notify(context.Background(), testAlert); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	for _, want := range []string{"level=WARN", "rule=low_message_count", "series=eth-up-or-down-15m", "market_id=1338378"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q missing %q", buf.String(), want)
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Alert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	if err := NewWebhookNotifier(srv.URL, 0).Notify(context.Background(), testAlert); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if got != testAlert {
+		t.Errorf("received %+v, want %+v", got, testAlert)
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := NewWebhookNotifier(srv.URL, 0).Notify(context.Background(), testAlert)
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("err = %v, want a 502 error", err)
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "alert")
+	n := NewCommandNotifier([]string{"sh", "-c", `cat > "$1"; echo "$ALERT_RULE $ALERT_MARKET_ID" >> "$1"`, "sh", out}, 0)
+	if err := n.Notify(context.Background(), testAlert); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, env, _ := strings.Cut(string(data), "\n")
+	var got Alert
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("stdin is not the alert: %q", body)
+	}
+	if got != testAlert {
+		t.Errorf("stdin = %+v, want %+v", got, testAlert)
+	}
+	if env != "low_message_count 1338378\n" {
+		t.Errorf("environment = %q", env)
+	}
+}
+
+func TestCommandNotifier_Failure(t *testing.T) {
+	n := NewCommandNotifier([]string{"sh", "-c", "echo broken >&2; exit 3"}, 0)
+	err := n.Notify(context.Background(), testAlert)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("err = %v, want the command output", err)
+	}
+}
+
+func TestCommandNotifier_Timeout(t *testing.T) {
+	n := NewCommandNotifier([]string{"sleep", "5"}, 50*time.Millisecond)
+	start := time.Now()
+	if err := n.Notify(context.Background(), testAlert); err == nil {
+		t.Error("expected a timeout error")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("command ran for %v after its timeout", d)
+	}
+}
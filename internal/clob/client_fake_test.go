@@ -0,0 +1,101 @@
+package clob_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/clob"
+	"github.com/johan/polymarket-collector/internal/clob/clobtest"
+)
+
+const upToken = "83955612885151370769947492812886282601680164705864046042194488203730621200472"
+
+func TestFetchBook_Fixtures(t *testing.T) {
+	srv := clobtest.NewFixtureServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	book, err := client.FetchBook(ctx, upToken)
+	if err != nil {
+		t.Fatalf("FetchBook failed: %v", err)
+	}
+	if len(book.Bids) != 3 || len(book.Asks) != 3 || book.TickSize != "0.01" {
+		t.Errorf("book = %+v", book)
+	}
+
+	empty, err := client.FetchBook(ctx, "7001")
+	if err != nil {
+		t.Fatalf("FetchBook on empty book failed: %v", err)
+	}
+	if len(empty.Bids) != 0 || len(empty.Asks) != 0 {
+		t.Errorf("empty book = %+v", empty)
+	}
+
+	if _, err := client.FetchBook(ctx, "unknown"); err == nil {
+		t.Error("Expected error for unknown token")
+	}
+	if _, err := client.FetchBook(ctx, ""); err == nil {
+		t.Error("Expected error for empty token ID")
+	}
+}
+
+func TestFetchMidpointAndSpread_Fixtures(t *testing.T) {
+	srv := clobtest.NewFixtureServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	// Levels are unsorted, as on the live API
+	mid, err := client.FetchMidpoint(ctx, upToken)
+	if err != nil || mid != "0.685" {
+		t.Errorf("FetchMidpoint = %q, %v; want 0.685", mid, err)
+	}
+	spread, err := client.FetchSpread(ctx, upToken)
+	if err != nil || spread != "0.01" {
+		t.Errorf("FetchSpread = %q, %v; want 0.01", spread, err)
+	}
+
+	if _, err := client.FetchMidpoint(ctx, "7001"); err == nil {
+		t.Error("Expected error for midpoint of an empty book")
+	}
+
+	srv.FailNext("/spread", http.StatusTooManyRequests)
+	if _, err := client.FetchSpread(ctx, upToken); err == nil {
+		t.Error("Expected error when /spread fails")
+	}
+}
+
+func TestFetchMarkets_Pagination(t *testing.T) {
+	srv := clobtest.NewFixtureServer()
+	defer srv.Close()
+	srv.SetPageSize(2)
+	client := srv.Client()
+
+	var markets []clob.CLOBMarket
+	pages := 0
+	cursor := ""
+	for cursor != clobtest.EndCursor {
+		resp, err := client.FetchMarkets(context.Background(), cursor)
+		if err != nil {
+			t.Fatalf("FetchMarkets(%q) failed: %v", cursor, err)
+		}
+		markets = append(markets, resp.Data...)
+		cursor = resp.NextCursor
+		pages++
+	}
+
+	if pages != 3 || len(markets) != 5 {
+		t.Errorf("pages = %d, markets = %d; want 3, 5", pages, len(markets))
+	}
+	for _, m := range markets {
+		if m.ConditionID == "0x03" && len(m.Tokens) != 0 {
+			t.Errorf("market 0x03 tokens = %v, want none", m.Tokens)
+		}
+	}
+
+	if _, err := client.FetchMarkets(context.Background(), "not-a-cursor"); err == nil {
+		t.Error("Expected error for invalid cursor")
+	}
+}
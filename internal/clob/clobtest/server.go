@@ -0,0 +1,288 @@
+// Package clobtest provides an in-process fake of the CLOB REST API for
+// tests.
+//
+// The server serves /book, /midpoint and /spread from in-memory order books
+// and /markets with cursor pagination. LoadFixtures loads books and markets
+// recorded from the live API, including a market without tokens and an
+// empty book.
+package clobtest
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/johan/polymarket-collector/internal/clob"
+)
+
+// EndCursor is the next_cursor value of the last page.
+const EndCursor = "LTE="
+
+// DefaultPageSize is the number of markets per page of /markets.
+const DefaultPageSize = 500
+
+//go:embed testdata/*.json
+var fixtures embed.FS
+
+// Server is a fake CLOB API.
+type Server struct {
+	// URL is the base URL of the server, for clob.Client.WithBaseURL
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	books    map[string]clob.BookSnapshot
+	markets  []clob.CLOBMarket
+	pageSize int
+	failures map[string][]int
+	requests []string
+}
+
+// NewServer starts an empty server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		books:    make(map[string]clob.BookSnapshot),
+		pageSize: DefaultPageSize,
+		failures: make(map[string][]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/book", s.handleBook)
+	mux.HandleFunc("/midpoint", s.handleMidpoint)
+	mux.HandleFunc("/spread", s.handleSpread)
+	mux.HandleFunc("/markets", s.handleMarkets)
+	s.srv = httptest.NewServer(s.record(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// NewFixtureServer starts a server loaded with the recorded fixtures.
+func NewFixtureServer() *Server {
+	s := NewServer()
+	if err := s.LoadFixtures(); err != nil {
+		s.Close()
+		panic(fmt.Sprintf("clobtest: %v", err))
+	}
+	return s
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client for the server.
+func (s *Server) Client() *clob.Client {
+	return clob.NewClient(s.srv.Client()).WithBaseURL(s.URL)
+}
+
+// LoadFixtures adds the recorded books and markets.
+func (s *Server) LoadFixtures() error {
+	var books []clob.BookSnapshot
+	if err := readFixture("testdata/books.json", &books); err != nil {
+		return err
+	}
+	var markets []clob.CLOBMarket
+	if err := readFixture("testdata/markets.json", &markets); err != nil {
+		return err
+	}
+	for _, book := range books {
+		s.SetBook(book)
+	}
+	s.AddMarkets(markets...)
+	return nil
+}
+
+// SetBook sets the order book returned for book.AssetID.
+func (s *Server) SetBook(book clob.BookSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.books[book.AssetID] = book
+}
+
+// AddMarkets adds markets to /markets.
+func (s *Server) AddMarkets(markets ...clob.CLOBMarket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markets = append(s.markets, markets...)
+}
+
+// SetPageSize sets the number of markets per page of /markets.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// FailNext makes the next request to path fail with status. Calls queue up.
+func (s *Server) FailNext(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], status)
+}
+
+// Requests returns the request URIs received so far, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// record logs each request and serves queued failures.
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.RequestURI())
+		var status int
+		if queued := s.failures[r.URL.Path]; len(queued) > 0 {
+			status = queued[0]
+			s.failures[r.URL.Path] = queued[1:]
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status, http.StatusText(status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// book returns the book for the token_id parameter, or writes the error
+// the live API returns.
+func (s *Server) book(w http.ResponseWriter, r *http.Request) (clob.BookSnapshot, bool) {
+	tokenID := r.URL.Query().Get("token_id")
+	if tokenID == "" {
+		writeError(w, http.StatusBadRequest, "Invalid payload")
+		return clob.BookSnapshot{}, false
+	}
+	s.mu.Lock()
+	book, ok := s.books[tokenID]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No orderbook exists for the requested token id")
+		return clob.BookSnapshot{}, false
+	}
+	return book, true
+}
+
+func (s *Server) handleBook(w http.ResponseWriter, r *http.Request) {
+	if book, ok := s.book(w, r); ok {
+		writeJSON(w, book)
+	}
+}
+
+func (s *Server) handleMidpoint(w http.ResponseWriter, r *http.Request) {
+	book, ok := s.book(w, r)
+	if !ok {
+		return
+	}
+	bid, ask, ok := bestPrices(book)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No orderbook exists for the requested token id")
+		return
+	}
+	mid := new(big.Rat).Add(bid, ask)
+	mid.Quo(mid, big.NewRat(2, 1))
+	writeJSON(w, clob.MidpointResponse{Mid: formatRat(mid)})
+}
+
+func (s *Server) handleSpread(w http.ResponseWriter, r *http.Request) {
+	book, ok := s.book(w, r)
+	if !ok {
+		return
+	}
+	bid, ask, ok := bestPrices(book)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No orderbook exists for the requested token id")
+		return
+	}
+	writeJSON(w, clob.SpreadResponse{Spread: formatRat(new(big.Rat).Sub(ask, bid))})
+}
+
+// handleMarkets pages through markets. Cursors are base64 offsets, like
+// the live API's.
+func (s *Server) handleMarkets(w http.ResponseWriter, r *http.Request) {
+	offset := 0
+	if cursor := r.URL.Query().Get("next_cursor"); cursor != "" {
+		if cursor == EndCursor {
+			writeJSON(w, clob.MarketsResponse{Data: []clob.CLOBMarket{}, NextCursor: EndCursor})
+			return
+		}
+		raw, err := base64.StdEncoding.DecodeString(cursor)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "invalid next_cursor")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	size := s.pageSize
+	var data []clob.CLOBMarket
+	if offset < len(s.markets) {
+		data = s.markets[offset:min(offset+size, len(s.markets))]
+	}
+	data = append([]clob.CLOBMarket{}, data...)
+	next := EndCursor
+	if offset+size < len(s.markets) {
+		next = base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(offset + size)))
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, clob.MarketsResponse{Data: data, NextCursor: next, Limit: size, Count: len(data)})
+}
+
+// bestPrices returns the highest bid and lowest ask. Levels are not
+// assumed to be sorted.
+func bestPrices(book clob.BookSnapshot) (bid, ask *big.Rat, ok bool) {
+	for _, level := range book.Bids {
+		if p, ok := new(big.Rat).SetString(level.Price); ok && (bid == nil || p.Cmp(bid) > 0) {
+			bid = p
+		}
+	}
+	for _, level := range book.Asks {
+		if p, ok := new(big.Rat).SetString(level.Price); ok && (ask == nil || p.Cmp(ask) < 0) {
+			ask = p
+		}
+	}
+	return bid, ask, bid != nil && ask != nil
+}
+
+// formatRat formats r as a decimal without trailing zeros.
+func formatRat(r *big.Rat) string {
+	s := r.FloatString(6)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func readFixture(name string, v any) error {
+	data, err := fixtures.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
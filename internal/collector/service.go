@@ -4,13 +4,15 @@ package collector
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/johan/polymarket-collector/internal/config"
 	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/metrics"
+	"github.com/johan/polymarket-collector/internal/orderbook"
 	"github.com/johan/polymarket-collector/internal/storage"
 	"github.com/johan/polymarket-collector/internal/ws"
 )
@@ -20,10 +22,16 @@ type Service struct {
 	config  *config.Config
 	gamma   *gamma.Client
 	storage storage.Storage
+	raw     storage.RawWriter // Set in raw mode
 	ws      *ws.Client
+	books   *orderbook.Store
+	metrics *metrics.Metrics // Optional
+	logger  *slog.Logger
 
 	mu       sync.Mutex
 	tokenIDs []string
+
+	bytesReported int64 // Storage bytes already passed to metrics
 }
 
 // NewService creates a new collector service.
@@ -35,28 +43,28 @@ func NewService(cfg *config.Config) (*Service, error) {
 	gammaClient := gamma.NewClient(httpClient)
 
 	// Create storage
-	var stor storage.Storage
-	var err error
-	switch cfg.Storage.Type {
-	case "file":
-		stor, err = storage.NewFileStorage(cfg.Storage.OutputDir, cfg.Storage.RotationInterval)
-		if err != nil {
-			return nil, fmt.Errorf("creating file storage: %w", err)
-		}
-	case "none":
-		stor = storage.NewNullStorage()
-	default:
-		return nil, fmt.Errorf("unknown storage type: %s", cfg.Storage.Type)
+	stor, err := newStorage(cfg.Storage, cfg.Storage.Raw)
+	if err != nil {
+		return nil, err
 	}
 
 	s := &Service{
 		config:  cfg,
 		gamma:   gammaClient,
 		storage: stor,
+		books:   orderbook.NewStore(),
+		logger:  slog.Default(),
 	}
 
-	// Create WebSocket client
-	s.ws = ws.NewWSClient(s.handleMessages)
+	// Create WebSocket client. In raw mode frames are archived as received
+	// and never parsed, so the order books are not maintained.
+	if cfg.Storage.Raw {
+		s.raw = stor.(storage.RawWriter)
+		s.ws = ws.NewWSClient(nil).WithRawHandler(s.handleRawFrame)
+	} else {
+		s.ws = ws.NewWSClient(s.handleMessages).OnParseError(s.handleParseError)
+	}
+	s.ws.OnDisconnect(s.handleDisconnect)
 	if cfg.WebSocket.URL != "" {
 		s.ws.WithURL(cfg.WebSocket.URL)
 	}
@@ -64,14 +72,95 @@ func NewService(cfg *config.Config) (*Service, error) {
 		InitialBackoff: cfg.WebSocket.InitialBackoff,
 		MaxBackoff:     cfg.WebSocket.MaxBackoff,
 		BackoffFactor:  cfg.WebSocket.BackoffFactor,
+		Jitter:         cfg.WebSocket.BackoffJitter,
+	})
+	s.ws.WithHeartbeat(ws.HeartbeatConfig{
+		PingInterval: cfg.WebSocket.PingInterval,
+		ReadTimeout:  cfg.WebSocket.ReadTimeout,
+		StaleTimeout: cfg.WebSocket.StaleTimeout,
 	})
 
 	return s, nil
 }
 
+// WithMetrics records Prometheus metrics for the feed, storage writes,
+// multi storage sinks and discovery. The collector has no series, so the series label is empty.
+func (s *Service) WithMetrics(m *metrics.Metrics) *Service {
+	s.metrics = m
+	if multi, ok := s.storage.(*storage.MultiStorage); ok {
+		m.WatchSinks("", multi.Stats)
+	}
+	return s
+}
+
+// WithLogger sets the logger of the service and its WebSocket client.
+func (s *Service) WithLogger(logger *slog.Logger) *Service {
+	s.logger = logger
+	s.ws.WithLogger(logger)
+	return s
+}
+
+// newStorage creates the storage backend for a configuration. For multi
+// storage it is called once per sink. In raw mode every backend must
+// support raw frames.
+func newStorage(cfg config.StorageConfig, raw bool) (storage.Storage, error) {
+	var stor storage.Storage
+	var err error
+	switch cfg.Type {
+	case "file":
+		stor, err = storage.NewFileStorage(cfg.OutputDir, cfg.RotationInterval)
+		if err != nil {
+			return nil, fmt.Errorf("creating file storage: %w", err)
+		}
+	case "parquet":
+		stor, err = storage.NewParquetStorage(cfg.OutputDir, cfg.RotationInterval)
+		if err != nil {
+			return nil, fmt.Errorf("creating parquet storage: %w", err)
+		}
+	case "postgres":
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		stor, err = storage.NewPostgresStorage(ctx, cfg.Postgres)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("creating postgres storage: %w", err)
+		}
+	case "kafka":
+		stor, err = storage.NewKafkaStorage(cfg.Kafka)
+		if err != nil {
+			return nil, fmt.Errorf("creating kafka storage: %w", err)
+		}
+	case "multi":
+		var sinks []storage.Sink
+		for i, sinkCfg := range cfg.Sinks {
+			sinkStor, err := newStorage(config.StorageConfig(sinkCfg), raw)
+			if err != nil {
+				for _, sink := range sinks {
+					sink.Storage.Close()
+				}
+				return nil, fmt.Errorf("sink %d: %w", i, err)
+			}
+			sinks = append(sinks, storage.Sink{
+				Name:    fmt.Sprintf("%s[%d]", sinkCfg.Type, i),
+				Storage: sinkStor,
+			})
+		}
+		return storage.NewMultiStorage(cfg.QueueSize, sinks...), nil
+	case "none":
+		stor = storage.NewNullStorage()
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", cfg.Type)
+	}
+
+	if _, ok := stor.(storage.RawWriter); raw && !ok {
+		stor.Close()
+		return nil, fmt.Errorf("storage type %s does not support raw mode", cfg.Type)
+	}
+	return stor, nil
+}
+
 // Run starts the collector service.
 func (s *Service) Run(ctx context.Context) error {
-	log.Println("Starting collector service...")
+	s.logger.Info("Starting collector service")
 
 	// Initial market discovery
 	if err := s.discoverMarkets(ctx); err != nil {
@@ -82,7 +171,7 @@ func (s *Service) Run(ctx context.Context) error {
 		return fmt.Errorf("no markets discovered")
 	}
 
-	log.Printf("Discovered %d tokens to track", len(s.tokenIDs))
+	s.logger.Info("Discovered tokens to track", "tokens", len(s.tokenIDs))
 
 	// Connect to WebSocket
 	if err := s.ws.Connect(ctx); err != nil {
@@ -95,7 +184,11 @@ func (s *Service) Run(ctx context.Context) error {
 		return fmt.Errorf("subscribing to tokens: %w", err)
 	}
 
-	log.Println("Subscribed to WebSocket feed. Collecting data...")
+	s.metrics.TrackTokens("", s.tokenIDs)
+	s.metrics.SetActiveSessions(1)
+	defer s.metrics.SetActiveSessions(0)
+
+	s.logger.Info("Subscribed to WebSocket feed, collecting data")
 
 	// Start market refresh ticker
 	refreshTicker := time.NewTicker(s.config.Discovery.RefreshInterval)
@@ -105,26 +198,62 @@ func (s *Service) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Shutting down collector service...")
-			return s.storage.Close()
+			s.logger.Info("Shutting down collector service")
+			// Stop the reader first so nothing is written to closed storage
+			s.ws.Close()
+			err := s.storage.Close()
+			s.logSinkStats()
+			return err
 
 		case <-refreshTicker.C:
-			log.Println("Refreshing market list...")
+			s.logger.Debug("Refreshing market list")
 			if err := s.discoverMarkets(ctx); err != nil {
-				log.Printf("Warning: market refresh failed: %v", err)
+				s.logger.Warn("Market refresh failed", "err", err)
 				continue
 			}
 
-			// Re-subscribe with updated token list
-			if err := s.ws.Subscribe(s.tokenIDs); err != nil {
-				log.Printf("Warning: resubscription failed: %v", err)
-			} else {
-				log.Printf("Updated subscription with %d tokens", len(s.tokenIDs))
-			}
+			s.updateSubscription()
 		}
 	}
 }
 
+// updateSubscription subscribes to newly discovered tokens and drops
+// expired ones, leaving the rest of the subscription untouched so the
+// server does not resend snapshots for every token.
+func (s *Service) updateSubscription() {
+	s.mu.Lock()
+	tokenIDs := s.tokenIDs
+	s.mu.Unlock()
+
+	current := make(map[string]bool, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		current[tokenID] = true
+	}
+	var expired []string
+	for _, tokenID := range s.ws.Assets() {
+		if !current[tokenID] {
+			expired = append(expired, tokenID)
+		}
+	}
+
+	removed, err := s.ws.RemoveAssets(expired)
+	if err != nil {
+		s.logger.Warn("Unsubscribing expired tokens failed", "err", err)
+	}
+	for _, tokenID := range removed {
+		s.books.Remove(tokenID)
+	}
+	s.metrics.UntrackTokens(removed)
+
+	added, err := s.ws.AddAssets(tokenIDs)
+	if err != nil {
+		s.logger.Warn("Subscribing new tokens failed", "err", err)
+	}
+	s.metrics.TrackTokens("", added)
+
+	s.logger.Info("Updated subscription", "tokens", len(tokenIDs), "added", len(added), "removed", len(removed))
+}
+
 // discoverMarkets fetches active markets and extracts token IDs.
 func (s *Service) discoverMarkets(ctx context.Context) error {
 	var allTokenIDs []string
@@ -139,7 +268,8 @@ func (s *Service) discoverMarkets(ctx context.Context) error {
 				Limit:   s.config.Discovery.MaxMarkets,
 			})
 			if err != nil {
-				log.Printf("Warning: failed to fetch events for tag %s: %v", tag, err)
+				s.logger.Warn("Failed to fetch events", "tag", tag, "err", err)
+				s.metrics.ObserveDiscoveryFailure("")
 				continue
 			}
 
@@ -147,7 +277,7 @@ func (s *Service) discoverMarkets(ctx context.Context) error {
 				for _, market := range event.Markets {
 					tokenIDs, err := market.ParseTokenIDs()
 					if err != nil {
-						log.Printf("Warning: failed to parse token IDs for market %s: %v", market.ID, err)
+						s.logger.Warn("Failed to parse token IDs", "market_id", market.ID, "err", err)
 						continue
 					}
 					allTokenIDs = append(allTokenIDs, tokenIDs...)
@@ -161,13 +291,14 @@ func (s *Service) discoverMarkets(ctx context.Context) error {
 			Limit:  s.config.Discovery.MaxMarkets,
 		})
 		if err != nil {
+			s.metrics.ObserveDiscoveryFailure("")
 			return fmt.Errorf("fetching markets: %w", err)
 		}
 
 		for _, market := range markets {
 			tokenIDs, err := market.ParseTokenIDs()
 			if err != nil {
-				log.Printf("Warning: failed to parse token IDs for market %s: %v", market.ID, err)
+				s.logger.Warn("Failed to parse token IDs", "market_id", market.ID, "err", err)
 				continue
 			}
 			allTokenIDs = append(allTokenIDs, tokenIDs...)
@@ -186,12 +317,81 @@ func (s *Service) discoverMarkets(ctx context.Context) error {
 	return nil
 }
 
+// OrderBooks returns the live order books for all subscribed tokens.
+func (s *Service) OrderBooks() *orderbook.Store {
+	return s.books
+}
+
 // handleMessages processes incoming WebSocket messages.
 func (s *Service) handleMessages(messages []ws.WSMessage) {
+	if err := s.books.Apply(messages); err != nil {
+		s.logger.Warn("Error updating order book", "err", err)
+	}
+	s.metrics.ObserveMessages("", messages)
+
 	for i := range messages {
+		start := time.Now()
 		if err := s.storage.Write(&messages[i]); err != nil {
-			log.Printf("Error writing message: %v", err)
+			s.logger.Error("Error writing message", "asset_id", messages[i].AssetID, "err", err)
+			continue
+		}
+		s.observeWrite(start)
+	}
+}
+
+// observeWrite records a storage write that began at start. Bytes are
+// taken from backends that count what they write (queued multi sinks are
+// reported once written); others only record the latency. It is called
+// from the WebSocket handler goroutine.
+func (s *Service) observeWrite(start time.Time) {
+	n := 0
+	if c, ok := s.storage.(storage.ByteCounter); ok {
+		total := c.BytesWritten()
+		n = int(total - s.bytesReported)
+		s.bytesReported = total
+	}
+	s.metrics.ObserveWrite("", n, time.Since(start))
+}
+
+// handleParseError counts frames that cannot be parsed.
+func (s *Service) handleParseError(frame ws.RawFrame, err error) {
+	s.metrics.ObserveParseError("")
+}
+
+// handleDisconnect counts dropped connections.
+func (s *Service) handleDisconnect(at time.Time, reason ws.DisconnectReason, err error) {
+	s.metrics.ObserveReconnect("", reason)
+}
+
+// logSinkStats logs the per-sink counters when writing to multiple sinks.
+func (s *Service) logSinkStats() {
+	multi, ok := s.storage.(*storage.MultiStorage)
+	if !ok {
+		return
+	}
+	for _, st := range multi.Stats() {
+		s.logger.Info("Sink stats", "sink", st.Name, "written", st.Written,
+			"errors", st.Errors, "dropped", st.Dropped, "queued", st.Queued)
+	}
+}
+
+// handleRawFrame archives a raw WebSocket frame. Frames are only parsed
+// if metrics are enabled.
+func (s *Service) handleRawFrame(frame ws.RawFrame) {
+	start := time.Now()
+	if err := s.raw.WriteRaw(frame); err != nil {
+		s.logger.Error("Error writing frame", "err", err)
+	} else {
+		s.observeWrite(start)
+	}
+
+	if s.metrics != nil {
+		messages, err := frame.Parse()
+		if err != nil {
+			s.handleParseError(frame, err)
+			return
 		}
+		s.metrics.ObserveMessages("", messages)
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -19,6 +20,7 @@ const (
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
+	now        func() time.Time
 }
 
 // NewClient creates a new Gamma API client.
@@ -29,6 +31,7 @@ func NewClient(httpClient *http.Client) *Client {
 	return &Client{
 		httpClient: httpClient,
 		baseURL:    DefaultBaseURL,
+		now:        time.Now,
 	}
 }
 
@@ -38,6 +41,12 @@ func (c *Client) WithBaseURL(baseURL string) *Client {
 	return c
 }
 
+// WithClock sets the time source used to decide which markets are active.
+func (c *Client) WithClock(now func() time.Time) *Client {
+	c.now = now
+	return c
+}
+
 // FetchSeries fetches series from the Gamma API.
 func (c *Client) FetchSeries(ctx context.Context, filter *Filter) ([]Series, error) {
 	u := c.baseURL + "/series"
@@ -159,37 +168,86 @@ func (c *Client) FetchSeriesBySlug(ctx context.Context, slug string) (*Series, e
 	return &series[0], nil
 }
 
-// FetchActiveMarketsForSeries fetches active (not closed) markets for a series.
-// Only returns markets that are currently tradeable (startTime <= now < endDate).
-// For markets without startTime, we estimate based on the series recurrence.
-func (c *Client) FetchActiveMarketsForSeries(ctx context.Context, seriesSlug string) ([]Market, error) {
-	series, err := c.FetchSeriesBySlug(ctx, seriesSlug)
-	if err != nil {
-		return nil, err
-	}
-
-	// Determine the trading window based on recurrence
-	var tradingWindow time.Duration
-	switch series.Recurrence {
+// RecurrenceWindow returns the length of the trading window of a series
+// recurrence, or one hour if it is unknown.
+func RecurrenceWindow(recurrence string) time.Duration {
+	switch recurrence {
 	case "5m":
-		tradingWindow = 5 * time.Minute
+		return 5 * time.Minute
 	case "15m":
-		tradingWindow = 15 * time.Minute
+		return 15 * time.Minute
 	case "hourly":
-		tradingWindow = 1 * time.Hour
+		return 1 * time.Hour
 	case "4h":
-		tradingWindow = 4 * time.Hour
+		return 4 * time.Hour
 	case "daily":
-		tradingWindow = 24 * time.Hour
+		return 24 * time.Hour
 	case "weekly":
-		tradingWindow = 7 * 24 * time.Hour
+		return 7 * 24 * time.Hour
 	case "monthly":
-		tradingWindow = 30 * 24 * time.Hour
+		return 30 * 24 * time.Hour
 	default:
-		tradingWindow = 1 * time.Hour // Default to 1 hour
+		return 1 * time.Hour // Default to 1 hour
 	}
+}
+
+// Window is the trading window of a series event.
+type Window struct {
+	Event Event
+	Start time.Time // Estimated from the recurrence if the event has no startTime
+	End   time.Time
+}
 
-	now := time.Now()
+// EventWindow returns the trading window of an event in a series with the
+// given recurrence.
+func EventWindow(event Event, recurrence string) Window {
+	start := event.StartTime
+	if start.IsZero() {
+		// Estimate: trading starts one window before endDate
+		start = event.EndDate.Add(-RecurrenceWindow(recurrence))
+	}
+	return Window{Event: event, Start: start, End: event.EndDate}
+}
+
+// FetchSeriesWindows fetches the trading windows of a series' open events
+// that have not ended, ordered by start. Like the series API, the events
+// carry no markets.
+func (c *Client) FetchSeriesWindows(ctx context.Context, seriesSlug string) ([]Window, error) {
+	series, err := c.FetchSeriesBySlug(ctx, seriesSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	var windows []Window
+	for _, event := range series.Events {
+		if event.Closed || event.EndDate.Before(now) {
+			continue
+		}
+		windows = append(windows, EventWindow(event, series.Recurrence))
+	}
+	sort.SliceStable(windows, func(i, j int) bool {
+		return windows[i].Start.Before(windows[j].Start)
+	})
+	return windows, nil
+}
+
+// DefaultEarlyStart is how long before trading starts a market is
+// considered active by default. Actual trading starts before the official
+// startTime.
+const DefaultEarlyStart = 5 * time.Minute
+
+// FetchActiveMarketsForSeries fetches active (not closed) markets for a series.
+// Only returns markets that are tradeable, or will be within earlyStart
+// (startTime - earlyStart <= now < endDate).
+// For markets without startTime, we estimate based on the series recurrence.
+func (c *Client) FetchActiveMarketsForSeries(ctx context.Context, seriesSlug string, earlyStart time.Duration) ([]Market, error) {
+	series, err := c.FetchSeriesBySlug(ctx, seriesSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
 	var activeMarkets []Market
 
 	for _, event := range series.Events {
@@ -213,20 +271,10 @@ func (c *Client) FetchActiveMarketsForSeries(ctx context.Context, seriesSlug str
 
 		fullEvent := events[0]
 
-		// Determine if trading has started
-		// Note: Actual trading starts before the official startTime, so we start collecting 5 minutes early
-		var tradingStarted bool
-		earlyStart := 5 * time.Minute
-		if !fullEvent.StartTime.IsZero() {
-			// Use explicit startTime minus early start buffer
-			tradingStarted = !fullEvent.StartTime.Add(-earlyStart).After(now)
-		} else {
-			// Estimate: trading starts tradingWindow before endDate
-			estimatedStart := fullEvent.EndDate.Add(-tradingWindow).Add(-earlyStart)
-			tradingStarted = !estimatedStart.After(now)
-		}
-
-		if !tradingStarted {
+		// Determine if trading has started, using the explicit startTime or
+		// an estimate from the recurrence.
+		window := EventWindow(fullEvent, series.Recurrence)
+		if window.Start.Add(-earlyStart).After(now) {
 			continue
 		}
 
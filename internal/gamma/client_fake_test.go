@@ -0,0 +1,219 @@
+package gamma_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/gamma/gammatest"
+)
+
+func marketIDs(markets []gamma.Market) string {
+	ids := make([]string, len(markets))
+	for i, m := range markets {
+		ids[i] = m.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestFetchActiveMarketsForSeries_Fixtures(t *testing.T) {
+	srv := gammatest.NewFixtureServer()
+	defer srv.Close()
+
+	markets, err := srv.Client().FetchActiveMarketsForSeries(context.Background(), gammatest.FixtureSeries, gamma.DefaultEarlyStart)
+	if err != nil {
+		t.Fatalf("FetchActiveMarketsForSeries failed: %v", err)
+	}
+
+	// Ended, closed and not yet started events are skipped, as is the
+	// closed market of the current event
+	if got := marketIDs(markets); got != "1338378,1338380" {
+		t.Fatalf("markets = %s, want 1338378,1338380", got)
+	}
+
+	ids, err := markets[0].ParseTokenIDs()
+	if err != nil || len(ids) != 2 {
+		t.Errorf("ParseTokenIDs = %v, %v; want 2 IDs", ids, err)
+	}
+	ids, err = markets[1].ParseTokenIDs()
+	if err != nil || len(ids) != 0 {
+		t.Errorf("ParseTokenIDs on empty clobTokenIds = %v, %v; want none", ids, err)
+	}
+
+	// Only events that passed the time checks are fetched
+	var fetched []string
+	for _, uri := range srv.Requests() {
+		if strings.HasPrefix(uri, "/events") {
+			fetched = append(fetched, uri)
+		}
+	}
+	if len(fetched) != 4 {
+		t.Errorf("event requests = %v, want 4", fetched)
+	}
+}
+
+func TestFetchActiveMarketsForSeries_Clock(t *testing.T) {
+	srv := gammatest.NewFixtureServer()
+	defer srv.Close()
+
+	// Eleven minutes later the first window has ended and the estimated
+	// start of the next one has passed
+	later := gammatest.FixtureTime.Add(11 * time.Minute)
+	client := srv.Client().WithClock(func() time.Time { return later })
+
+	markets, err := client.FetchActiveMarketsForSeries(context.Background(), gammatest.FixtureSeries, gamma.DefaultEarlyStart)
+	if err != nil {
+		t.Fatalf("FetchActiveMarketsForSeries failed: %v", err)
+	}
+	if got := marketIDs(markets); got != "1338380,1338381" {
+		t.Errorf("markets = %s, want 1338380,1338381", got)
+	}
+}
+
+func TestFetchActiveMarketsForSeries_EarlyStart(t *testing.T) {
+	srv := gammatest.NewFixtureServer()
+	defer srv.Close()
+
+	// One minute before the 08:15 window
+	at := time.Date(2026, 2, 6, 8, 14, 0, 0, time.UTC)
+	client := srv.Client().WithClock(func() time.Time { return at })
+
+	for _, tc := range []struct {
+		earlyStart time.Duration
+		want       string
+	}{
+		{gamma.DefaultEarlyStart, "1338378,1338380,1338381"},
+		{30 * time.Second, "1338378,1338380"},
+	} {
+		markets, err := client.FetchActiveMarketsForSeries(context.Background(), gammatest.FixtureSeries, tc.earlyStart)
+		if err != nil {
+			t.Fatalf("FetchActiveMarketsForSeries failed: %v", err)
+		}
+		if got := marketIDs(markets); got != tc.want {
+			t.Errorf("earlyStart %v: markets = %s, want %s", tc.earlyStart, got, tc.want)
+		}
+	}
+}
+
+func TestFetchSeriesWindows(t *testing.T) {
+	srv := gammatest.NewFixtureServer()
+	defer srv.Close()
+
+	windows, err := srv.Client().FetchSeriesWindows(context.Background(), gammatest.FixtureSeries)
+	if err != nil {
+		t.Fatalf("FetchSeriesWindows failed: %v", err)
+	}
+
+	// Ended and closed events are skipped. The series lists no startTime,
+	// so every start is estimated from the 15m recurrence.
+	want := []struct {
+		slug  string
+		start string
+	}{
+		{"eth-updown-15m-1770364800", "08:00"},
+		{"eth-updown-15m-1770365880", "08:03"},
+		{"eth-updown-15m-1770366600", "08:15"},
+		{"eth-updown-15m-1770367500", "08:30"},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("got %d windows, want %d: %+v", len(windows), len(want), windows)
+	}
+	for i, w := range want {
+		got := windows[i]
+		if got.Event.Slug != w.slug || got.Start.Format("15:04") != w.start || got.End.Sub(got.Start) != 15*time.Minute {
+			t.Errorf("window %d = %s %s-%s, want %s from %s",
+				i, got.Event.Slug, got.Start.Format("15:04"), got.End.Format("15:04"), w.slug, w.start)
+		}
+	}
+	for _, uri := range srv.Requests() {
+		if strings.HasPrefix(uri, "/events") {
+			t.Errorf("unexpected event request %s", uri)
+		}
+	}
+}
+
+func TestEventWindow(t *testing.T) {
+	end := time.Date(2026, 2, 6, 9, 0, 0, 0, time.UTC)
+	start := end.Add(-10 * time.Minute)
+
+	if w := gamma.EventWindow(gamma.Event{StartTime: start, EndDate: end}, "hourly"); !w.Start.Equal(start) {
+		t.Errorf("explicit start = %v, want %v", w.Start, start)
+	}
+	for recurrence, length := range map[string]time.Duration{
+		"5m":      5 * time.Minute,
+		"hourly":  time.Hour,
+		"daily":   24 * time.Hour,
+		"unknown": time.Hour,
+	} {
+		if w := gamma.EventWindow(gamma.Event{EndDate: end}, recurrence); end.Sub(w.Start) != length {
+			t.Errorf("%s: estimated window = %v, want %v", recurrence, end.Sub(w.Start), length)
+		}
+	}
+}
+
+func TestFetchActiveMarketsForSeries_Errors(t *testing.T) {
+	srv := gammatest.NewFixtureServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	if _, err := client.FetchActiveMarketsForSeries(ctx, "no-such-series", gamma.DefaultEarlyStart); err == nil {
+		t.Error("Expected error for unknown series")
+	}
+
+	srv.FailNext("/series", http.StatusServiceUnavailable)
+	if _, err := client.FetchActiveMarketsForSeries(ctx, gammatest.FixtureSeries, gamma.DefaultEarlyStart); err == nil {
+		t.Error("Expected error when /series fails")
+	}
+
+	// A failed event lookup skips that event only
+	srv.FailNext("/events", http.StatusInternalServerError)
+	markets, err := client.FetchActiveMarketsForSeries(ctx, gammatest.FixtureSeries, gamma.DefaultEarlyStart)
+	if err != nil {
+		t.Fatalf("FetchActiveMarketsForSeries failed: %v", err)
+	}
+	if got := marketIDs(markets); got != "1338380" {
+		t.Errorf("markets = %s, want 1338380", got)
+	}
+}
+
+func TestFetch_Filters(t *testing.T) {
+	srv := gammatest.NewFixtureServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	active := true
+	series, err := client.FetchSeries(ctx, &gamma.Filter{Active: &active})
+	if err != nil {
+		t.Fatalf("FetchSeries failed: %v", err)
+	}
+	if len(series) != 1 || series[0].Recurrence != "15m" {
+		t.Errorf("active series = %+v", series)
+	}
+
+	events, err := client.FetchEvents(ctx, &gamma.Filter{TagSlug: "ethereum"})
+	if err != nil {
+		t.Fatalf("FetchEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("tagged events = %d, want 2", len(events))
+	}
+
+	closed := false
+	markets, err := client.FetchMarkets(ctx, &gamma.Filter{Closed: &closed, Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("FetchMarkets failed: %v", err)
+	}
+	if got := marketIDs(markets); got != "1338378,1338380" {
+		t.Errorf("markets page = %s, want 1338378,1338380", got)
+	}
+
+	markets, err = client.FetchMarkets(ctx, &gamma.Filter{Offset: 100})
+	if err != nil || len(markets) != 0 {
+		t.Errorf("FetchMarkets past the end = %d markets, %v", len(markets), err)
+	}
+}
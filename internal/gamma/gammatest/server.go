@@ -0,0 +1,279 @@
+// Package gammatest provides an in-process fake of the Gamma REST API for
+// tests.
+//
+// The server serves /series, /events and /markets from in-memory data with
+// the same filters and pagination the client uses. LoadFixtures loads
+// responses recorded from the live API for the eth-up-or-down-15m series,
+// including the edge cases the collector has to handle: ended and closed
+// events, events without startTime, closed markets and markets without
+// token IDs. The fixtures are meant to be read at FixtureTime.
+package gammatest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/gamma"
+)
+
+// FixtureSeries is the slug of the recorded series.
+const FixtureSeries = "eth-up-or-down-15m"
+
+// FixtureTime is the time the fixtures were recorded at. At this time the
+// active markets of FixtureSeries are 1338378 (explicit startTime) and
+// 1338380 (estimated start, no token IDs).
+var FixtureTime = time.Date(2026, 2, 6, 8, 5, 0, 0, time.UTC)
+
+//go:embed testdata/*.json
+var fixtures embed.FS
+
+// Server is a fake Gamma API.
+type Server struct {
+	// URL is the base URL of the server, for gamma.Client.WithBaseURL
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	series   []gamma.Series
+	events   []gamma.Event
+	markets  []gamma.Market
+	failures map[string][]int
+	requests []string
+}
+
+// NewServer starts an empty server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{failures: make(map[string][]int)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/series", s.handleSeries)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/markets", s.handleMarkets)
+	s.srv = httptest.NewServer(s.record(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// NewFixtureServer starts a server loaded with the recorded fixtures.
+func NewFixtureServer() *Server {
+	s := NewServer()
+	if err := s.LoadFixtures(); err != nil {
+		s.Close()
+		panic(fmt.Sprintf("gammatest: %v", err))
+	}
+	return s
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client for the server whose clock is fixed at
+// FixtureTime.
+func (s *Server) Client() *gamma.Client {
+	return gamma.NewClient(s.srv.Client()).
+		WithBaseURL(s.URL).
+		WithClock(func() time.Time { return FixtureTime })
+}
+
+// LoadFixtures adds the recorded series, events and markets.
+func (s *Server) LoadFixtures() error {
+	var series []gamma.Series
+	if err := readFixture("testdata/series.json", &series); err != nil {
+		return err
+	}
+	var events []gamma.Event
+	if err := readFixture("testdata/events.json", &events); err != nil {
+		return err
+	}
+	var markets []gamma.Market
+	if err := readFixture("testdata/markets.json", &markets); err != nil {
+		return err
+	}
+	s.AddSeries(series...)
+	s.AddEvents(events...)
+	s.AddMarkets(markets...)
+	return nil
+}
+
+// AddSeries adds series. Their events are returned as is by /series, so
+// like the live API they normally carry no markets.
+func (s *Server) AddSeries(series ...gamma.Series) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series = append(s.series, series...)
+}
+
+// AddEvents adds events, with their markets, to /events.
+func (s *Server) AddEvents(events ...gamma.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+}
+
+// AddMarkets adds markets to /markets.
+func (s *Server) AddMarkets(markets ...gamma.Market) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markets = append(s.markets, markets...)
+}
+
+// FailNext makes the next request to path fail with status. Calls queue up.
+func (s *Server) FailNext(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], status)
+}
+
+// Requests returns the request URIs received so far, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// record logs each request and serves queued failures.
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.RequestURI())
+		var status int
+		if queued := s.failures[r.URL.Path]; len(queued) > 0 {
+			status = queued[0]
+			s.failures[r.URL.Path] = queued[1:]
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	q := newQuery(r)
+	s.mu.Lock()
+	var out []gamma.Series
+	for _, series := range s.series {
+		if q.match(series.Slug, series.Active, false, nil) {
+			out = append(out, series)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, page(out, q))
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := newQuery(r)
+	s.mu.Lock()
+	var out []gamma.Event
+	for _, event := range s.events {
+		if q.match(event.Slug, event.Active, event.Closed, event.Tags) {
+			out = append(out, event)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, page(out, q))
+}
+
+func (s *Server) handleMarkets(w http.ResponseWriter, r *http.Request) {
+	q := newQuery(r)
+	s.mu.Lock()
+	var out []gamma.Market
+	for _, market := range s.markets {
+		if q.match(market.Slug, market.Active, market.Closed, nil) {
+			out = append(out, market)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, page(out, q))
+}
+
+// query holds the filter parameters of gamma.Filter.
+type query struct {
+	slug    string
+	tagSlug string
+	active  *bool
+	closed  *bool
+	limit   int
+	offset  int
+}
+
+func newQuery(r *http.Request) query {
+	v := r.URL.Query()
+	q := query{
+		slug:    v.Get("slug"),
+		tagSlug: v.Get("tag_slug"),
+		active:  parseBool(v.Get("active")),
+		closed:  parseBool(v.Get("closed")),
+	}
+	q.limit, _ = strconv.Atoi(v.Get("_limit"))
+	q.offset, _ = strconv.Atoi(v.Get("_offset"))
+	return q
+}
+
+func (q query) match(slug string, active, closed bool, tags []gamma.Tag) bool {
+	if q.slug != "" && q.slug != slug {
+		return false
+	}
+	if q.active != nil && *q.active != active {
+		return false
+	}
+	if q.closed != nil && *q.closed != closed {
+		return false
+	}
+	if q.tagSlug != "" {
+		for _, tag := range tags {
+			if tag.Slug == q.tagSlug {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// page applies _offset and _limit. An empty result encodes as [], not null.
+func page[T any](items []T, q query) []T {
+	if q.offset >= len(items) {
+		return []T{}
+	}
+	items = items[q.offset:]
+	if q.limit > 0 && q.limit < len(items) {
+		items = items[:q.limit]
+	}
+	return items
+}
+
+func parseBool(s string) *bool {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil
+	}
+	return &b
+}
+
+func readFixture(name string, v any) error {
+	data, err := fixtures.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
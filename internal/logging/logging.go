@@ -0,0 +1,59 @@
+// Package logging builds the structured logger described by the logging
+// settings.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/johan/polymarket-collector/internal/config"
+)
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level: %s", name)
+}
+
+// New creates a logger that writes to w in the configured format (text or
+// json) at the configured level.
+func New(cfg config.LoggingConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(cfg.Format) {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format: %s", cfg.Format)
+}
+
+// Setup creates a logger writing to stderr and makes it the default, so
+// packages that still use the standard log package write through it too.
+func Setup(cfg config.LoggingConfig) (*slog.Logger, error) {
+	logger, err := New(cfg, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	log.SetFlags(0) // The handler adds the time
+	return logger, nil
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/config"
+)
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Debug("hidden")
+	logger.With("series", "eth-up-or-down-15m").Info("Session started", "market_id", "1338378")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("invalid JSON record: %v", err)
+	}
+	if rec["msg"] != "Session started" || rec["series"] != "eth-up-or-down-15m" || rec["market_id"] != "1338378" || rec["level"] != "INFO" {
+		t.Errorf("record = %v", rec)
+	}
+}
+
+func TestNew_DebugText(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.LoggingConfig{Level: "debug", Format: "text"}, &buf)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	logger.Debug("Message", "event_type", "book")
+	if got := buf.String(); !strings.Contains(got, "level=DEBUG") || !strings.Contains(got, "event_type=book") {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(config.LoggingConfig{Level: "verbose", Format: "text"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if _, err := New(config.LoggingConfig{Level: "info", Format: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
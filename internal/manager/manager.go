@@ -2,12 +2,21 @@ package manager
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/johan/polymarket-collector/internal/alert"
 	"github.com/johan/polymarket-collector/internal/config"
 	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/metrics"
+	"github.com/johan/polymarket-collector/internal/pipeline"
+	"github.com/johan/polymarket-collector/internal/verifier"
+	"github.com/johan/polymarket-collector/internal/ws"
 )
 
 // MarketManager orchestrates data collection across multiple market sessions.
@@ -17,10 +26,54 @@ type MarketManager struct {
 	storage config.StorageConfig
 	useGzip bool
 
+	// Optional REST verifier shared by all sessions
+	verifier *verifier.RESTVerifier
+
+	// Write pipeline settings for each session
+	pipeline pipeline.Config
+
+	// WebSocket settings for each session (nil = client defaults)
+	websocket *config.WebSocketConfig
+
+	// Shared connections; nil if each session has its own
+	pool *ws.Pool
+
+	// Optional Prometheus metrics
+	metrics *metrics.Metrics
+
+	// Optional alerting
+	alerts *alert.Alerter
+
+	// Consecutive discovery failures per series. Only used by Run's
+	// goroutine.
+	discoveryFailures map[string]int
+
+	logger *slog.Logger
+
 	mu       sync.RWMutex
 	sessions map[string]*MarketSession // key: marketID
+
+	// Markets whose sessions were stopped by hand, so discovery does not
+	// restart them; the value is when the session would have closed
+	stopped map[string]time.Time
+
+	scanCh chan struct{} // Requests an immediate discovery scan
+	ready  atomic.Bool   // Set after the initial scan, cleared on shutdown
+
+	// Upcoming windows by event slug, and the pre-starts that are due.
+	// Only used by Run's goroutine.
+	scheduled  map[string]scheduledWindow
+	prestartCh chan prestart
+
+	now func() time.Time
 }
 
+// Errors returned by the admin operations.
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSeriesNotFound  = errors.New("series not found")
+)
+
 // NewMarketManager creates a new market manager.
 func NewMarketManager(gammaClient *gamma.Client, cfg *config.ManagerConfig, storageCfg config.StorageConfig, useGzip bool) *MarketManager {
 	return &MarketManager{
@@ -29,18 +82,107 @@ func NewMarketManager(gammaClient *gamma.Client, cfg *config.ManagerConfig, stor
 		storage:  storageCfg,
 		useGzip:  useGzip,
 		sessions: make(map[string]*MarketSession),
+		stopped:  make(map[string]time.Time),
+		scanCh:   make(chan struct{}, 1),
+		logger:   slog.Default(),
+
+		discoveryFailures: make(map[string]int),
+		scheduled:         make(map[string]scheduledWindow),
+		prestartCh:        make(chan prestart),
+		now:               time.Now,
+	}
+}
+
+// WithVerifier enables REST cross-checking of every session's order books.
+func (m *MarketManager) WithVerifier(v *verifier.RESTVerifier) *MarketManager {
+	m.verifier = v
+	return m
+}
+
+// WithLogger sets the logger for the manager, its sessions and their
+// connections. Session records carry series and market_id attributes.
+func (m *MarketManager) WithLogger(logger *slog.Logger) *MarketManager {
+	m.logger = logger
+	if m.pool != nil {
+		m.pool.WithLogger(logger)
+	}
+	return m
+}
+
+// WithMetrics records Prometheus metrics for discovery and every session.
+func (m *MarketManager) WithMetrics(mt *metrics.Metrics) *MarketManager {
+	m.metrics = mt
+	return m
+}
+
+// WithAlerts evaluates the alerter's rules while running: silent feeds,
+// failing discovery, sessions that end with too few messages and low disk
+// space in the output directory.
+func (m *MarketManager) WithAlerts(a *alert.Alerter) *MarketManager {
+	m.alerts = a
+	return m
+}
+
+// WithPipeline sets the write pipeline settings used by every session.
+func (m *MarketManager) WithPipeline(cfg pipeline.Config) *MarketManager {
+	m.pipeline = cfg
+	return m
+}
+
+// WithWebSocket sets the WebSocket URL, reconnection and heartbeat
+// settings used by every session. If max_assets_per_connection is set,
+// sessions share pooled connections instead of opening their own.
+func (m *MarketManager) WithWebSocket(cfg config.WebSocketConfig) *MarketManager {
+	m.websocket = &cfg
+	if cfg.MaxAssetsPerConnection > 0 {
+		m.pool = ws.NewPool(cfg.MaxConnections, cfg.MaxAssetsPerConnection).
+			WithHeartbeat(heartbeatConfig(cfg)).
+			WithLogger(m.logger)
+		if cfg.URL != "" {
+			m.pool.WithURL(cfg.URL)
+		}
+		if cfg.InitialBackoff > 0 {
+			m.pool.WithReconnectConfig(reconnectConfig(cfg))
+		}
+	}
+	return m
+}
+
+// reconnectConfig converts the WebSocket settings for ws.Client.
+func reconnectConfig(cfg config.WebSocketConfig) ws.ReconnectConfig {
+	return ws.ReconnectConfig{
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		BackoffFactor:  cfg.BackoffFactor,
+		Jitter:         cfg.BackoffJitter,
+	}
+}
+
+// heartbeatConfig converts the WebSocket settings for ws.Client.
+func heartbeatConfig(cfg config.WebSocketConfig) ws.HeartbeatConfig {
+	return ws.HeartbeatConfig{
+		PingInterval: cfg.PingInterval,
+		ReadTimeout:  cfg.ReadTimeout,
+		StaleTimeout: cfg.StaleTimeout,
 	}
 }
 
 // Run starts the manager and runs until the context is cancelled.
 func (m *MarketManager) Run(ctx context.Context) error {
-	log.Println("Starting market manager...")
+	m.logger.Info("Starting market manager")
+
+	// Repair files left behind by a crash before new sessions write
+	// next to them
+	m.recoverFiles()
 
 	// Initial scan
 	if err := m.discoverMarkets(ctx); err != nil {
-		log.Printf("Warning: initial market discovery failed: %v", err)
+		m.logger.Warn("Initial market discovery failed", "err", err)
 	}
 
+	m.ready.Store(true)
+	defer m.ready.Store(false)
+
 	// Print initial status
 	m.printStatus()
 
@@ -56,17 +198,32 @@ func (m *MarketManager) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Shutting down market manager...")
+			m.logger.Info("Shutting down market manager")
+			m.stopScheduled()
 			m.stopAllSessions()
+			if m.pool != nil {
+				m.pool.Close()
+			}
+			m.alerts.Wait()
 			return ctx.Err()
 
 		case <-ticker.C:
 			if err := m.discoverMarkets(ctx); err != nil {
-				log.Printf("Warning: market discovery failed: %v", err)
+				m.logger.Warn("Market discovery failed", "err", err)
 			}
 
+		case <-m.scanCh:
+			m.logger.Info("Discovery scan requested")
+			if err := m.discoverMarkets(ctx); err != nil {
+				m.logger.Warn("Market discovery failed", "err", err)
+			}
+
+		case p := <-m.prestartCh:
+			m.startPrestart(ctx, p)
+
 		case <-cleanupTicker.C:
 			m.cleanupExpiredSessions()
+			m.checkAlerts()
 
 		case <-statusTicker.C:
 			m.printStatus()
@@ -74,45 +231,86 @@ func (m *MarketManager) Run(ctx context.Context) error {
 	}
 }
 
+// recoverFiles runs the startup recovery pass over the output directory.
+func (m *MarketManager) recoverFiles() {
+	results, err := RecoverPartialFiles(m.storage.OutputDir)
+	if err != nil {
+		m.logger.Warn("Recovery scan failed", "err", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			m.logger.Error("Could not recover partial file", "file", r.Partial, "flagged_as", r.Path, "err", r.Err)
+			continue
+		}
+		m.logger.Info("Recovered partial file", "file", r.Path, "records", r.Records, "dropped_bytes", r.DroppedBytes)
+	}
+}
+
 // discoverMarkets scans for new markets in configured series.
 func (m *MarketManager) discoverMarkets(ctx context.Context) error {
-	for _, seriesCfg := range m.config.Series {
+	for _, seriesCfg := range m.Series() {
 		if !seriesCfg.Enabled {
 			continue
 		}
 
-		markets, err := m.gamma.FetchActiveMarketsForSeries(ctx, seriesCfg.Slug)
+		markets, err := m.gamma.FetchActiveMarketsForSeries(ctx, seriesCfg.Slug, m.sessionLead())
 		if err != nil {
-			log.Printf("[%s] Error fetching markets: %v", seriesCfg.Slug, err)
+			m.logger.Error("Error fetching markets", "series", seriesCfg.Slug, "err", err)
+			m.metrics.ObserveDiscoveryFailure(seriesCfg.Slug)
+			m.discoveryFailed(seriesCfg.Slug, err)
 			continue
 		}
+		m.discoveryFailures[seriesCfg.Slug] = 0
 
 		for _, market := range markets {
-			m.mu.RLock()
-			_, exists := m.sessions[market.ID]
-			m.mu.RUnlock()
-
-			if exists {
+			if m.hasSession(market.ID) {
 				continue
 			}
 
 			// Start new session
 			if err := m.startSession(ctx, market, seriesCfg.Slug); err != nil {
-				log.Printf("[%s] Error starting session for market %s: %v",
-					seriesCfg.Slug, market.ID, err)
+				m.logger.Error("Error starting session",
+					"series", seriesCfg.Slug, "market_id", market.ID, "err", err)
 			}
 		}
+
+		m.scheduleWindows(ctx, seriesCfg.Slug)
 	}
 
 	return nil
 }
 
+// sessionLead is how long before trading starts a market's session is
+// opened, by discovery or the scheduler. Trading begins before the official
+// start time, so it is never shorter than Gamma's early start.
+func (m *MarketManager) sessionLead() time.Duration {
+	return max(m.config.PrestartLead, gamma.DefaultEarlyStart)
+}
+
+// hasSession reports whether a market has a session or had one stopped by
+// hand.
+func (m *MarketManager) hasSession(marketID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, exists := m.sessions[marketID]
+	_, stopped := m.stopped[marketID]
+	return exists || stopped
+}
+
 // startSession creates and starts a new market session.
 func (m *MarketManager) startSession(ctx context.Context, market gamma.Market, seriesSlug string) error {
 	session, err := NewMarketSession(market, seriesSlug, m.storage.OutputDir, m.config.GracePeriod, m.useGzip)
 	if err != nil {
 		return err
 	}
+	session.setLogger(m.logger)
+	session.verifier = m.verifier
+	session.metrics = m.metrics
+	session.rawMode = m.storage.Raw
+	session.flushInterval = m.storage.FlushInterval
+	session.pipelineCfg = m.pipeline
+	session.wsConfig = m.websocket
+	session.pool = m.pool
 
 	if err := session.Start(ctx); err != nil {
 		return err
@@ -120,32 +318,110 @@ func (m *MarketManager) startSession(ctx context.Context, market gamma.Market, s
 
 	m.mu.Lock()
 	m.sessions[market.ID] = session
+	m.metrics.SetActiveSessions(len(m.sessions))
 	m.mu.Unlock()
 
 	return nil
 }
 
 // cleanupExpiredSessions stops and removes sessions that have expired.
+// Sessions are stopped after releasing m.mu, since stopping flushes and
+// closes their files.
 func (m *MarketManager) cleanupExpiredSessions() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
+	var expired []*MarketSession
 	for id, session := range m.sessions {
 		if session.ShouldClose() {
-			session.Stop()
+			expired = append(expired, session)
 			delete(m.sessions, id)
 		}
 	}
+	m.metrics.SetActiveSessions(len(m.sessions))
+
+	now := time.Now()
+	for id, closeAt := range m.stopped {
+		if now.After(closeAt) {
+			delete(m.stopped, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, session := range expired {
+		session.Stop()
+		m.checkSessionEnded(session)
+	}
+}
+
+// discoveryFailed counts a failed discovery request for a series and
+// alerts once the failures in a row reach the threshold.
+func (m *MarketManager) discoveryFailed(slug string, err error) {
+	m.discoveryFailures[slug]++
+	n := m.discoveryFailures[slug]
+	if limit := m.alerts.Rules().DiscoveryFailures; limit > 0 && n >= limit {
+		m.alerts.Fire(alert.Alert{
+			Rule:    alert.RuleDiscoveryFailing,
+			Series:  slug,
+			Message: fmt.Sprintf("discovery failed %d times in a row: %v", n, err),
+		})
+	}
+}
+
+// checkSessionEnded alerts if a session that ran to the end of its market
+// collected fewer messages than the threshold.
+func (m *MarketManager) checkSessionEnded(s *MarketSession) {
+	limit := m.alerts.Rules().MinSessionMessages
+	if n := s.MessageCount(); limit > 0 && n < limit {
+		m.alerts.Fire(alert.Alert{
+			Rule:     alert.RuleLowMessageCount,
+			Series:   s.SeriesSlug,
+			MarketID: s.MarketID,
+			Message:  fmt.Sprintf("session ended with %d messages, expected at least %d", n, limit),
+		})
+	}
+}
+
+// checkAlerts evaluates the rules that depend on elapsed time: silent
+// feeds and free disk space.
+func (m *MarketManager) checkAlerts() {
+	rules := m.alerts.Rules()
+
+	if rules.SilentAfter > 0 {
+		now := time.Now()
+		for _, s := range m.GetSessions() {
+			if idle := now.Sub(s.LastActivity()); idle >= rules.SilentAfter {
+				m.alerts.Fire(alert.Alert{
+					Rule:     alert.RuleFeedSilent,
+					Series:   s.SeriesSlug,
+					MarketID: s.MarketID,
+					Message:  fmt.Sprintf("no messages for %v", idle.Round(time.Second)),
+				})
+			}
+		}
+	}
+
+	if rules.MinFreeDisk > 0 {
+		free, err := alert.FreeDiskSpace(m.storage.OutputDir)
+		if err != nil {
+			m.logger.Debug("Free disk space unknown", "err", err)
+		} else if free < rules.MinFreeDisk {
+			m.alerts.Fire(alert.Alert{
+				Rule:    alert.RuleLowDiskSpace,
+				Message: fmt.Sprintf("%d MB free in %s", free>>20, m.storage.OutputDir),
+			})
+		}
+	}
 }
 
-// stopAllSessions stops all active sessions.
+// stopAllSessions stops all active sessions, after releasing m.mu.
 func (m *MarketManager) stopAllSessions() {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*MarketSession)
+	m.metrics.SetActiveSessions(0)
+	m.mu.Unlock()
 
-	for id, session := range m.sessions {
+	for _, session := range sessions {
 		session.Stop()
-		delete(m.sessions, id)
 	}
 }
 
@@ -155,21 +431,27 @@ func (m *MarketManager) printStatus() {
 	defer m.mu.RUnlock()
 
 	if len(m.sessions) == 0 {
-		log.Println("No active sessions")
+		m.logger.Info("No active sessions")
 		return
 	}
 
-	log.Printf("Active sessions: %d", len(m.sessions))
+	m.logger.Info("Active sessions", "count", len(m.sessions))
+	if m.pool != nil {
+		stats := m.pool.Stats()
+		m.logger.Info("Shared connections", "connections", stats.Connections, "assets", stats.Assets)
+	}
 	for _, session := range m.sessions {
 		remaining := time.Until(session.EndDate)
 		if remaining < 0 {
 			remaining = 0
 		}
-		log.Printf("  [%s] market=%s msgs=%d ends_in=%v",
-			session.shortSlug(),
-			session.shortMarketID(),
-			session.MessageCount(),
-			remaining.Round(time.Second))
+		stats := session.PipelineStats()
+		session.logger.Info("Session status",
+			"msgs", session.MessageCount(),
+			"queued", stats.Queued,
+			"dropped", stats.Dropped,
+			"spilled", stats.Spilled,
+			"ends_in", remaining.Round(time.Second))
 	}
 }
 
@@ -180,6 +462,89 @@ func (m *MarketManager) SessionCount() int {
 	return len(m.sessions)
 }
 
+// Ready reports whether the manager has completed its initial discovery
+// scan and is not shutting down.
+func (m *MarketManager) Ready() bool {
+	return m.ready.Load()
+}
+
+// SessionInfos describes the active sessions, ordered by series and end
+// date.
+func (m *MarketManager) SessionInfos() []SessionInfo {
+	sessions := m.GetSessions()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].SeriesSlug != infos[j].SeriesSlug {
+			return infos[i].SeriesSlug < infos[j].SeriesSlug
+		}
+		return infos[i].EndDate.Before(infos[j].EndDate)
+	})
+	return infos
+}
+
+// RequestScan makes Run scan for new markets now instead of waiting for
+// the next scan interval. It does not wait for the scan.
+func (m *MarketManager) RequestScan() {
+	select {
+	case m.scanCh <- struct{}{}:
+	default: // A scan is already pending
+	}
+}
+
+// StopSession stops a session before its market ends. Discovery does not
+// restart it.
+func (m *MarketManager) StopSession(marketID string) error {
+	m.mu.Lock()
+	session, ok := m.sessions[marketID]
+	if !ok {
+		m.mu.Unlock()
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, marketID)
+	m.stopped[marketID] = session.EndDate.Add(session.GracePeriod)
+	m.metrics.SetActiveSessions(len(m.sessions))
+	m.mu.Unlock()
+
+	session.logger.Info("Stopping session on request")
+	return session.Stop()
+}
+
+// Series returns a copy of the series configuration.
+func (m *MarketManager) Series() []config.SeriesConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]config.SeriesConfig(nil), m.config.Series...)
+}
+
+// SetSeriesEnabled enables or disables discovery for a configured series.
+// Sessions already running for a disabled series continue until their
+// market ends. Enabling a series requests a scan.
+func (m *MarketManager) SetSeriesEnabled(slug string, enabled bool) error {
+	m.mu.Lock()
+	found := false
+	for i := range m.config.Series {
+		if m.config.Series[i].Slug == slug {
+			m.config.Series[i].Enabled = enabled
+			found = true
+		}
+	}
+	m.mu.Unlock()
+
+	if !found {
+		return ErrSeriesNotFound
+	}
+	if enabled {
+		m.logger.Info("Series enabled", "series", slug)
+		m.RequestScan()
+	} else {
+		m.logger.Info("Series disabled", "series", slug)
+	}
+	return nil
+}
+
 // GetSessions returns a copy of all active sessions.
 func (m *MarketManager) GetSessions() []*MarketSession {
 	m.mu.RLock()
@@ -0,0 +1,276 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/alert"
+	"github.com/johan/polymarket-collector/internal/config"
+	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/gamma/gammatest"
+	"github.com/johan/polymarket-collector/internal/ws/wstest"
+)
+
+// alertRecorder is a notifier that keeps the alerts it receives.
+type alertRecorder struct {
+	mu     sync.Mutex
+	alerts []alert.Alert
+}
+
+func (r *alertRecorder) Notify(ctx context.Context, a alert.Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func (r *alertRecorder) get() []alert.Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]alert.Alert(nil), r.alerts...)
+}
+
+// newTestManager creates a manager for the Gamma fixtures that sends
+// alerts to the returned recorder.
+func newTestManager(t *testing.T, rules alert.Rules) (*MarketManager, *gammatest.Server, *alertRecorder) {
+	t.Helper()
+	gammaSrv := gammatest.NewFixtureServer()
+	t.Cleanup(gammaSrv.Close)
+	wsSrv := wstest.NewServer()
+	t.Cleanup(wsSrv.Close)
+
+	cfg := &config.ManagerConfig{
+		ScanInterval: time.Hour,
+		GracePeriod:  time.Minute,
+		Series:       []config.SeriesConfig{{Slug: gammatest.FixtureSeries, Enabled: true}},
+	}
+	rec := &alertRecorder{}
+	m := NewMarketManager(gammaSrv.Client(), cfg, config.StorageConfig{OutputDir: t.TempDir()}, false).
+		WithWebSocket(config.WebSocketConfig{
+			URL:            wsSrv.URL,
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			BackoffFactor:  2,
+		}).
+		WithAlerts(alert.New(rules, time.Hour, rec))
+	t.Cleanup(m.stopAllSessions)
+	return m, gammaSrv, rec
+}
+
+func TestMarketManager_DiscoveryFailureAlert(t *testing.T) {
+	m, gammaSrv, rec := newTestManager(t, alert.Rules{DiscoveryFailures: 2})
+	ctx := context.Background()
+
+	gammaSrv.FailNext("/series", http.StatusBadGateway)
+	gammaSrv.FailNext("/series", http.StatusBadGateway)
+
+	m.discoverMarkets(ctx)
+	m.alerts.Wait()
+	if n := len(rec.get()); n != 0 {
+		t.Fatalf("alerted after one failure")
+	}
+
+	m.discoverMarkets(ctx)
+	m.alerts.Wait()
+	alerts := rec.get()
+	if len(alerts) != 1 || alerts[0].Rule != alert.RuleDiscoveryFailing || alerts[0].Series != gammatest.FixtureSeries {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+
+	// A successful scan resets the count
+	m.discoverMarkets(ctx)
+	if n := m.discoveryFailures[gammatest.FixtureSeries]; n != 0 {
+		t.Errorf("failures after success = %d", n)
+	}
+	if m.SessionCount() != 1 {
+		t.Errorf("sessions = %d, want 1", m.SessionCount())
+	}
+}
+
+func TestMarketManager_SessionAlerts(t *testing.T) {
+	m, _, rec := newTestManager(t, alert.Rules{SilentAfter: time.Minute, MinSessionMessages: 10})
+
+	s := newTestSession(t, "")
+	s.startTime = time.Now().Add(-2 * time.Minute)
+	m.sessions[s.MarketID] = s
+
+	m.checkAlerts()
+	m.checkSessionEnded(s)
+	m.alerts.Wait()
+
+	rules := map[string]alert.Alert{}
+	for _, a := range rec.get() {
+		rules[a.Rule] = a
+	}
+	for _, rule := range []string{alert.RuleFeedSilent, alert.RuleLowMessageCount} {
+		a, ok := rules[rule]
+		if !ok {
+			t.Errorf("no %s alert in %+v", rule, rec.get())
+			continue
+		}
+		if a.MarketID != "1338378" || a.Series != "eth-up-or-down-15m" {
+			t.Errorf("%s alert = %+v", rule, a)
+		}
+	}
+
+	// Messages keep the feed rule quiet
+	delete(m.sessions, s.MarketID)
+	active := newTestSession(t, "")
+	active.MarketID = "1338380"
+	active.startTime = time.Now().Add(-2 * time.Minute)
+	active.lastMessage = time.Now().UnixNano()
+	m.sessions[active.MarketID] = active
+
+	before := len(rec.get())
+	m.checkAlerts()
+	m.alerts.Wait()
+	if n := len(rec.get()); n != before {
+		t.Errorf("alerted for an active feed: %+v", rec.get()[before:])
+	}
+}
+
+func TestMarketManager_DiskSpaceAlert(t *testing.T) {
+	if _, err := alert.FreeDiskSpace(t.TempDir()); err != nil {
+		t.Skipf("free disk space unsupported: %v", err)
+	}
+	m, _, rec := newTestManager(t, alert.Rules{MinFreeDisk: 1 << 62})
+
+	m.checkAlerts()
+	m.alerts.Wait()
+	alerts := rec.get()
+	if len(alerts) != 1 || alerts[0].Rule != alert.RuleLowDiskSpace {
+		t.Errorf("alerts = %+v", alerts)
+	}
+}
+
+func TestMarketManager_CleanupStopsOutsideLock(t *testing.T) {
+	m, _, _ := newTestManager(t, alert.Rules{})
+	s := newTestSession(t, "")
+	s.EndDate = time.Now().Add(-time.Hour)
+	m.sessions[s.MarketID] = s
+
+	// Hold the session's lock so Stop blocks
+	s.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		m.cleanupExpiredSessions()
+		close(done)
+	}()
+
+	counted := make(chan int)
+	go func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for m.SessionCount() != 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		counted <- m.SessionCount()
+	}()
+	select {
+	case n := <-counted:
+		if n != 0 {
+			t.Errorf("sessions = %d, want 0", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("status read blocked while a session was stopping")
+	}
+
+	s.mu.Unlock()
+	<-done
+}
+
+func TestMarketManager_PrestartsUpcomingWindow(t *testing.T) {
+	m, _, _ := newTestManager(t, alert.Rules{})
+	m.config.PrestartLead = config.DefaultConfig().Manager.PrestartLead
+	t.Cleanup(m.stopScheduled)
+	ctx := context.Background()
+
+	// Just before the 08:15 window's session is due, with the 08:30 window
+	// ahead. Gamma and the manager share the clock.
+	lead := m.config.PrestartLead
+	clock := func() time.Time {
+		return time.Date(2026, 2, 6, 8, 15, 0, 0, time.UTC).Add(-lead - 50*time.Millisecond)
+	}
+	m.now = clock
+	m.gamma.WithClock(clock)
+
+	m.discoverMarkets(ctx)
+	if n := m.SessionCount(); n != 1 {
+		t.Fatalf("sessions after discovery = %d, want 1", n)
+	}
+	if m.hasSession("1338381") {
+		t.Fatal("discovery started the 08:15 window before its lead")
+	}
+	if len(m.scheduled) != 2 {
+		t.Fatalf("scheduled = %+v, want the 08:15 and 08:30 windows", m.scheduled)
+	}
+	if m.scheduled["eth-updown-15m-1770366600"].timer == nil {
+		t.Fatal("08:15 window has no pre-start timer")
+	}
+	if start := m.scheduled["eth-updown-15m-1770367500"].start; !start.Equal(time.Date(2026, 2, 6, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("08:30 window starts at %v", start)
+	}
+
+	var p prestart
+	select {
+	case p = <-m.prestartCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("window was not pre-started")
+	}
+	if p.event != "eth-updown-15m-1770366600" || len(p.markets) != 1 || p.markets[0].ID != "1338381" {
+		t.Fatalf("prestart = %+v", p)
+	}
+	m.startPrestart(ctx, p)
+	if !m.hasSession("1338381") {
+		t.Error("pre-started session not running")
+	}
+
+	// A later scan does not schedule the windows again
+	timer := m.scheduled["eth-updown-15m-1770367500"].timer
+	m.discoverMarkets(ctx)
+	if m.scheduled["eth-updown-15m-1770367500"].timer != timer {
+		t.Error("08:30 window scheduled twice")
+	}
+	if n := m.SessionCount(); n != 2 {
+		t.Errorf("sessions = %d, want 2", n)
+	}
+}
+
+func TestMarketManager_ShortLeadKeepsEarlyStart(t *testing.T) {
+	m, _, _ := newTestManager(t, alert.Rules{})
+	m.config.PrestartLead = 30 * time.Second
+	t.Cleanup(m.stopScheduled)
+	ctx := context.Background()
+
+	// Three minutes before the 08:15 window, inside Gamma's early start
+	clock := func() time.Time { return time.Date(2026, 2, 6, 8, 12, 0, 0, time.UTC) }
+	m.now = clock
+	m.gamma.WithClock(clock)
+
+	m.discoverMarkets(ctx)
+	if !m.hasSession("1338381") {
+		t.Fatal("window starting in 3m was not started")
+	}
+	sw, ok := m.scheduled["eth-updown-15m-1770366600"]
+	if !ok || sw.timer != nil {
+		t.Errorf("08:15 window = %+v, want recorded as started by discovery", sw)
+	}
+}
+
+func TestMarketManager_PrestartSkipsDisabledSeries(t *testing.T) {
+	m, _, _ := newTestManager(t, alert.Rules{})
+	ctx := context.Background()
+
+	p := prestart{
+		series:  gammatest.FixtureSeries,
+		event:   "eth-updown-15m-1770366600",
+		markets: []gamma.Market{{ID: "1338381", ClobTokenIds: `["5001","5002"]`, EndDate: time.Now().Add(time.Hour)}},
+	}
+	m.SetSeriesEnabled(gammatest.FixtureSeries, false)
+	m.startPrestart(ctx, p)
+	if n := m.SessionCount(); n != 0 {
+		t.Errorf("pre-started a disabled series: %d sessions", n)
+	}
+}
@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+)
+
+const (
+	// partialSuffix marks a session file that is still being written.
+	partialSuffix = ".partial"
+
+	// corruptSuffix marks a partial file that could not be repaired.
+	corruptSuffix = ".corrupt"
+)
+
+// RecoveredFile describes a partial file found by RecoverPartialFiles.
+type RecoveredFile struct {
+	Partial      string // The .partial file found
+	Path         string // Where the repaired or flagged file is now
+	Records      int    // Complete records kept
+	DroppedBytes int64  // Bytes of the incomplete tail that were discarded
+	Err          error  // Set if the file could not be repaired and was flagged .corrupt
+}
+
+// RecoverPartialFiles repairs the .partial files that sessions left in
+// outputDir when the process died. Complete records are kept, a recovered
+// record is appended and the file is moved to its final name. Files
+// without a single complete record are renamed to .corrupt. It must run
+// before any session starts.
+func RecoverPartialFiles(outputDir string) ([]RecoveredFile, error) {
+	var results []RecoveredFile
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == outputDir {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, partialSuffix) {
+			return nil
+		}
+		results = append(results, recoverFile(path))
+		return nil
+	})
+	if err != nil {
+		return results, fmt.Errorf("scanning %s: %w", outputDir, err)
+	}
+	return results, nil
+}
+
+// recoverFile repairs a single partial file.
+func recoverFile(partial string) RecoveredFile {
+	result := RecoveredFile{Partial: partial}
+	final := strings.TrimSuffix(partial, partialSuffix)
+	if exists(final) {
+		final = availablePath(final)
+	}
+	tmp := final + ".recovering"
+
+	records, dropped, err := copyCompleteRecords(partial, tmp)
+	result.Records, result.DroppedBytes = records, dropped
+	if err == nil && records == 0 {
+		err = fmt.Errorf("no complete records")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		result.Err = err
+		result.Path = partial + corruptSuffix
+		if renameErr := os.Rename(partial, result.Path); renameErr != nil {
+			result.Path = partial
+		}
+		return result
+	}
+
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		result.Err = fmt.Errorf("renaming repaired file: %w", err)
+		result.Path = partial
+		return result
+	}
+	os.Remove(partial)
+	result.Path = final
+	return result
+}
+
+// copyCompleteRecords copies every complete line of src to dst, followed
+// by a recording.RecoveryRecord. Both are gzip compressed if src ends in .gz.
+// Reading stops at the first error, which is what a truncated or
+// half-written gzip member produces.
+func copyCompleteRecords(src, dst string) (records int, dropped int64, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening partial file: %w", err)
+	}
+	defer in.Close()
+
+	compressed := strings.HasSuffix(strings.TrimSuffix(src, partialSuffix), ".gz")
+	var r io.Reader = in
+	if compressed {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return 0, 0, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, 0, fmt.Errorf("creating repaired file: %w", err)
+	}
+	defer out.Close()
+
+	var gzOut *gzip.Writer
+	var w *bufio.Writer
+	if compressed {
+		gzOut = gzip.NewWriter(out)
+		w = bufio.NewWriter(gzOut)
+	} else {
+		w = bufio.NewWriter(out)
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if readErr != nil {
+			// Whatever follows the last newline is an incomplete record
+			dropped = int64(len(line))
+			break
+		}
+		if _, err := w.Write(line); err != nil {
+			return records, 0, fmt.Errorf("writing repaired file: %w", err)
+		}
+		records++
+	}
+
+	if records > 0 {
+		data, _ := json.Marshal(recording.RecoveryRecord{
+			Type:         recording.TypeRecovered,
+			RecoveredAt:  time.Now().UTC(),
+			DroppedBytes: dropped,
+		})
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return records, dropped, fmt.Errorf("writing repaired file: %w", err)
+	}
+	if gzOut != nil {
+		if err := gzOut.Close(); err != nil {
+			return records, dropped, fmt.Errorf("writing repaired file: %w", err)
+		}
+	}
+	return records, dropped, out.Sync()
+}
+
+// availablePath returns path, or path with a _2, _3, ... suffix before the
+// extension if a file or partial file with that name already exists.
+func availablePath(path string) string {
+	base, ext := path, ""
+	if i := strings.Index(filepath.Base(path), ".jsonl"); i >= 0 {
+		cut := len(path) - len(filepath.Base(path)) + i
+		base, ext = path[:cut], path[cut:]
+	}
+
+	candidate := path
+	for n := 2; exists(candidate) || exists(candidate+partialSuffix); n++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+	return candidate
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
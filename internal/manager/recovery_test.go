@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+)
+
+// gzipMember returns data as a complete gzip member.
+func gzipMember(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readLines returns the lines of a possibly gzipped file.
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("gzip.NewReader failed: %v", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			t.Fatalf("reading gzip stream: %v", err)
+		}
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestRecoverPartialFiles_Gzip(t *testing.T) {
+	dir := t.TempDir()
+	seriesDir := filepath.Join(dir, "eth-15m")
+	os.MkdirAll(seriesDir, 0755)
+
+	// Two flushed members, then a member cut off mid-write
+	var data []byte
+	data = append(data, gzipMember(t, "{\"type\":\"metadata\"}\n{\"event_type\":\"book\"}\n")...)
+	data = append(data, gzipMember(t, "{\"event_type\":\"price_change\"}\n")...)
+	last := gzipMember(t, "{\"event_type\":\"book\"}\n{\"event_type\":\"pri")
+	data = append(data, last[:len(last)-10]...)
+	partial := filepath.Join(seriesDir, "2026-02-06_1770365700.jsonl.gz.partial")
+	if err := os.WriteFile(partial, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RecoverPartialFiles(dir)
+	if err != nil {
+		t.Fatalf("RecoverPartialFiles failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("results = %+v", results)
+	}
+	r := results[0]
+	if r.Path != strings.TrimSuffix(partial, partialSuffix) || r.Records < 3 {
+		t.Errorf("result = %+v", r)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Error("Partial file was not removed")
+	}
+
+	lines := readLines(t, r.Path)
+	var rec recording.RecoveryRecord
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &rec); err != nil || rec.Type != recording.TypeRecovered {
+		t.Errorf("last line = %s, want recovered record", lines[len(lines)-1])
+	}
+	if lines[0] != `{"type":"metadata"}` || len(lines) != r.Records+1 {
+		t.Errorf("lines = %v", lines)
+	}
+}
+
+func TestRecoverPartialFiles_Plain(t *testing.T) {
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "2026-02-06_1770365700.jsonl.partial")
+	os.WriteFile(partial, []byte("{\"type\":\"metadata\"}\n{\"event_type\":\"bo"), 0644)
+
+	// An earlier file with the same name is kept
+	existing := filepath.Join(dir, "2026-02-06_1770365700.jsonl")
+	os.WriteFile(existing, []byte("{}\n"), 0644)
+
+	results, err := RecoverPartialFiles(dir)
+	if err != nil {
+		t.Fatalf("RecoverPartialFiles failed: %v", err)
+	}
+	r := results[0]
+	if want := filepath.Join(dir, "2026-02-06_1770365700_2.jsonl"); r.Path != want {
+		t.Errorf("Path = %s, want %s", r.Path, want)
+	}
+	if r.Records != 1 || r.DroppedBytes != int64(len(`{"event_type":"bo`)) {
+		t.Errorf("result = %+v", r)
+	}
+	if lines := readLines(t, r.Path); len(lines) != 2 {
+		t.Errorf("lines = %v", lines)
+	}
+	if lines := readLines(t, existing); len(lines) != 1 {
+		t.Errorf("existing file changed: %v", lines)
+	}
+}
+
+func TestRecoverPartialFiles_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "a.jsonl.gz.partial")
+	os.WriteFile(empty, nil, 0644)
+	noNewline := filepath.Join(dir, "b.jsonl.partial")
+	os.WriteFile(noNewline, []byte(`{"type":"meta`), 0644)
+
+	results, err := RecoverPartialFiles(dir)
+	if err != nil {
+		t.Fatalf("RecoverPartialFiles failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, r := range results {
+		if r.Err == nil || r.Path != r.Partial+corruptSuffix {
+			t.Errorf("result = %+v, want flagged as corrupt", r)
+		}
+		if _, err := os.Stat(r.Path); err != nil {
+			t.Errorf("flagged file missing: %v", err)
+		}
+	}
+
+	// Flagged files are not picked up again
+	if results, _ := RecoverPartialFiles(dir); len(results) != 0 {
+		t.Errorf("second pass = %+v", results)
+	}
+}
+
+func TestRecoverPartialFiles_MissingDir(t *testing.T) {
+	results, err := RecoverPartialFiles(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(results) != 0 {
+		t.Errorf("RecoverPartialFiles = %v, %v", results, err)
+	}
+}
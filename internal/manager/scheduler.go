@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/gamma"
+)
+
+// prestart is an upcoming window whose markets were fetched in advance.
+// Run opens their sessions when it receives the prestart.
+type prestart struct {
+	series  string
+	event   string
+	markets []gamma.Market
+}
+
+// scheduledWindow is a window handled by the scheduler.
+type scheduledWindow struct {
+	start time.Time
+	timer *time.Timer // nil if discovery already started its sessions
+}
+
+// scheduleWindows prefetches the markets of a series' upcoming windows and
+// sets a timer to open their sessions sessionLead before trading starts.
+// Discovery alone only finds a market at the next scan, so the first
+// moments of a window could otherwise be missed.
+//
+// Windows whose session would open before the scan after next are
+// scheduled; later ones are left to that scan. Windows already within the
+// lead were started by discovery, which uses the same lead. It runs on
+// Run's goroutine.
+func (m *MarketManager) scheduleWindows(ctx context.Context, seriesSlug string) {
+	if m.config.PrestartLead <= 0 {
+		return
+	}
+	lead := m.sessionLead()
+
+	windows, err := m.gamma.FetchSeriesWindows(ctx, seriesSlug)
+	if err != nil {
+		m.logger.Warn("Error fetching upcoming windows", "series", seriesSlug, "err", err)
+		return
+	}
+
+	now := m.now()
+	for slug, sw := range m.scheduled {
+		if sw.start.Before(now) {
+			delete(m.scheduled, slug)
+		}
+	}
+
+	horizon := now.Add(2 * m.config.ScanInterval)
+	for _, w := range windows {
+		if _, ok := m.scheduled[w.Event.Slug]; ok {
+			continue
+		}
+		// Started windows are found by discovery
+		if !w.Start.After(now) || !w.Start.Add(-lead).Before(horizon) {
+			continue
+		}
+
+		// The series lists events without markets or, usually, startTime
+		events, err := m.gamma.FetchEvents(ctx, &gamma.Filter{Slug: w.Event.Slug})
+		if err != nil || len(events) == 0 {
+			m.logger.Warn("Error prefetching upcoming window",
+				"series", seriesSlug, "event", w.Event.Slug, "err", err)
+			continue
+		}
+		event := events[0]
+		if !event.StartTime.IsZero() {
+			w.Start = event.StartTime
+		}
+
+		p := prestart{series: seriesSlug, event: event.Slug}
+		pending := 0
+		for _, market := range event.Markets {
+			if tokenIDs, err := market.ParseTokenIDs(); err != nil || len(tokenIDs) == 0 || market.Closed {
+				continue
+			}
+			p.markets = append(p.markets, market)
+			if !m.hasSession(market.ID) {
+				pending++
+			}
+		}
+		if len(p.markets) == 0 {
+			// Token IDs may not be assigned yet; retry at the next scan
+			continue
+		}
+		if pending == 0 {
+			m.scheduled[event.Slug] = scheduledWindow{start: w.Start}
+			continue
+		}
+
+		delay := w.Start.Add(-lead).Sub(now)
+		m.scheduled[event.Slug] = scheduledWindow{
+			start: w.Start,
+			timer: time.AfterFunc(delay, func() {
+				select {
+				case m.prestartCh <- p:
+				case <-ctx.Done():
+				}
+			}),
+		}
+		m.logger.Info("Scheduled session pre-start",
+			"series", seriesSlug, "event", event.Slug,
+			"trading_starts", w.Start.Format(time.RFC3339), "opens_in", delay.Round(time.Second))
+	}
+}
+
+// startPrestart opens the sessions of a scheduled window, unless discovery
+// already started them, they were stopped by hand or the series has been
+// disabled since.
+func (m *MarketManager) startPrestart(ctx context.Context, p prestart) {
+	if !m.seriesEnabled(p.series) {
+		return
+	}
+	m.logger.Debug("Pre-starting window", "series", p.series, "event", p.event)
+	for _, market := range p.markets {
+		if m.hasSession(market.ID) {
+			continue
+		}
+
+		if err := m.startSession(ctx, market, p.series); err != nil {
+			m.logger.Error("Error pre-starting session",
+				"series", p.series, "market_id", market.ID, "err", err)
+		}
+	}
+}
+
+// stopScheduled cancels the pending pre-starts.
+func (m *MarketManager) stopScheduled() {
+	for slug, sw := range m.scheduled {
+		if sw.timer != nil {
+			sw.timer.Stop()
+		}
+		delete(m.scheduled, slug)
+	}
+}
+
+// seriesEnabled reports whether discovery is enabled for a series.
+func (m *MarketManager) seriesEnabled(slug string) bool {
+	for _, s := range m.Series() {
+		if s.Slug == slug {
+			return s.Enabled
+		}
+	}
+	return false
+}
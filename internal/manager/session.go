@@ -6,14 +6,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/johan/polymarket-collector/internal/config"
 	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/metrics"
+	"github.com/johan/polymarket-collector/internal/orderbook"
+	"github.com/johan/polymarket-collector/internal/pipeline"
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/verifier"
 	"github.com/johan/polymarket-collector/internal/ws"
 )
 
@@ -27,16 +33,38 @@ type MarketSession struct {
 	EndDate     time.Time
 	GracePeriod time.Duration
 
-	// Output
-	outputDir  string
-	file       *os.File
-	gzWriter   *gzip.Writer
-	bufWriter  *bufio.Writer
-	filePath   string
-	useGzip    bool
+	// Output. The file is written as filePath + ".partial" and renamed
+	// once the session stops.
+	outputDir     string
+	file          *os.File
+	gzWriter      *gzip.Writer
+	bufWriter     *bufio.Writer
+	filePath      string
+	useGzip       bool
+	rawMode       bool          // Write raw frames instead of parsed messages
+	flushInterval time.Duration // 0 = flush only on Stop
+	dirty         bool          // Records written since the last flush
 
-	// WebSocket
-	wsClient *ws.Client
+	// Queue between the WebSocket reader and the file writer
+	pipelineCfg pipeline.Config
+	pipeline    *pipeline.Pipeline
+
+	// WebSocket: a dedicated client, or a share of a pooled connection
+	feed     feed
+	wsConfig *config.WebSocketConfig // nil = client defaults
+	pool     *ws.Pool                // nil = dedicated connection
+
+	// Live order books reconstructed from the feed
+	books *orderbook.Store
+
+	// Optional REST cross-check of the live books
+	verifier *verifier.RESTVerifier
+
+	// Optional Prometheus metrics
+	metrics *metrics.Metrics
+
+	// Records carry the series and market_id
+	logger *slog.Logger
 
 	// State
 	ctx          context.Context
@@ -45,18 +73,28 @@ type MarketSession struct {
 	started      bool
 	stopped      bool
 	messageCount int64
+	lastMessage  int64 // UnixNano of the latest message
 	startTime    time.Time
 }
 
-// SessionMetadata is written at the start of each data file.
-type SessionMetadata struct {
-	Type        string    `json:"type"`
-	SeriesSlug  string    `json:"series_slug"`
-	MarketID    string    `json:"market_id"`
-	ConditionID string    `json:"condition_id"`
-	TokenIDs    []string  `json:"token_ids"`
-	EndDate     time.Time `json:"end_date"`
-	StartTime   time.Time `json:"start_time"`
+// feed is the session's WebSocket subscription.
+type feed interface {
+	Subscribe(tokenIDs []string) error
+	State() ws.State
+	Close() error
+}
+
+// SessionInfo describes an active session.
+type SessionInfo struct {
+	SeriesSlug   string    `json:"series_slug"`
+	MarketID     string    `json:"market_id"`
+	ConditionID  string    `json:"condition_id"`
+	TokenIDs     []string  `json:"token_ids"`
+	MessageCount int64     `json:"message_count"`
+	StartTime    time.Time `json:"start_time"`
+	EndDate      time.Time `json:"end_date"`
+	FilePath     string    `json:"file_path"`
+	State        string    `json:"state"` // WebSocket connection state
 }
 
 // NewMarketSession creates a new session for collecting market data.
@@ -70,7 +108,7 @@ func NewMarketSession(market gamma.Market, seriesSlug, outputDir string, gracePe
 		return nil, fmt.Errorf("no token IDs found for market %s", market.ID)
 	}
 
-	return &MarketSession{
+	s := &MarketSession{
 		SeriesSlug:  seriesSlug,
 		MarketID:    market.ID,
 		ConditionID: market.ConditionID,
@@ -79,7 +117,15 @@ func NewMarketSession(market gamma.Market, seriesSlug, outputDir string, gracePe
 		GracePeriod: gracePeriod,
 		outputDir:   outputDir,
 		useGzip:     useGzip,
-	}, nil
+		books:       orderbook.NewStore(),
+	}
+	s.setLogger(slog.Default())
+	return s, nil
+}
+
+// setLogger derives the session's logger from base.
+func (s *MarketSession) setLogger(base *slog.Logger) {
+	s.logger = base.With("series", s.SeriesSlug, "market_id", s.MarketID)
 }
 
 // Start begins collecting data for this market.
@@ -101,7 +147,8 @@ func (s *MarketSession) Start(parentCtx context.Context) error {
 		return fmt.Errorf("creating series directory: %w", err)
 	}
 
-	// Create output file named by date and end timestamp
+	// Create output file named by date and end timestamp. A restarted
+	// session gets a new file instead of overwriting the earlier one.
 	var filename string
 	if s.useGzip {
 		filename = fmt.Sprintf("%s_%d.jsonl.gz",
@@ -112,9 +159,9 @@ func (s *MarketSession) Start(parentCtx context.Context) error {
 			s.EndDate.Format("2006-01-02"),
 			s.EndDate.Unix())
 	}
-	s.filePath = filepath.Join(seriesDir, filename)
+	s.filePath = availablePath(filepath.Join(seriesDir, filename))
 
-	f, err := os.Create(s.filePath)
+	f, err := os.Create(s.filePath + partialSuffix)
 	if err != nil {
 		return fmt.Errorf("creating output file: %w", err)
 	}
@@ -129,37 +176,47 @@ func (s *MarketSession) Start(parentCtx context.Context) error {
 	}
 
 	// Write metadata as first line
-	meta := SessionMetadata{
-		Type:        "metadata",
+	meta := recording.SessionMetadata{
+		Type:        recording.TypeMetadata,
 		SeriesSlug:  s.SeriesSlug,
 		MarketID:    s.MarketID,
 		ConditionID: s.ConditionID,
 		TokenIDs:    s.TokenIDs,
 		EndDate:     s.EndDate,
 		StartTime:   s.startTime,
+		Raw:         s.rawMode,
 	}
 	metaData, _ := json.Marshal(meta)
 	s.bufWriter.Write(metaData)
 	s.bufWriter.WriteString("\n")
+	s.dirty = true
 
-	// Create WebSocket client
-	s.wsClient = ws.NewWSClient(s.handleMessages)
-
-	// Connect
-	if err := s.wsClient.Connect(s.ctx); err != nil {
+	// Records are written by the pipeline's goroutine, so slow disk I/O
+	// never stalls the WebSocket read loop.
+	s.pipeline, err = pipeline.New(s.pipelineCfg, s.writeBatch)
+	if err != nil {
 		s.file.Close()
-		return fmt.Errorf("connecting WebSocket: %w", err)
+		return fmt.Errorf("creating write pipeline: %w", err)
 	}
 
-	// Subscribe to tokens
-	if err := s.wsClient.Subscribe(s.TokenIDs); err != nil {
-		s.wsClient.Close()
+	if err := s.connectFeed(); err != nil {
+		s.pipeline.Close()
 		s.file.Close()
-		return fmt.Errorf("subscribing to tokens: %w", err)
+		return err
+	}
+
+	s.metrics.TrackTokens(s.SeriesSlug, s.TokenIDs)
+
+	if s.flushInterval > 0 {
+		go s.flushLoop(s.ctx)
+	}
+
+	// Periodically cross-check the live books against REST snapshots
+	if s.verifier != nil {
+		go s.verifier.Run(s.ctx, s.books, s.TokenIDs, s.handleDrift)
 	}
 
-	log.Printf("[%s] Session started for market %s, ends at %s",
-		s.shortSlug(), s.shortMarketID(), s.EndDate.Format("15:04:05"))
+	s.logger.Info("Session started", "ends_at", s.EndDate.Format(time.RFC3339), "file", s.filePath)
 
 	return nil
 }
@@ -178,11 +235,17 @@ func (s *MarketSession) Stop() error {
 		s.cancel()
 	}
 
-	if s.wsClient != nil {
-		s.wsClient.Close()
+	if s.feed != nil {
+		s.feed.Close()
+	}
+	s.metrics.UntrackTokens(s.TokenIDs)
+
+	// Write whatever is still queued
+	if s.pipeline != nil {
+		s.pipeline.Close()
 	}
 
-	// Close writers in correct order
+	// Close writers in correct order, then move the complete file into place
 	s.mu.Lock()
 	if s.bufWriter != nil {
 		s.bufWriter.Flush()
@@ -190,14 +253,23 @@ func (s *MarketSession) Stop() error {
 	if s.gzWriter != nil {
 		s.gzWriter.Close()
 	}
+	s.bufWriter = nil
+	s.gzWriter = nil
 	if s.file != nil {
-		s.file.Close()
+		if err := s.file.Close(); err != nil {
+			s.logger.Error("Error closing output file", "err", err)
+		} else if err := os.Rename(s.file.Name(), s.filePath); err != nil {
+			s.logger.Error("Error renaming output file", "err", err)
+		}
 	}
 	s.mu.Unlock()
 
 	count := atomic.LoadInt64(&s.messageCount)
-	log.Printf("[%s] Session stopped for market %s, collected %d messages",
-		s.shortSlug(), s.shortMarketID(), count)
+	s.logger.Info("Session stopped", "msgs", count)
+	if stats := s.PipelineStats(); stats.Dropped > 0 || stats.Spilled > 0 || stats.WriteErrors > 0 {
+		s.logger.Warn("Write pipeline lost or delayed records",
+			"dropped", stats.Dropped, "spilled", stats.Spilled, "write_errors", stats.WriteErrors)
+	}
 
 	return nil
 }
@@ -212,37 +284,281 @@ func (s *MarketSession) MessageCount() int64 {
 	return atomic.LoadInt64(&s.messageCount)
 }
 
-// FilePath returns the path to the output file.
-func (s *MarketSession) FilePath() string {
-	return s.filePath
+// LastActivity returns when the session last received a message, or when
+// it started if it has received none.
+func (s *MarketSession) LastActivity() time.Time {
+	if ns := atomic.LoadInt64(&s.lastMessage); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startTime
 }
 
-// handleMessages processes incoming WebSocket messages.
-func (s *MarketSession) handleMessages(messages []ws.WSMessage) {
+// Info returns a snapshot of the session's state.
+func (s *MarketSession) Info() SessionInfo {
 	s.mu.Lock()
-	writer := s.bufWriter
-	stopped := s.stopped
+	startTime := s.startTime
 	s.mu.Unlock()
 
-	if writer == nil || stopped {
-		return
+	state := ws.StateDisconnected
+	if s.feed != nil {
+		state = s.feed.State()
+	}
+	return SessionInfo{
+		SeriesSlug:   s.SeriesSlug,
+		MarketID:     s.MarketID,
+		ConditionID:  s.ConditionID,
+		TokenIDs:     s.TokenIDs,
+		MessageCount: s.MessageCount(),
+		StartTime:    startTime,
+		EndDate:      s.EndDate,
+		FilePath:     s.filePath,
+		State:        state.String(),
 	}
+}
+
+// FilePath returns the path to the output file. Until the session stops,
+// data is written to this path plus ".partial".
+func (s *MarketSession) FilePath() string {
+	return s.filePath
+}
+
+// PipelineStats returns the counters of the session's write pipeline.
+func (s *MarketSession) PipelineStats() pipeline.Stats {
+	if s.pipeline == nil {
+		return pipeline.Stats{}
+	}
+	return s.pipeline.Stats()
+}
+
+// OrderBooks returns the live order books for this session's tokens.
+func (s *MarketSession) OrderBooks() *orderbook.Store {
+	return s.books
+}
+
+// connectFeed subscribes to the session's tokens, through the pool if one
+// is set. In raw mode frames are written as received; they are only parsed
+// if the order books are needed for verification or metrics are enabled.
+func (s *MarketSession) connectFeed() error {
+	var handler ws.MessageHandler
+	var rawHandler ws.RawHandler
+	if s.rawMode {
+		if s.verifier != nil || s.metrics != nil {
+			handler = s.observeMessages
+		}
+		rawHandler = s.handleRawFrame
+	} else {
+		handler = s.handleMessages
+	}
+
+	if s.pool != nil {
+		sub, err := s.pool.Subscribe(s.MarketID, s.TokenIDs, ws.PoolSubscriber{
+			Handler:      handler,
+			RawHandler:   rawHandler,
+			OnDisconnect: s.handleDisconnect,
+			OnReconnect:  s.handleReconnect,
+			OnParseError: s.handleParseError,
+		})
+		if err != nil {
+			return fmt.Errorf("subscribing through pool: %w", err)
+		}
+		s.feed = sub
+		return nil
+	}
+
+	client := ws.NewWSClient(handler).
+		WithLogger(s.logger).
+		OnDisconnect(s.handleDisconnect).
+		OnReconnect(s.handleReconnect).
+		OnParseError(s.handleParseError)
+	if rawHandler != nil {
+		client.WithRawHandler(rawHandler)
+	}
+	if cfg := s.wsConfig; cfg != nil {
+		if cfg.URL != "" {
+			client.WithURL(cfg.URL)
+		}
+		if cfg.InitialBackoff > 0 {
+			client.WithReconnectConfig(reconnectConfig(*cfg))
+		}
+		client.WithHeartbeat(heartbeatConfig(*cfg))
+	}
+
+	if err := client.Connect(s.ctx); err != nil {
+		return fmt.Errorf("connecting WebSocket: %w", err)
+	}
+	if err := client.Subscribe(s.TokenIDs); err != nil {
+		client.Close()
+		return fmt.Errorf("subscribing to tokens: %w", err)
+	}
+	s.feed = client
+	return nil
+}
+
+// handleMessages processes incoming WebSocket messages.
+func (s *MarketSession) handleMessages(messages []ws.WSMessage) {
+	s.updateBooks(messages)
+	s.metrics.ObserveMessages(s.SeriesSlug, messages)
 
 	for _, msg := range messages {
 		data, err := json.Marshal(msg)
 		if err != nil {
-			log.Printf("[%s] Error marshaling message: %v", s.shortSlug(), err)
+			s.logger.Error("Error marshaling message", "asset_id", msg.AssetID, "err", err)
 			continue
 		}
 
-		s.mu.Lock()
-		if s.bufWriter != nil && !s.stopped {
-			s.bufWriter.Write(data)
-			s.bufWriter.WriteString("\n")
+		s.pipeline.Push(data)
+		atomic.AddInt64(&s.messageCount, 1)
+	}
+	atomic.StoreInt64(&s.lastMessage, time.Now().UnixNano())
+}
+
+// handleRawFrame writes a raw WebSocket frame unchanged.
+func (s *MarketSession) handleRawFrame(frame ws.RawFrame) {
+	data, err := frame.MarshalJSON()
+	if err != nil {
+		s.logger.Error("Error marshaling frame", "err", err)
+		return
+	}
+
+	s.pipeline.Push(data)
+	atomic.AddInt64(&s.messageCount, 1)
+	atomic.StoreInt64(&s.lastMessage, frame.ReceivedAt.UnixNano())
+}
+
+// observeMessages handles the parsed messages of raw frames, which are
+// written separately.
+func (s *MarketSession) observeMessages(messages []ws.WSMessage) {
+	if s.verifier != nil {
+		s.updateBooks(messages)
+	}
+	s.metrics.ObserveMessages(s.SeriesSlug, messages)
+}
+
+// handleParseError counts frames that cannot be parsed. In raw mode they
+// are still written.
+func (s *MarketSession) handleParseError(frame ws.RawFrame, err error) {
+	s.metrics.ObserveParseError(s.SeriesSlug)
+}
+
+// updateBooks applies incoming messages to the live order books.
+func (s *MarketSession) updateBooks(messages []ws.WSMessage) {
+	if err := s.books.Apply(messages); err != nil {
+		s.logger.Warn("Error updating order book", "err", err)
+	}
+}
+
+// writeBatch appends JSONL records to the output file.
+// It is called from the pipeline's writer goroutine.
+func (s *MarketSession) writeBatch(records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bufWriter == nil {
+		return fmt.Errorf("output file is closed")
+	}
+	start := time.Now()
+	n := 0
+	for _, data := range records {
+		s.bufWriter.Write(data)
+		if err := s.bufWriter.WriteByte('\n'); err != nil {
+			return fmt.Errorf("writing record: %w", err)
 		}
-		s.mu.Unlock()
+		n += len(data) + 1
+	}
+	s.dirty = true
+	s.metrics.ObserveWrite(s.SeriesSlug, n, time.Since(start))
+	return nil
+}
 
-		atomic.AddInt64(&s.messageCount, 1)
+// flushLoop flushes the output file every flushInterval, so a crash loses
+// at most that much data.
+func (s *MarketSession) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				s.logger.Error("Error flushing output file", "err", err)
+			}
+		}
+	}
+}
+
+// flush writes buffered records to the file. With gzip, the current member
+// is finished and a new one started, so the file is a valid multi-member
+// gzip stream up to this point even if the process dies later.
+func (s *MarketSession) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bufWriter == nil || !s.dirty {
+		return nil
+	}
+	if err := s.bufWriter.Flush(); err != nil {
+		return err
+	}
+	if s.gzWriter != nil {
+		if err := s.gzWriter.Close(); err != nil {
+			return err
+		}
+		s.gzWriter.Reset(s.file)
+	}
+	s.dirty = false
+	return nil
+}
+
+// handleDisconnect invalidates the live order books when the feed drops.
+// They are reseeded by the snapshots sent after resubscribing.
+func (s *MarketSession) handleDisconnect(at time.Time, reason ws.DisconnectReason, err error) {
+	s.logger.Warn("Feed lost, order books invalidated", "reason", reason)
+	s.metrics.ObserveReconnect(s.SeriesSlug, reason)
+	for _, assetID := range s.books.AssetIDs() {
+		if book := s.books.Book(assetID); book != nil {
+			book.Reset()
+		}
+	}
+}
+
+// handleReconnect writes a gap record covering the outage.
+func (s *MarketSession) handleReconnect(gap ws.Gap) {
+	data, err := json.Marshal(recording.GapRecord{
+		Type:   recording.TypeGap,
+		Start:  gap.Start,
+		End:    gap.End,
+		Reason: string(gap.Reason),
+	})
+	if err != nil {
+		s.logger.Error("Error marshaling gap record", "err", err)
+		return
+	}
+	s.pipeline.Push(data)
+}
+
+// handleDrift records a drift event and forces a resync of the affected book.
+// Resubscribing makes the server send a fresh book snapshot, which reseeds it.
+func (s *MarketSession) handleDrift(drift verifier.Drift) {
+	data, err := json.Marshal(drift)
+	if err != nil {
+		s.logger.Error("Error marshaling drift event", "asset_id", drift.AssetID, "err", err)
+		return
+	}
+
+	s.logger.Warn("Order book drift detected", "asset_id", drift.AssetID, "drift", string(data))
+
+	s.pipeline.Push(data)
+
+	if book := s.books.Book(drift.AssetID); book != nil {
+		book.Reset()
+	}
+
+	if err := s.feed.Subscribe(s.TokenIDs); err != nil {
+		s.logger.Error("Error resubscribing after drift", "asset_id", drift.AssetID, "err", err)
 	}
 }
 
@@ -261,11 +577,3 @@ func (s *MarketSession) shortSlug() string {
 	}
 	return slug
 }
-
-// shortMarketID returns a shortened version of the market ID for logging.
-func (s *MarketSession) shortMarketID() string {
-	if len(s.MarketID) > 8 {
-		return s.MarketID[:8]
-	}
-	return s.MarketID
-}
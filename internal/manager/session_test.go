@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/johan/polymarket-collector/internal/config"
+	"github.com/johan/polymarket-collector/internal/gamma"
+	"github.com/johan/polymarket-collector/internal/metrics"
+	"github.com/johan/polymarket-collector/internal/ws/wstest"
+)
+
+func newTestSession(t *testing.T, url string) *MarketSession {
+	t.Helper()
+	market := gamma.Market{
+		ID:           "1338378",
+		ConditionID:  "0xcondition",
+		ClobTokenIds: `["up","down"]`,
+		EndDate:      time.Now().Add(time.Hour),
+	}
+	s, err := NewMarketSession(market, "eth-up-or-down-15m", t.TempDir(), time.Minute, false)
+	if err != nil {
+		t.Fatalf("NewMarketSession failed: %v", err)
+	}
+	s.wsConfig = &config.WebSocketConfig{
+		URL:            url,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		BackoffFactor:  2,
+	}
+	return s
+}
+
+// recordTypes returns the type or event_type of each line in a JSONL file.
+func recordTypes(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	var types []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec struct {
+			Type      string `json:"type"`
+			EventType string `json:"event_type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid record %q: %v", scanner.Text(), err)
+		}
+		if rec.Type != "" {
+			types = append(types, rec.Type)
+		} else {
+			types = append(types, rec.EventType)
+		}
+	}
+	return types
+}
+
+func TestMarketSession_RecordsFeedAndGaps(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	s := newTestSession(t, srv.URL)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// Two snapshots on subscribe, then a scripted update
+	if err := srv.WaitFor(time.Second, func() bool { return s.MessageCount() == 2 }); err != nil {
+		t.Fatalf("snapshots: %v", err)
+	}
+	srv.Play(wstest.Send(wstest.PriceChange("0xcondition", wstest.Change("up", "BUY", "0.5", "100"))))
+	if err := srv.WaitFor(time.Second, func() bool { return s.MessageCount() == 3 }); err != nil {
+		t.Fatalf("price change: %v", err)
+	}
+	if book := s.OrderBooks().Book("up"); book == nil || !book.Seeded() {
+		t.Fatal("Expected a seeded book for token up")
+	}
+
+	// A dropped connection leaves a gap record before the fresh snapshots
+	srv.Play(wstest.Disconnect())
+	if err := srv.WaitFor(5*time.Second, func() bool { return s.MessageCount() == 5 }); err != nil {
+		t.Fatalf("resubscribe: %v", err)
+	}
+	s.Stop()
+
+	got := recordTypes(t, s.FilePath())
+	want := []string{"metadata", "book", "book", "price_change", "gap", "book", "book"}
+	if len(got) != len(want) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("records = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMarketSession_MalformedFrame(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	s := newTestSession(t, srv.URL)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop()
+
+	if err := srv.WaitFor(time.Second, func() bool { return s.MessageCount() == 2 }); err != nil {
+		t.Fatalf("snapshots: %v", err)
+	}
+
+	// A bad frame is skipped without dropping the connection
+	srv.Play(
+		wstest.Malformed(),
+		wstest.Send(wstest.PriceChange("0xcondition", wstest.Change("down", "SELL", "0.6", "5"))),
+	)
+	if err := srv.WaitFor(time.Second, func() bool { return s.MessageCount() == 3 }); err != nil {
+		t.Fatalf("price change after malformed frame: %v", err)
+	}
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("Connections = %d, want 1", got)
+	}
+}
+
+func TestMarketSession_Metrics(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	m := metrics.New()
+	s := newTestSession(t, srv.URL)
+	s.metrics = m
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if err := srv.WaitFor(time.Second, func() bool { return s.MessageCount() == 2 }); err != nil {
+		t.Fatalf("snapshots: %v", err)
+	}
+	srv.Play(wstest.Malformed(), wstest.Disconnect())
+	if err := srv.WaitFor(5*time.Second, func() bool { return s.MessageCount() == 4 }); err != nil {
+		t.Fatalf("resubscribe: %v", err)
+	}
+	s.Stop()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	text := rec.Body.String()
+	for _, want := range []string{
+		`polymarket_ws_messages_total{event_type="book",series="eth-up-or-down-15m"} 4`,
+		`polymarket_ws_parse_errors_total{series="eth-up-or-down-15m"} 1`,
+		`polymarket_ws_reconnects_total{reason="read_error",series="eth-up-or-down-15m"} 1`,
+		`polymarket_storage_bytes_written_total{series="eth-up-or-down-15m"}`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %s in:\n%s", want, text)
+		}
+	}
+
+	// Tokens of a stopped session are no longer reported
+	if n := testutil.CollectAndCount(m.Registry(), "polymarket_ws_last_message_age_seconds"); n != 0 {
+		t.Errorf("last message age reported for %d tokens after Stop", n)
+	}
+}
+
+func TestMarketSession_FlushesPartialFile(t *testing.T) {
+	srv := wstest.NewServer()
+	defer srv.Close()
+
+	s := newTestSession(t, srv.URL)
+	s.useGzip = true
+	s.flushInterval = 10 * time.Millisecond
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	partial := s.FilePath() + partialSuffix
+
+	// Without stopping the session, the flushed data is a readable gzip
+	// stream, as it would be after a crash
+	if err := srv.WaitFor(time.Second, func() bool {
+		info, err := os.Stat(partial)
+		return err == nil && info.Size() > 0 && s.MessageCount() == 2 && len(readPartial(partial)) == 3
+	}); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	s.Stop()
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Error("Partial file left after Stop")
+	}
+	if got := readPartial(s.FilePath()); len(got) != 3 {
+		t.Errorf("records = %v", got)
+	}
+}
+
+// readPartial returns the complete lines readable from a gzip file, which
+// may still be open for writing.
+func readPartial(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil
+	}
+	data, _ := io.ReadAll(zr)
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		return strings.Split(string(data[:i]), "\n")
+	}
+	return nil
+}
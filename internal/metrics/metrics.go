@@ -0,0 +1,336 @@
+// Package metrics exposes Prometheus metrics for the collectors.
+//
+// All methods are safe to call on a nil *Metrics, so components can be
+// instrumented unconditionally and metrics enabled only when configured.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/johan/polymarket-collector/internal/storage"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+const namespace = "polymarket"
+
+// Metrics holds the collector metrics and the registry they are served from.
+// The series label is the series slug for the cycle collector and empty
+// for the tag-based collector.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	messages          *prometheus.CounterVec
+	activeSessions    prometheus.Gauge
+	reconnects        *prometheus.CounterVec
+	parseErrors       *prometheus.CounterVec
+	bytesWritten      *prometheus.CounterVec
+	writeLatency      *prometheus.HistogramVec
+	discoveryFailures *prometheus.CounterVec
+	lastMessageAge    *prometheus.Desc
+	sinkWritten       *prometheus.Desc
+	sinkErrors        *prometheus.Desc
+	sinkDropped       *prometheus.Desc
+	sinkQueued        *prometheus.Desc
+
+	mu     sync.Mutex
+	tokens map[string]*tokenState // key: asset ID
+	sinks  []sinkSource
+	now    func() time.Time
+}
+
+// sinkSource reads the per-sink counters of a multi storage.
+type sinkSource struct {
+	series string
+	stats  func() []storage.SinkStats
+}
+
+// tokenState is the last activity of a tracked token.
+type tokenState struct {
+	series   string
+	lastSeen time.Time // When tracking started, until the first message
+}
+
+// New creates the metrics and registers them, along with the Go runtime
+// and process collectors, in a new registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ws",
+			Name:      "messages_total",
+			Help:      "Messages received, by series and event type.",
+		}, []string{"series", "event_type"}),
+		activeSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sessions_active",
+			Help:      "Market sessions currently collecting.",
+		}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ws",
+			Name:      "reconnects_total",
+			Help:      "Dropped WebSocket connections, by series and reason.",
+		}, []string{"series", "reason"}),
+		parseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ws",
+			Name:      "parse_errors_total",
+			Help:      "WebSocket frames that could not be parsed.",
+		}, []string{"series"}),
+		bytesWritten: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "bytes_written_total",
+			Help:      "Bytes of records written to storage, before compression. Only JSONL storage counts bytes.",
+		}, []string{"series"}),
+		writeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "write_duration_seconds",
+			Help:      "Time taken by each storage write.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to ~2.6s
+		}, []string{"series"}),
+		discoveryFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "discovery",
+			Name:      "failures_total",
+			Help:      "Failed market discovery requests.",
+		}, []string{"series"}),
+		lastMessageAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ws", "last_message_age_seconds"),
+			"Time since the last message for each subscribed token.",
+			[]string{"series", "asset_id"}, nil),
+		sinkWritten: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "storage", "sink_written_total"),
+			"Messages written by each sink of a multi storage.",
+			[]string{"series", "sink"}, nil),
+		sinkErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "storage", "sink_errors_total"),
+			"Failed writes of each sink of a multi storage.",
+			[]string{"series", "sink"}, nil),
+		sinkDropped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "storage", "sink_dropped_total"),
+			"Messages dropped because a sink's queue was full.",
+			[]string{"series", "sink"}, nil),
+		sinkQueued: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "storage", "sink_queued"),
+			"Messages waiting in each sink's queue.",
+			[]string{"series", "sink"}, nil),
+		tokens: make(map[string]*tokenState),
+		now:    time.Now,
+	}
+
+	m.registry.MustRegister(
+		m.messages,
+		m.activeSessions,
+		m.reconnects,
+		m.parseErrors,
+		m.bytesWritten,
+		m.writeLatency,
+		m.discoveryFailures,
+		ageCollector{m},
+		sinkCollector{m},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Registry returns the registry the metrics are registered in.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an HTTP handler serving the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics on addr at /metrics until ctx is cancelled.
+func (m *Metrics) Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("serving metrics: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("stopping metrics server: %w", err)
+		}
+		return nil
+	}
+}
+
+// ObserveMessages counts messages by event type and records activity for
+// the tracked tokens they carry.
+func (m *Metrics) ObserveMessages(series string, messages []ws.WSMessage) {
+	if m == nil || len(messages) == 0 {
+		return
+	}
+	for _, msg := range messages {
+		m.messages.WithLabelValues(series, msg.EventType).Inc()
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	touch := func(assetID string) {
+		if t, ok := m.tokens[assetID]; ok {
+			t.lastSeen = now
+		}
+	}
+	for _, msg := range messages {
+		if msg.AssetID != "" {
+			touch(msg.AssetID)
+		}
+		for _, pc := range msg.PriceChanges {
+			touch(pc.AssetID)
+		}
+	}
+}
+
+// TrackTokens starts reporting the last message age of tokens. Until a
+// token's first message, the age counts from now.
+func (m *Metrics) TrackTokens(series string, tokenIDs []string) {
+	if m == nil {
+		return
+	}
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range tokenIDs {
+		if _, ok := m.tokens[id]; !ok {
+			m.tokens[id] = &tokenState{series: series, lastSeen: now}
+		}
+	}
+}
+
+// UntrackTokens stops reporting the last message age of tokens.
+func (m *Metrics) UntrackTokens(tokenIDs []string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range tokenIDs {
+		delete(m.tokens, id)
+	}
+}
+
+// ObserveReconnect counts a dropped connection.
+func (m *Metrics) ObserveReconnect(series string, reason ws.DisconnectReason) {
+	if m == nil {
+		return
+	}
+	m.reconnects.WithLabelValues(series, string(reason)).Inc()
+}
+
+// ObserveParseError counts a frame that could not be parsed.
+func (m *Metrics) ObserveParseError(series string) {
+	if m == nil {
+		return
+	}
+	m.parseErrors.WithLabelValues(series).Inc()
+}
+
+// ObserveWrite records a storage write of n bytes that took d.
+func (m *Metrics) ObserveWrite(series string, n int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.bytesWritten.WithLabelValues(series).Add(float64(n))
+	m.writeLatency.WithLabelValues(series).Observe(d.Seconds())
+}
+
+// ObserveDiscoveryFailure counts a failed discovery request.
+func (m *Metrics) ObserveDiscoveryFailure(series string) {
+	if m == nil {
+		return
+	}
+	m.discoveryFailures.WithLabelValues(series).Inc()
+}
+
+// SetActiveSessions sets the number of active sessions.
+func (m *Metrics) SetActiveSessions(n int) {
+	if m == nil {
+		return
+	}
+	m.activeSessions.Set(float64(n))
+}
+
+// WatchSinks reports the per-sink counters of a multi storage, read from
+// stats at scrape time.
+func (m *Metrics) WatchSinks(series string, stats func() []storage.SinkStats) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sinks = append(m.sinks, sinkSource{series: series, stats: stats})
+}
+
+// ageCollector reports the last message age of the tracked tokens at
+// scrape time.
+type ageCollector struct {
+	m *Metrics
+}
+
+func (c ageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.lastMessageAge
+}
+
+func (c ageCollector) Collect(ch chan<- prometheus.Metric) {
+	now := c.m.now()
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	for id, t := range c.m.tokens {
+		ch <- prometheus.MustNewConstMetric(c.m.lastMessageAge, prometheus.GaugeValue,
+			now.Sub(t.lastSeen).Seconds(), t.series, id)
+	}
+}
+
+// sinkCollector reports the counters of the watched sinks at scrape time.
+type sinkCollector struct {
+	m *Metrics
+}
+
+func (c sinkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.sinkWritten
+	ch <- c.m.sinkErrors
+	ch <- c.m.sinkDropped
+	ch <- c.m.sinkQueued
+}
+
+func (c sinkCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.Lock()
+	sources := append([]sinkSource(nil), c.m.sinks...)
+	c.m.mu.Unlock()
+
+	for _, src := range sources {
+		for _, st := range src.stats() {
+			ch <- prometheus.MustNewConstMetric(c.m.sinkWritten, prometheus.CounterValue, float64(st.Written), src.series, st.Name)
+			ch <- prometheus.MustNewConstMetric(c.m.sinkErrors, prometheus.CounterValue, float64(st.Errors), src.series, st.Name)
+			ch <- prometheus.MustNewConstMetric(c.m.sinkDropped, prometheus.CounterValue, float64(st.Dropped), src.series, st.Name)
+			ch <- prometheus.MustNewConstMetric(c.m.sinkQueued, prometheus.GaugeValue, float64(st.Queued), src.series, st.Name)
+		}
+	}
+}
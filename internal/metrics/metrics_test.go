@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/johan/polymarket-collector/internal/storage"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.ObserveMessages("s", []ws.WSMessage{{EventType: ws.EventTypeBook}})
+	m.TrackTokens("s", []string{"a"})
+	m.UntrackTokens([]string{"a"})
+	m.ObserveReconnect("s", ws.ReasonReadError)
+	m.ObserveParseError("s")
+	m.ObserveWrite("s", 10, time.Millisecond)
+	m.ObserveDiscoveryFailure("s")
+	m.SetActiveSessions(1)
+	m.WatchSinks("s", func() []storage.SinkStats { return nil })
+}
+
+func TestMetrics_Counters(t *testing.T) {
+	m := New()
+	m.ObserveMessages("eth-15m", []ws.WSMessage{
+		{EventType: ws.EventTypeBook, AssetID: "a"},
+		{EventType: ws.EventTypeBook, AssetID: "b"},
+		{EventType: ws.EventTypePriceChange},
+	})
+	m.ObserveReconnect("eth-15m", ws.ReasonReadTimeout)
+	m.ObserveParseError("eth-15m")
+	m.ObserveWrite("eth-15m", 100, time.Millisecond)
+	m.ObserveWrite("eth-15m", 50, time.Millisecond)
+	m.ObserveDiscoveryFailure("btc-15m")
+	m.SetActiveSessions(3)
+
+	checks := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"book messages", testutil.ToFloat64(m.messages.WithLabelValues("eth-15m", ws.EventTypeBook)), 2},
+		{"price_change messages", testutil.ToFloat64(m.messages.WithLabelValues("eth-15m", ws.EventTypePriceChange)), 1},
+		{"reconnects", testutil.ToFloat64(m.reconnects.WithLabelValues("eth-15m", string(ws.ReasonReadTimeout))), 1},
+		{"parse errors", testutil.ToFloat64(m.parseErrors.WithLabelValues("eth-15m")), 1},
+		{"bytes written", testutil.ToFloat64(m.bytesWritten.WithLabelValues("eth-15m")), 150},
+		{"discovery failures", testutil.ToFloat64(m.discoveryFailures.WithLabelValues("btc-15m")), 1},
+		{"active sessions", testutil.ToFloat64(m.activeSessions), 3},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestMetrics_LastMessageAge(t *testing.T) {
+	m := New()
+	now := time.Date(2026, 2, 6, 8, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	m.TrackTokens("eth-15m", []string{"up", "down"})
+	now = now.Add(10 * time.Second)
+	m.ObserveMessages("eth-15m", []ws.WSMessage{{
+		EventType:    ws.EventTypePriceChange,
+		PriceChanges: []ws.PriceChange{{AssetID: "up"}},
+	}})
+	now = now.Add(5 * time.Second)
+
+	want := `
+# HELP polymarket_ws_last_message_age_seconds Time since the last message for each subscribed token.
+# TYPE polymarket_ws_last_message_age_seconds gauge
+polymarket_ws_last_message_age_seconds{asset_id="down",series="eth-15m"} 15
+polymarket_ws_last_message_age_seconds{asset_id="up",series="eth-15m"} 5
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(want), "polymarket_ws_last_message_age_seconds"); err != nil {
+		t.Error(err)
+	}
+
+	m.UntrackTokens([]string{"up", "down"})
+	if n := testutil.CollectAndCount(ageCollector{m}); n != 0 {
+		t.Errorf("untracked tokens still reported: %d", n)
+	}
+}
+
+func TestMetrics_Sinks(t *testing.T) {
+	m := New()
+	m.WatchSinks("", func() []storage.SinkStats {
+		return []storage.SinkStats{
+			{Name: "file", Written: 10},
+			{Name: "kafka", Written: 4, Errors: 6, Dropped: 2, Queued: 3},
+		}
+	})
+
+	want := `
+# HELP polymarket_storage_sink_errors_total Failed writes of each sink of a multi storage.
+# TYPE polymarket_storage_sink_errors_total counter
+polymarket_storage_sink_errors_total{series="",sink="file"} 0
+polymarket_storage_sink_errors_total{series="",sink="kafka"} 6
+# HELP polymarket_storage_sink_queued Messages waiting in each sink's queue.
+# TYPE polymarket_storage_sink_queued gauge
+polymarket_storage_sink_queued{series="",sink="file"} 0
+polymarket_storage_sink_queued{series="",sink="kafka"} 3
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(want),
+		"polymarket_storage_sink_errors_total", "polymarket_storage_sink_queued"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(sinkCollector{m}); n != 8 {
+		t.Errorf("sink metrics = %d, want 8", n)
+	}
+}
+
+func TestMetrics_Serve(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	m := New()
+	m.ObserveParseError("eth-15m")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Serve(ctx, addr) }()
+
+	var body string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err == nil {
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(data)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics endpoint not reachable: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(body, `polymarket_ws_parse_errors_total{series="eth-15m"} 1`) {
+		t.Errorf("parse error counter missing from:\n%s", body)
+	}
+	if !strings.Contains(body, "go_goroutines") {
+		t.Error("runtime metrics missing")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package orderbook maintains live L2 order books reconstructed from the WebSocket feed.
+package orderbook
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/johan/polymarket-collector/internal/types"
+)
+
+// Side values used by price_change events.
+const (
+	SideBuy  = "BUY"
+	SideSell = "SELL"
+)
+
+// Snapshot is a point-in-time copy of an order book.
+type Snapshot struct {
+	AssetID        string             `json:"asset_id"`
+	Market         string             `json:"market"`
+	Timestamp      string             `json:"timestamp"`
+	Hash           string             `json:"hash"`
+	Bids           []types.PriceLevel `json:"bids"` // Sorted by price descending
+	Asks           []types.PriceLevel `json:"asks"` // Sorted by price ascending
+	LastTradePrice string             `json:"last_trade_price,omitempty"`
+}
+
+// Book is a live L2 order book for a single asset.
+// It is seeded from a book snapshot and updated with price level changes.
+type Book struct {
+	AssetID string
+
+	mu             sync.RWMutex
+	market         string
+	timestamp      string
+	hash           string
+	lastTradePrice string
+	seeded         bool
+	bids           map[float64]types.PriceLevel // key: parsed price
+	asks           map[float64]types.PriceLevel
+}
+
+// NewBook creates an empty, unseeded order book for an asset.
+func NewBook(assetID string) *Book {
+	return &Book{
+		AssetID: assetID,
+		bids:    make(map[float64]types.PriceLevel),
+		asks:    make(map[float64]types.PriceLevel),
+	}
+}
+
+// Seed replaces the whole book with a full snapshot.
+func (b *Book) Seed(market, timestamp, hash string, bids, asks []types.PriceLevel) error {
+	newBids, err := buildLevels(bids)
+	if err != nil {
+		return fmt.Errorf("seeding bids: %w", err)
+	}
+	newAsks, err := buildLevels(asks)
+	if err != nil {
+		return fmt.Errorf("seeding asks: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.market = market
+	b.timestamp = timestamp
+	b.hash = hash
+	b.bids = newBids
+	b.asks = newAsks
+	b.seeded = true
+	return nil
+}
+
+// Apply applies a single price level change. A size of zero removes the level.
+// Changes received before the book has been seeded are ignored, since the
+// resulting book would be incomplete.
+func (b *Book) Apply(side, price, size, timestamp, hash string) error {
+	p, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return fmt.Errorf("parsing price %q: %w", price, err)
+	}
+	s, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return fmt.Errorf("parsing size %q: %w", size, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.seeded {
+		return nil
+	}
+
+	var levels map[float64]types.PriceLevel
+	switch side {
+	case SideBuy:
+		levels = b.bids
+	case SideSell:
+		levels = b.asks
+	default:
+		return fmt.Errorf("unknown side: %s", side)
+	}
+
+	if s == 0 {
+		delete(levels, p)
+	} else {
+		levels[p] = types.PriceLevel{Price: price, Size: size}
+	}
+
+	b.timestamp = timestamp
+	if hash != "" {
+		b.hash = hash
+	}
+	return nil
+}
+
+// SetLastTradePrice records the most recent trade price.
+func (b *Book) SetLastTradePrice(price string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastTradePrice = price
+}
+
+// Reset clears the book and marks it as unseeded until the next snapshot.
+func (b *Book) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = make(map[float64]types.PriceLevel)
+	b.asks = make(map[float64]types.PriceLevel)
+	b.seeded = false
+}
+
+// Seeded returns whether the book has received a full snapshot.
+func (b *Book) Seeded() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.seeded
+}
+
+// BestBid returns the highest bid level.
+func (b *Book) BestBid() (types.PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return best(b.bids, true)
+}
+
+// BestAsk returns the lowest ask level.
+func (b *Book) BestAsk() (types.PriceLevel, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return best(b.asks, false)
+}
+
+// Depth returns up to n levels on each side, best price first.
+// A non-positive n returns all levels.
+func (b *Book) Depth(n int) (bids, asks []types.PriceLevel) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return sortedLevels(b.bids, true, n), sortedLevels(b.asks, false, n)
+}
+
+// Snapshot returns a copy of the full book.
+func (b *Book) Snapshot() Snapshot {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return Snapshot{
+		AssetID:        b.AssetID,
+		Market:         b.market,
+		Timestamp:      b.timestamp,
+		Hash:           b.hash,
+		Bids:           sortedLevels(b.bids, true, 0),
+		Asks:           sortedLevels(b.asks, false, 0),
+		LastTradePrice: b.lastTradePrice,
+	}
+}
+
+// buildLevels converts a list of price levels into a map, dropping empty levels.
+func buildLevels(levels []types.PriceLevel) (map[float64]types.PriceLevel, error) {
+	m := make(map[float64]types.PriceLevel, len(levels))
+	for _, l := range levels {
+		p, err := strconv.ParseFloat(l.Price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing price %q: %w", l.Price, err)
+		}
+		s, err := strconv.ParseFloat(l.Size, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing size %q: %w", l.Size, err)
+		}
+		if s == 0 {
+			continue
+		}
+		m[p] = l
+	}
+	return m, nil
+}
+
+// best returns the highest (descending) or lowest price level.
+func best(levels map[float64]types.PriceLevel, descending bool) (types.PriceLevel, bool) {
+	var (
+		bestPrice float64
+		bestLevel types.PriceLevel
+		found     bool
+	)
+	for p, l := range levels {
+		if !found || (descending && p > bestPrice) || (!descending && p < bestPrice) {
+			bestPrice, bestLevel, found = p, l, true
+		}
+	}
+	return bestLevel, found
+}
+
+// sortedLevels returns up to n levels sorted best price first (n <= 0 = all).
+func sortedLevels(levels map[float64]types.PriceLevel, descending bool, n int) []types.PriceLevel {
+	prices := make([]float64, 0, len(levels))
+	for p := range levels {
+		prices = append(prices, p)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	} else {
+		sort.Float64s(prices)
+	}
+
+	if n > 0 && len(prices) > n {
+		prices = prices[:n]
+	}
+
+	result := make([]types.PriceLevel, len(prices))
+	for i, p := range prices {
+		result[i] = levels[p]
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/types"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+func seedMessage() ws.WSMessage {
+	return ws.WSMessage{
+		EventType: ws.EventTypeBook,
+		Market:    "0xmarket",
+		AssetID:   "token1",
+		Timestamp: "1000",
+		Hash:      "hash1",
+		Bids: []types.PriceLevel{
+			{Price: "0.48", Size: "100"},
+			{Price: "0.50", Size: "200"},
+			{Price: "0.49", Size: "150"},
+		},
+		Asks: []types.PriceLevel{
+			{Price: "0.53", Size: "300"},
+			{Price: "0.51", Size: "50"},
+			{Price: "0.52", Size: "0"},
+		},
+		LastTradePrice: "0.50",
+	}
+}
+
+func TestStore_SeedFromBook(t *testing.T) {
+	store := NewStore()
+	if err := store.Apply([]ws.WSMessage{seedMessage()}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	book := store.Book("token1")
+	if book == nil {
+		t.Fatal("Expected book for token1")
+	}
+	if !book.Seeded() {
+		t.Error("Expected book to be seeded")
+	}
+
+	bid, ok := book.BestBid()
+	if !ok || bid.Price != "0.50" {
+		t.Errorf("BestBid = %v (ok=%v), want 0.50", bid, ok)
+	}
+	ask, ok := book.BestAsk()
+	if !ok || ask.Price != "0.51" {
+		t.Errorf("BestAsk = %v (ok=%v), want 0.51", ask, ok)
+	}
+
+	snap := book.Snapshot()
+	if len(snap.Asks) != 2 {
+		t.Errorf("Asks count = %d, want 2 (zero-size level dropped)", len(snap.Asks))
+	}
+	if snap.Bids[0].Price != "0.50" || snap.Bids[2].Price != "0.48" {
+		t.Errorf("Bids not sorted descending: %v", snap.Bids)
+	}
+	if snap.LastTradePrice != "0.50" {
+		t.Errorf("LastTradePrice = %q, want %q", snap.LastTradePrice, "0.50")
+	}
+}
+
+func TestStore_ApplyPriceChanges(t *testing.T) {
+	store := NewStore()
+	store.Apply([]ws.WSMessage{seedMessage()})
+
+	err := store.Apply([]ws.WSMessage{{
+		EventType: ws.EventTypePriceChange,
+		Market:    "0xmarket",
+		Timestamp: "2000",
+		PriceChanges: []ws.PriceChange{
+			{AssetID: "token1", Price: "0.50", Size: "0", Side: "BUY", Hash: "hash2"},
+			{AssetID: "token1", Price: "0.495", Size: "10", Side: "BUY", Hash: "hash3"},
+			{AssetID: "token1", Price: "0.51", Size: "75", Side: "SELL", Hash: "hash4"},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	book := store.Book("token1")
+	bid, _ := book.BestBid()
+	if bid.Price != "0.495" {
+		t.Errorf("BestBid.Price = %q, want %q", bid.Price, "0.495")
+	}
+	ask, _ := book.BestAsk()
+	if ask.Size != "75" {
+		t.Errorf("BestAsk.Size = %q, want %q", ask.Size, "75")
+	}
+
+	snap := book.Snapshot()
+	if snap.Timestamp != "2000" || snap.Hash != "hash4" {
+		t.Errorf("Snapshot timestamp/hash = %s/%s, want 2000/hash4", snap.Timestamp, snap.Hash)
+	}
+}
+
+func TestStore_PriceChangeBeforeSeedIgnored(t *testing.T) {
+	store := NewStore()
+	err := store.Apply([]ws.WSMessage{{
+		EventType: ws.EventTypePriceChange,
+		PriceChanges: []ws.PriceChange{
+			{AssetID: "token1", Price: "0.50", Size: "10", Side: "BUY"},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if store.Book("token1") != nil {
+		t.Error("Expected no book before snapshot")
+	}
+}
+
+func TestStore_BadLevelDoesNotAbortEvent(t *testing.T) {
+	store := NewStore()
+	store.Apply([]ws.WSMessage{seedMessage()})
+
+	err := store.Apply([]ws.WSMessage{{
+		EventType: ws.EventTypePriceChange,
+		Timestamp: "2000",
+		PriceChanges: []ws.PriceChange{
+			{AssetID: "token1", Price: "abc", Size: "10", Side: "BUY"},
+			{AssetID: "token1", Price: "0.51", Size: "75", Side: "SELL"},
+			{AssetID: "token1", Price: "0.50", Size: "x", Side: "BUY"},
+		},
+	}})
+	if err == nil {
+		t.Fatal("Expected error for invalid levels, got nil")
+	}
+
+	ask, _ := store.Book("token1").BestAsk()
+	if ask.Size != "75" {
+		t.Errorf("BestAsk.Size = %q, want %q (valid change after bad level applied)", ask.Size, "75")
+	}
+}
+
+func TestBook_Depth(t *testing.T) {
+	store := NewStore()
+	store.Apply([]ws.WSMessage{seedMessage()})
+
+	bids, asks := store.Book("token1").Depth(2)
+	if len(bids) != 2 || len(asks) != 2 {
+		t.Fatalf("Depth(2) = %d bids, %d asks, want 2 and 2", len(bids), len(asks))
+	}
+	if bids[1].Price != "0.49" {
+		t.Errorf("bids[1].Price = %q, want %q", bids[1].Price, "0.49")
+	}
+	if asks[1].Price != "0.53" {
+		t.Errorf("asks[1].Price = %q, want %q", asks[1].Price, "0.53")
+	}
+
+	bids, _ = store.Book("token1").Depth(0)
+	if len(bids) != 3 {
+		t.Errorf("Depth(0) bids = %d, want 3", len(bids))
+	}
+}
+
+func TestBook_Reset(t *testing.T) {
+	store := NewStore()
+	store.Apply([]ws.WSMessage{seedMessage()})
+
+	book := store.Book("token1")
+	book.Reset()
+	if book.Seeded() {
+		t.Error("Expected book to be unseeded after reset")
+	}
+	if _, ok := book.BestBid(); ok {
+		t.Error("Expected empty book after reset")
+	}
+
+	// Deltas are ignored until the next snapshot
+	book.Apply(SideBuy, "0.40", "10", "3000", "")
+	if _, ok := book.BestBid(); ok {
+		t.Error("Expected delta to be ignored on unseeded book")
+	}
+}
+
+func TestBook_InvalidPrice(t *testing.T) {
+	book := NewBook("token1")
+	err := book.Seed("m", "1", "h", []types.PriceLevel{{Price: "abc", Size: "1"}}, nil)
+	if err == nil {
+		t.Error("Expected error for invalid price, got nil")
+	}
+}
@@ -0,0 +1,125 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// Store keeps a live order book for every asset seen on the feed.
+type Store struct {
+	mu    sync.RWMutex
+	books map[string]*Book // key: assetID
+}
+
+// NewStore creates an empty order book store.
+func NewStore() *Store {
+	return &Store{
+		books: make(map[string]*Book),
+	}
+}
+
+// Apply updates the books from a batch of WebSocket messages.
+// Book snapshots seed (or reseed) a book; price changes update it.
+// Every message is applied even if an earlier one fails; the first error is returned.
+func (s *Store) Apply(messages []ws.WSMessage) error {
+	var firstErr error
+	for i := range messages {
+		if err := s.applyMessage(&messages[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *Store) applyMessage(msg *ws.WSMessage) error {
+	switch msg.EventType {
+	case ws.EventTypeBook:
+		if msg.AssetID == "" {
+			return fmt.Errorf("book message without asset_id")
+		}
+		book := s.getOrCreate(msg.AssetID)
+		if err := book.Seed(msg.Market, msg.Timestamp, msg.Hash, msg.Bids, msg.Asks); err != nil {
+			return fmt.Errorf("asset %s: %w", msg.AssetID, err)
+		}
+		if msg.LastTradePrice != "" {
+			book.SetLastTradePrice(msg.LastTradePrice)
+		}
+
+	case ws.EventTypeLastTradePrice:
+		if book := s.Book(msg.AssetID); book != nil {
+			book.SetLastTradePrice(msg.Price)
+		}
+
+	case ws.EventTypePriceChange:
+		// A bad level must not leave the rest of the event unapplied, so
+		// every change is attempted and the failures are joined.
+		var errs []error
+		for _, pc := range msg.PriceChanges {
+			book := s.Book(pc.AssetID)
+			if book == nil {
+				// Not seeded yet; wait for a snapshot
+				continue
+			}
+			if err := book.Apply(pc.Side, pc.Price, pc.Size, msg.Timestamp, pc.Hash); err != nil {
+				errs = append(errs, fmt.Errorf("asset %s: %w", pc.AssetID, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (s *Store) getOrCreate(assetID string) *Book {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[assetID]
+	if !ok {
+		book = NewBook(assetID)
+		s.books[assetID] = book
+	}
+	return book
+}
+
+// Book returns the book for an asset, or nil if none has been seeded.
+func (s *Store) Book(assetID string) *Book {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.books[assetID]
+}
+
+// AssetIDs returns the IDs of all tracked assets in sorted order.
+func (s *Store) AssetIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.books))
+	for id := range s.books {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Snapshots returns a snapshot of every tracked book.
+func (s *Store) Snapshots() []Snapshot {
+	ids := s.AssetIDs()
+	snapshots := make([]Snapshot, 0, len(ids))
+	for _, id := range ids {
+		if book := s.Book(id); book != nil {
+			snapshots = append(snapshots, book.Snapshot())
+		}
+	}
+	return snapshots
+}
+
+// Remove stops tracking an asset.
+func (s *Store) Remove(assetID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.books, assetID)
+}
@@ -0,0 +1,329 @@
+// Package pipeline decouples the WebSocket read loop from slow writers.
+//
+// Records are pushed into a bounded queue and written in batches by a
+// single background goroutine. When the queue is full, the overflow policy
+// decides whether the producer blocks, the oldest queued record is dropped,
+// or records are spilled to a temporary file on disk and replayed in order
+// once the writer catches up.
+package pipeline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens when the queue is full.
+type OverflowPolicy string
+
+// Supported overflow policies.
+const (
+	// Block makes Push wait until the writer has room.
+	Block OverflowPolicy = "block"
+
+	// DropOldest discards the oldest queued record to make room.
+	DropOldest OverflowPolicy = "drop-oldest"
+
+	// Spill writes records to a temporary file until the writer catches up.
+	Spill OverflowPolicy = "spill"
+)
+
+// Config contains pipeline settings.
+type Config struct {
+	// Maximum number of queued records
+	QueueSize int
+
+	// Maximum number of records per write
+	BatchSize int
+
+	// What to do when the queue is full
+	Overflow OverflowPolicy
+
+	// Directory for spill files (default: os.TempDir())
+	SpillDir string
+}
+
+// WriteFunc writes a batch of records. Records are written in push order.
+type WriteFunc func(records [][]byte) error
+
+// Stats are the pipeline counters.
+type Stats struct {
+	Pushed      int64 `json:"pushed"`
+	Written     int64 `json:"written"`
+	Dropped     int64 `json:"dropped"`      // Discarded by the drop-oldest policy
+	Spilled     int64 `json:"spilled"`      // Written to a spill file
+	WriteErrors int64 `json:"write_errors"` // Failed batches
+	Queued      int   `json:"queued"`
+}
+
+// Pipeline is a bounded, batching queue in front of a WriteFunc.
+type Pipeline struct {
+	cfg   Config
+	write WriteFunc
+	queue chan []byte
+	done  chan struct{}
+
+	// closeMu is held for reading by Push, so Close can wait for in-flight
+	// pushes before closing the queue.
+	closeMu sync.RWMutex
+	closed  bool
+
+	// Spill state. While a spill segment is open, every record goes to it
+	// so that ordering is preserved.
+	spillMu     sync.Mutex
+	spillFile   *os.File
+	spillWriter *bufio.Writer
+
+	pushed      atomic.Int64
+	written     atomic.Int64
+	dropped     atomic.Int64
+	spilled     atomic.Int64
+	writeErrors atomic.Int64
+}
+
+// New creates a pipeline and starts its writer.
+func New(cfg Config, write WriteFunc) (*Pipeline, error) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	switch cfg.Overflow {
+	case "":
+		cfg.Overflow = Block
+	case Block, DropOldest, Spill:
+	default:
+		return nil, fmt.Errorf("invalid overflow policy: %s", cfg.Overflow)
+	}
+
+	p := &Pipeline{
+		cfg:   cfg,
+		write: write,
+		queue: make(chan []byte, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Push queues a record. It only blocks with the Block policy when the queue
+// is full. Records pushed after Close are discarded.
+func (p *Pipeline) Push(record []byte) {
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+
+	if p.closed {
+		return
+	}
+	p.pushed.Add(1)
+
+	if p.cfg.Overflow == Spill && p.appendSpill(record, false) {
+		return
+	}
+
+	select {
+	case p.queue <- record:
+		return
+	default:
+	}
+
+	switch p.cfg.Overflow {
+	case Block:
+		p.queue <- record
+
+	case DropOldest:
+		for {
+			select {
+			case p.queue <- record:
+				return
+			default:
+			}
+			select {
+			case <-p.queue:
+				p.dropped.Add(1)
+			default:
+			}
+		}
+
+	case Spill:
+		p.appendSpill(record, true)
+	}
+}
+
+// appendSpill writes a record to the spill segment. If the segment is not
+// open, it is only created when force is set. It returns whether the record
+// was spilled.
+func (p *Pipeline) appendSpill(record []byte, force bool) bool {
+	p.spillMu.Lock()
+	defer p.spillMu.Unlock()
+
+	if p.spillFile == nil {
+		if !force {
+			return false
+		}
+		f, err := os.CreateTemp(p.cfg.SpillDir, "pipeline-*.spill")
+		if err != nil {
+			// Nowhere to spill to: fall back to blocking rather than losing data
+			log.Printf("Error creating spill file, blocking instead: %v", err)
+			p.spillMu.Unlock()
+			p.queue <- record
+			p.spillMu.Lock()
+			return true
+		}
+		p.spillFile = f
+		p.spillWriter = bufio.NewWriter(f)
+	}
+
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(record)))
+	p.spillWriter.Write(header[:n])
+	p.spillWriter.Write(record)
+	p.spilled.Add(1)
+	return true
+}
+
+// takeSpill detaches the current spill segment so the writer can replay it.
+// New records go to the queue again (or to a new segment if it fills up).
+func (p *Pipeline) takeSpill() (*os.File, error) {
+	p.spillMu.Lock()
+	defer p.spillMu.Unlock()
+
+	f := p.spillFile
+	if f == nil {
+		return nil, nil
+	}
+	p.spillFile = nil
+
+	if err := p.spillWriter.Flush(); err != nil {
+		return f, err
+	}
+	p.spillWriter = nil
+	_, err := f.Seek(0, io.SeekStart)
+	return f, err
+}
+
+// run is the writer goroutine.
+func (p *Pipeline) run() {
+	defer close(p.done)
+
+	batch := make([][]byte, 0, p.cfg.BatchSize)
+	for record := range p.queue {
+		batch = append(batch[:0], record)
+	fill:
+		for len(batch) < p.cfg.BatchSize {
+			select {
+			case r, ok := <-p.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, r)
+			default:
+				break fill
+			}
+		}
+		p.flush(batch)
+
+		// Once the queue is drained, replay anything that was spilled
+		if len(p.queue) == 0 {
+			p.replaySpill()
+		}
+	}
+
+	// Queue closed: replay the last segment
+	p.replaySpill()
+}
+
+// flush writes a batch and updates the counters.
+func (p *Pipeline) flush(batch [][]byte) {
+	if err := p.write(batch); err != nil {
+		p.writeErrors.Add(1)
+		log.Printf("Error writing batch of %d records: %v", len(batch), err)
+		return
+	}
+	p.written.Add(int64(len(batch)))
+}
+
+// replaySpill writes the records of the current spill segment in batches
+// and removes the file.
+func (p *Pipeline) replaySpill() {
+	f, err := p.takeSpill()
+	if f == nil {
+		return
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	if err != nil {
+		log.Printf("Error reading spill file %s: %v", f.Name(), err)
+		return
+	}
+
+	r := bufio.NewReader(f)
+	batch := make([][]byte, 0, p.cfg.BatchSize)
+	for {
+		record, err := readSpillRecord(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Error reading spill file %s: %v", f.Name(), err)
+			}
+			break
+		}
+		batch = append(batch, record)
+		if len(batch) == p.cfg.BatchSize {
+			p.flush(batch)
+			batch = make([][]byte, 0, p.cfg.BatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		p.flush(batch)
+	}
+}
+
+// readSpillRecord reads one length-prefixed record.
+func readSpillRecord(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, n)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Close stops accepting records, writes everything still queued or spilled
+// and waits for the writer to finish.
+func (p *Pipeline) Close() {
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		<-p.done
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.closeMu.Unlock()
+
+	<-p.done
+}
+
+// Stats returns the current counters.
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Pushed:      p.pushed.Load(),
+		Written:     p.written.Load(),
+		Dropped:     p.dropped.Load(),
+		Spilled:     p.spilled.Load(),
+		WriteErrors: p.writeErrors.Load(),
+		Queued:      len(p.queue),
+	}
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is a WriteFunc that records batches and can be paused.
+type collector struct {
+	mu      sync.Mutex
+	records []string
+	batches int
+	gate    chan struct{} // If set, each write waits for a value
+	fail    bool
+}
+
+func (c *collector) write(records [][]byte) error {
+	if c.gate != nil {
+		<-c.gate
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail {
+		return errors.New("write failed")
+	}
+	c.batches++
+	for _, r := range records {
+		c.records = append(c.records, string(r))
+	}
+	return nil
+}
+
+func (c *collector) got() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.records...)
+}
+
+func checkOrdered(t *testing.T, got []string, from, to int) {
+	t.Helper()
+	if len(got) != to-from {
+		t.Fatalf("got %d records, want %d", len(got), to-from)
+	}
+	for i, r := range got {
+		if r != strconv.Itoa(from+i) {
+			t.Fatalf("record %d = %s, want %d", i, r, from+i)
+		}
+	}
+}
+
+func TestPipeline_Block(t *testing.T) {
+	c := &collector{}
+	p, err := New(Config{QueueSize: 2, BatchSize: 3, Overflow: Block}, c.write)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		p.Push([]byte(strconv.Itoa(i)))
+	}
+	p.Close()
+
+	checkOrdered(t, c.got(), 0, 100)
+	stats := p.Stats()
+	if stats.Pushed != 100 || stats.Written != 100 || stats.Dropped != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPipeline_DropOldest(t *testing.T) {
+	c := &collector{gate: make(chan struct{})}
+	p, err := New(Config{QueueSize: 3, BatchSize: 10, Overflow: DropOldest}, c.write)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// The writer takes record 0 and waits in write; 1-3 fill the queue
+	p.Push([]byte("0"))
+	for len(p.queue) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < 10; i++ {
+		p.Push([]byte(strconv.Itoa(i)))
+	}
+
+	go func() {
+		for range 2 {
+			c.gate <- struct{}{}
+		}
+	}()
+	p.Close()
+
+	got := c.got()
+	if fmt.Sprint(got) != "[0 7 8 9]" {
+		t.Errorf("records = %v, want [0 7 8 9]", got)
+	}
+	if stats := p.Stats(); stats.Dropped != 6 || stats.Written != 4 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPipeline_Spill(t *testing.T) {
+	dir := t.TempDir()
+	c := &collector{gate: make(chan struct{})}
+	p, err := New(Config{QueueSize: 4, BatchSize: 2, Overflow: Spill, SpillDir: dir}, c.write)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// With the writer stalled, everything beyond the queue goes to disk
+	for i := 0; i < 50; i++ {
+		p.Push([]byte(strconv.Itoa(i)))
+	}
+	if stats := p.Stats(); stats.Spilled == 0 {
+		t.Fatalf("Expected records to be spilled, stats = %+v", stats)
+	}
+
+	// Let the writer catch up; push more while it replays
+	go func() {
+		for {
+			if _, ok := <-c.gate; !ok {
+				return
+			}
+		}
+	}()
+	close(c.gate)
+	for i := 50; i < 100; i++ {
+		p.Push([]byte(strconv.Itoa(i)))
+	}
+	p.Close()
+
+	checkOrdered(t, c.got(), 0, 100)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected spill files to be removed, found %d", len(entries))
+	}
+}
+
+func TestPipeline_WriteErrors(t *testing.T) {
+	c := &collector{fail: true}
+	p, err := New(Config{BatchSize: 10}, c.write)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	p.Push([]byte("a"))
+	p.Close()
+	p.Push([]byte("b")) // Discarded after Close
+
+	stats := p.Stats()
+	if stats.WriteErrors != 1 || stats.Written != 0 || stats.Pushed != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestNew_InvalidPolicy(t *testing.T) {
+	if _, err := New(Config{Overflow: "explode"}, func([][]byte) error { return nil }); err == nil {
+		t.Error("Expected error for invalid overflow policy")
+	}
+}
@@ -0,0 +1,383 @@
+// Package reader reads the JSONL and JSONL.gz files written by the
+// collectors: MarketSession files, with their metadata header, parsed or
+// raw frame records and gap records, and the plain orderbook_*.jsonl files
+// of FileStorage.
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// maxLineSize is the longest JSONL record accepted. Book snapshots of deep
+// markets can be large.
+const maxLineSize = 16 << 20
+
+// Kind is the type of a record.
+type Kind int
+
+// Record kinds.
+const (
+	// KindMessage is a parsed message, one per line.
+	KindMessage Kind = iota
+
+	// KindFrame is a raw frame, which may hold several messages.
+	KindFrame
+
+	// KindGap is a gap in the recording.
+	KindGap
+
+	// KindRecovered marks a file repaired after a crash; it is the last
+	// record and data before it may be cut short.
+	KindRecovered
+
+	// KindOther is any other record, such as drift events.
+	KindOther
+)
+
+// Record is one line of a file.
+type Record struct {
+	Kind Kind
+	Type string // The "type" field of typed records, e.g. "gap" or "drift"
+	Line int    // Line number, starting at 1
+	Data []byte // The line; only valid until the next call
+
+	Frame     ws.RawFrame               // Set for KindFrame
+	Gap       *recording.GapRecord      // Set for KindGap
+	Recovered *recording.RecoveryRecord // Set for KindRecovered
+}
+
+// GapHandler is called for each gap record met by Next.
+type GapHandler func(gap recording.GapRecord)
+
+// File reads a session file.
+type File struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+	line    int
+	eof     bool
+
+	meta      *recording.SessionMetadata
+	pending   []byte // Line read ahead, returned by the next call to next
+	truncated bool
+
+	// Message iteration
+	queue   []ws.WSMessage
+	assets  map[string]bool
+	markets map[string]bool // Markets of matched assets
+	types   map[string]bool
+	onGap   GapHandler
+}
+
+// Open opens a file and reads its metadata header, if any. Files ending in
+// .gz are decompressed.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+
+	r := &File{path: path, file: f}
+	var in io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		if r.gz, err = gzip.NewReader(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		in = r.gz
+	}
+	r.scanner = bufio.NewScanner(in)
+	r.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	if err := r.readHeader(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// readHeader consumes the metadata line. FileStorage files have none; their
+// first line is kept for Next.
+func (r *File) readHeader() error {
+	line, err := r.scan()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var header struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(line, &header) == nil && header.Type == recording.TypeMetadata {
+		var meta recording.SessionMetadata
+		if err := json.Unmarshal(line, &meta); err != nil {
+			return fmt.Errorf("%s:%d: invalid metadata: %w", r.path, r.line, err)
+		}
+		r.meta = &meta
+		return nil
+	}
+	r.pending = append([]byte(nil), line...)
+	return nil
+}
+
+// Metadata returns the session metadata, or nil for files without a
+// header, such as those of FileStorage.
+func (r *File) Metadata() *recording.SessionMetadata {
+	return r.meta
+}
+
+// Truncated reports whether the end of the file was cut off, as happens
+// when a session crashes, or the file was repaired by the startup recovery
+// pass. It is set once the end has been reached.
+func (r *File) Truncated() bool {
+	return r.truncated
+}
+
+// WithAssets makes Next return only messages for these assets. A
+// price_change matches if any of its changes does, and messages without an
+// asset ID match by the market of the assets seen so far.
+func (r *File) WithAssets(assetIDs ...string) *File {
+	r.assets = make(map[string]bool, len(assetIDs))
+	r.markets = make(map[string]bool)
+	for _, id := range assetIDs {
+		r.assets[id] = true
+	}
+	return r
+}
+
+// WithEventTypes makes Next return only messages of these event types.
+func (r *File) WithEventTypes(eventTypes ...string) *File {
+	r.types = make(map[string]bool, len(eventTypes))
+	for _, t := range eventTypes {
+		r.types[t] = true
+	}
+	return r
+}
+
+// OnGap sets a handler called when Next passes a gap record. Book state
+// does not carry across a gap.
+func (r *File) OnGap(handler GapHandler) *File {
+	r.onGap = handler
+	return r
+}
+
+// Next returns the next message that passes the filters, or io.EOF.
+// Messages from raw frames are stamped with the frame's receive time; use
+// Event for a typed view.
+func (r *File) Next() (ws.WSMessage, error) {
+	for {
+		for len(r.queue) > 0 {
+			msg := r.queue[0]
+			r.queue = r.queue[1:]
+			if r.match(msg) {
+				return msg, nil
+			}
+		}
+
+		rec, err := r.NextRecord()
+		if err != nil {
+			return ws.WSMessage{}, err
+		}
+		switch rec.Kind {
+		case KindMessage:
+			var msg ws.WSMessage
+			if err := json.Unmarshal(rec.Data, &msg); err != nil {
+				return ws.WSMessage{}, fmt.Errorf("%s:%d: invalid message: %w", r.path, rec.Line, err)
+			}
+			// Keep fields the model does not cover
+			msg.Raw = append(json.RawMessage(nil), rec.Data...)
+			r.queue = append(r.queue, msg)
+		case KindFrame:
+			messages, err := rec.Frame.Parse()
+			if err != nil {
+				log.Printf("%s:%d: skipping frame: %v", r.path, rec.Line, err)
+				continue
+			}
+			r.queue = append(r.queue, messages...)
+		case KindGap:
+			if r.onGap != nil {
+				r.onGap(*rec.Gap)
+			}
+		}
+	}
+}
+
+// match applies the asset and event type filters.
+func (r *File) match(msg ws.WSMessage) bool {
+	if r.types != nil && !r.types[msg.EventType] {
+		return false
+	}
+	if r.assets == nil {
+		return true
+	}
+
+	matched := r.assets[msg.AssetID]
+	for _, change := range msg.PriceChanges {
+		matched = matched || r.assets[change.AssetID]
+	}
+	if matched {
+		if msg.Market != "" {
+			r.markets[msg.Market] = true
+		}
+		return true
+	}
+	return msg.AssetID == "" && len(msg.PriceChanges) == 0 && r.markets[msg.Market]
+}
+
+// NextRecord returns the next record of any kind, or io.EOF. Filters do
+// not apply.
+func (r *File) NextRecord() (Record, error) {
+	line, err := r.next()
+	if err != nil {
+		return Record{}, err
+	}
+	lineNo := r.line
+
+	rec, err := decode(line)
+	if err != nil {
+		// A cut-off last line is part of a truncated tail, not an error
+		if _, nextErr := r.peek(); nextErr == io.EOF && (r.truncated || !r.eofNewline()) {
+			r.truncated = true
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("%s:%d: %w", r.path, lineNo, err)
+	}
+	rec.Line = lineNo
+	if rec.Kind == KindRecovered {
+		r.truncated = true
+	}
+	return rec, nil
+}
+
+// decode classifies a line.
+func decode(line []byte) (Record, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Record{}, fmt.Errorf("invalid record: %w", err)
+	}
+	rec := Record{Kind: KindOther, Data: line}
+
+	var recordType string
+	json.Unmarshal(fields["type"], &recordType)
+	rec.Type = recordType
+	switch {
+	case recordType == recording.TypeGap:
+		var gap recording.GapRecord
+		if err := json.Unmarshal(line, &gap); err != nil {
+			return Record{}, fmt.Errorf("invalid gap record: %w", err)
+		}
+		rec.Kind = KindGap
+		rec.Gap = &gap
+	case recordType == recording.TypeRecovered:
+		var recovered recording.RecoveryRecord
+		if err := json.Unmarshal(line, &recovered); err != nil {
+			return Record{}, fmt.Errorf("invalid recovered record: %w", err)
+		}
+		rec.Kind = KindRecovered
+		rec.Recovered = &recovered
+	case recordType != "":
+	case fields["raw"] != nil || fields["raw_b64"] != nil:
+		if err := rec.Frame.UnmarshalJSON(line); err != nil {
+			return Record{}, fmt.Errorf("invalid raw frame: %w", err)
+		}
+		rec.Kind = KindFrame
+	case fields["event_type"] != nil:
+		rec.Kind = KindMessage
+	}
+	return rec, nil
+}
+
+// next returns the next non-empty line.
+func (r *File) next() ([]byte, error) {
+	if r.pending != nil {
+		line := r.pending
+		r.pending = nil
+		return line, nil
+	}
+	for {
+		line, err := r.scan()
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// peek reads ahead one line, keeping it for next.
+func (r *File) peek() ([]byte, error) {
+	if r.pending != nil {
+		return r.pending, nil
+	}
+	line, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	r.pending = append([]byte(nil), line...)
+	return r.pending, nil
+}
+
+// scan reads one line. A gzip stream that ends early marks the file
+// truncated; everything before the cut is still returned.
+func (r *File) scan() ([]byte, error) {
+	if r.eof {
+		return nil, io.EOF
+	}
+	if r.scanner.Scan() {
+		r.line++
+		return r.scanner.Bytes(), nil
+	}
+
+	r.eof = true
+	err := r.scanner.Err()
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		log.Printf("%s is truncated after line %d", r.path, r.line)
+		r.truncated = true
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", r.path, err)
+	}
+	return nil, io.EOF
+}
+
+// eofNewline reports whether an uncompressed file ends with a newline, i.e.
+// whether its last line was written completely.
+func (r *File) eofNewline() bool {
+	if r.gz != nil {
+		return true
+	}
+	info, err := r.file.Stat()
+	if err != nil || info.Size() == 0 {
+		return true
+	}
+	last := make([]byte, 1)
+	if _, err := r.file.ReadAt(last, info.Size()-1); err != nil {
+		return true
+	}
+	return last[0] == '\n'
+}
+
+// Close closes the file.
+func (r *File) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	return r.file.Close()
+}
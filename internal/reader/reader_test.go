@@ -0,0 +1,328 @@
+package reader
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/storage"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+var session = []string{
+	`{"type":"metadata","series_slug":"eth-up-or-down-15m","market_id":"1338378","condition_id":"m","token_ids":["up","down"],"end_date":"2026-02-06T08:15:00Z","start_time":"2026-02-06T08:00:00Z"}`,
+	`{"event_type":"book","market":"m","asset_id":"up","timestamp":"1770364800000","bids":[{"price":"0.5","size":"10"}],"asks":[],"received_at":1770364800100000000}`,
+	`{"event_type":"book","market":"m","asset_id":"down","timestamp":"1770364800000","bids":[],"asks":[],"received_at":1770364800100000000}`,
+	`{"type":"gap","start":"2026-02-06T08:00:01Z","end":"2026-02-06T08:00:02Z","reason":"read_error"}`,
+	`{"type":"drift","asset_id":"up"}`,
+	`{"event_type":"price_change","market":"m","timestamp":"1770364802000","price_changes":[{"asset_id":"down","price":"0.5","size":"0","side":"BUY","hash":"h","best_bid":"","best_ask":""}]}`,
+	`{"event_type":"market_resolved","market":"m","timestamp":"1770365700000"}`,
+	`{"event_type":"book","market":"other","asset_id":"x","timestamp":"1770365700000","bids":[],"asks":[]}`,
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(name, ".gz") {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		io.WriteString(gz, content)
+		return path
+	}
+	io.WriteString(f, content)
+	return path
+}
+
+func lines(l []string) string {
+	return strings.Join(l, "\n") + "\n"
+}
+
+// eventTypes reads the remaining messages and returns "type:asset" for each.
+func eventTypes(t *testing.T, f *File) string {
+	t.Helper()
+	var got []string
+	for {
+		msg, err := f.Next()
+		if err == io.EOF {
+			return strings.Join(got, ",")
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		got = append(got, msg.EventType+":"+msg.AssetID)
+	}
+}
+
+func TestFile_Session(t *testing.T) {
+	for _, name := range []string{"s.jsonl", "s.jsonl.gz"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := Open(writeFile(t, name, lines(session)))
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer f.Close()
+
+			meta := f.Metadata()
+			if meta == nil || meta.MarketID != "1338378" || len(meta.TokenIDs) != 2 {
+				t.Fatalf("Metadata = %+v", meta)
+			}
+
+			var gaps []recording.GapRecord
+			f.OnGap(func(gap recording.GapRecord) { gaps = append(gaps, gap) })
+
+			first, err := f.Next()
+			if err != nil {
+				t.Fatalf("Next failed: %v", err)
+			}
+			if first.ReceivedAt != 1770364800100000000 {
+				t.Errorf("ReceivedAt = %d", first.ReceivedAt)
+			}
+			event, err := first.Event()
+			if err != nil {
+				t.Fatalf("Event failed: %v", err)
+			}
+			if book, ok := event.(*ws.BookEvent); !ok || len(book.Bids) != 1 {
+				t.Errorf("Event = %#v, want a book with one bid", event)
+			}
+
+			want := "book:down,price_change:,market_resolved:,book:x"
+			if got := eventTypes(t, f); got != want {
+				t.Errorf("messages = %s, want %s", got, want)
+			}
+			if len(gaps) != 1 || gaps[0].Reason != "read_error" {
+				t.Errorf("gaps = %+v", gaps)
+			}
+			if f.Truncated() {
+				t.Error("Truncated = true for a complete file")
+			}
+		})
+	}
+}
+
+func TestFile_Filters(t *testing.T) {
+	path := writeFile(t, "s.jsonl", lines(session))
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	f.WithAssets("down")
+	// Market events follow the asset's market
+	if got, want := eventTypes(t, f), "book:down,price_change:,market_resolved:"; got != want {
+		t.Errorf("asset filter = %s, want %s", got, want)
+	}
+	f.Close()
+
+	f, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	f.WithEventTypes(ws.EventTypeBook).WithAssets("up", "x")
+	if got, want := eventTypes(t, f), "book:up,book:x"; got != want {
+		t.Errorf("combined filter = %s, want %s", got, want)
+	}
+	f.Close()
+}
+
+func TestFile_RawFrames(t *testing.T) {
+	f, err := Open(writeFile(t, "raw.jsonl", lines([]string{
+		`{"type":"metadata","market_id":"1","token_ids":["up","down"],"raw":true}`,
+		`{"received_at":1770364800100000000,"raw":[{"event_type":"book","market":"m","asset_id":"up","timestamp":"1770364800000","bids":[],"asks":[]},{"event_type":"book","market":"m","asset_id":"down","timestamp":"1770364800000","bids":[],"asks":[]}]}`,
+		`{"received_at":1770364801000000000,"raw_b64":"bm90IGpzb24="}`,
+	})))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	if !f.Metadata().Raw {
+		t.Error("Expected raw metadata")
+	}
+	msg, err := f.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	// Messages from a frame are stamped with its receive time
+	if msg.ReceivedAt != 1770364800100000000 || msg.LatencyMs != 100 {
+		t.Errorf("ReceivedAt = %d, LatencyMs = %v", msg.ReceivedAt, msg.LatencyMs)
+	}
+	// The unparseable frame is skipped
+	if got := eventTypes(t, f); got != "book:down" {
+		t.Errorf("messages = %s, want book:down", got)
+	}
+}
+
+func TestFile_TruncatedGzip(t *testing.T) {
+	path := writeFile(t, "cut.jsonl.gz", lines(session))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-20], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if got := eventTypes(t, f); !strings.HasPrefix(got, "book:up,book:down") {
+		t.Errorf("messages = %s, want the records before the cut", got)
+	}
+	if !f.Truncated() {
+		t.Error("Truncated = false")
+	}
+}
+
+func TestFile_TruncatedLastLine(t *testing.T) {
+	content := lines(session[:3]) + session[3][:20]
+	f, err := Open(writeFile(t, "cut.jsonl", content))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if got := eventTypes(t, f); got != "book:up,book:down" {
+		t.Errorf("messages = %s", got)
+	}
+	if !f.Truncated() {
+		t.Error("Truncated = false")
+	}
+
+	// A bad line followed by more data is an error
+	f2, err := Open(writeFile(t, "bad.jsonl", lines([]string{session[1], "{", session[2]})))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f2.Close()
+	f2.Next()
+	if _, err := f2.Next(); err == nil || !strings.Contains(err.Error(), "bad.jsonl:2") {
+		t.Errorf("err = %v, want error at line 2", err)
+	}
+}
+
+func TestFile_FileStorage(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := storage.NewFileStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	fs.Write(&ws.WSMessage{EventType: ws.EventTypeBook, Market: "m", AssetID: "up", Timestamp: "1"})
+	fs.Write(&ws.WSMessage{EventType: ws.EventTypePriceChange, Market: "m", Timestamp: "2",
+		PriceChanges: []ws.PriceChange{{AssetID: "up", Price: "0.5", Size: "1", Side: "BUY"}}})
+	path := fs.CurrentPath()
+	fs.Close()
+
+	if !strings.HasPrefix(filepath.Base(path), "orderbook_") {
+		t.Fatalf("unexpected file name %s", path)
+	}
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if f.Metadata() != nil {
+		t.Error("Expected no metadata for a FileStorage file")
+	}
+	if got := eventTypes(t, f); got != "book:up,price_change:" {
+		t.Errorf("messages = %s", got)
+	}
+}
+
+func TestFile_KeepsUnknownFields(t *testing.T) {
+	msgs, err := ws.Parse([]byte(`{"event_type":"book","market":"m","asset_id":"up","timestamp":"1","bids":[],"asks":[],"tick_size":"0.01"}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	msgs[0].ReceivedAt = 100
+
+	dir := t.TempDir()
+	fs, err := storage.NewFileStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	fs.Write(&msgs[0])
+	path := fs.CurrentPath()
+	fs.Close()
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	msg, err := f.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if !strings.Contains(string(msg.Raw), `"tick_size":"0.01"`) {
+		t.Errorf("Raw = %s, want the unknown field", msg.Raw)
+	}
+
+	// Writing the message again keeps the field and the receive time once
+	msg.ReceivedAt = 200
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"tick_size":"0.01"`) || strings.Count(string(data), "received_at") != 1 ||
+		!strings.Contains(string(data), `"received_at":200`) {
+		t.Errorf("re-encoded = %s", data)
+	}
+}
+
+func TestFile_Empty(t *testing.T) {
+	f, err := Open(writeFile(t, "empty.jsonl", ""))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Next(); err != io.EOF {
+		t.Errorf("Next = %v, want io.EOF", err)
+	}
+}
+
+func TestFile_Recovered(t *testing.T) {
+	content := lines(append(session[:3:3], `{"type":"recovered","recovered_at":"2026-02-06T09:00:00Z","dropped_bytes":12}`))
+	f, err := Open(writeFile(t, "r.jsonl.gz", content))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if got := eventTypes(t, f); got != "book:up,book:down" {
+		t.Errorf("messages = %s", got)
+	}
+	if !f.Truncated() {
+		t.Error("Truncated = false for a recovered file")
+	}
+
+	f, err = Open(writeFile(t, "r2.jsonl.gz", content))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	var last Record
+	for {
+		rec, err := f.NextRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextRecord failed: %v", err)
+		}
+		last = rec
+	}
+	if last.Kind != KindRecovered || last.Recovered == nil || last.Recovered.DroppedBytes != 12 {
+		t.Errorf("last record = %+v, want the recovered record", last)
+	}
+}
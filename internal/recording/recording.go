@@ -0,0 +1,42 @@
+// Package recording defines the records that sessions write to their data
+// files besides feed messages, shared by the writers and the readers.
+package recording
+
+import "time"
+
+// Record types of the "type" field.
+const (
+	TypeMetadata  = "metadata"
+	TypeGap       = "gap"
+	TypeRecovered = "recovered"
+)
+
+// SessionMetadata is written at the start of each data file.
+type SessionMetadata struct {
+	Type        string    `json:"type"`
+	SeriesSlug  string    `json:"series_slug"`
+	MarketID    string    `json:"market_id"`
+	ConditionID string    `json:"condition_id"`
+	TokenIDs    []string  `json:"token_ids"`
+	EndDate     time.Time `json:"end_date"`
+	StartTime   time.Time `json:"start_time"`
+	Raw         bool      `json:"raw,omitempty"` // Records are raw frames
+}
+
+// GapRecord marks a period during which the session was not receiving the
+// feed. Book state across a gap is invalid; consumers should discard their
+// books and wait for the next snapshot.
+type GapRecord struct {
+	Type   string    `json:"type"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+}
+
+// RecoveryRecord is appended to a session file repaired after a crash.
+// Records after the last flush before the crash are lost.
+type RecoveryRecord struct {
+	Type         string    `json:"type"`
+	RecoveredAt  time.Time `json:"recovered_at"`
+	DroppedBytes int64     `json:"dropped_bytes"` // Incomplete trailing record
+}
@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// Playback speeds.
+const (
+	// RealTime replays frames with their original spacing.
+	RealTime = 1.0
+
+	// AsFastAsPossible replays frames without waiting between them.
+	AsFastAsPossible = 0.0
+)
+
+// FrameHandler is called for each frame played. Returning an error stops
+// playback.
+type FrameHandler func(frame ws.RawFrame) error
+
+// GapHandler is called for each gap in the recording.
+type GapHandler func(gap recording.GapRecord)
+
+// Stats counts what a player has played.
+type Stats struct {
+	Frames int64
+	Gaps   int64
+}
+
+// Player plays a source back at a given speed.
+type Player struct {
+	src   Source
+	speed float64
+	onGap GapHandler
+	stats Stats
+}
+
+// NewPlayer creates a player that replays src in real time.
+func NewPlayer(src Source) *Player {
+	return &Player{src: src, speed: RealTime}
+}
+
+// WithSpeed sets the playback speed as a multiple of real time: 1 keeps
+// the original spacing, 10 plays ten times faster and 0 does not wait at
+// all.
+func (p *Player) WithSpeed(speed float64) *Player {
+	if speed < 0 {
+		speed = AsFastAsPossible
+	}
+	p.speed = speed
+	return p
+}
+
+// OnGap sets the handler for gaps in the recording. Book state does not
+// carry across a gap; the recording has fresh snapshots after it.
+func (p *Player) OnGap(handler GapHandler) *Player {
+	p.onGap = handler
+	return p
+}
+
+// Stats returns what has been played so far. It must not be called while
+// Play is running.
+func (p *Player) Stats() Stats {
+	return p.stats
+}
+
+// Play calls handler for each frame of the source, paced by the original
+// receive times, until the source ends or ctx is cancelled. The source is
+// not closed.
+func (p *Player) Play(ctx context.Context, handler FrameHandler) error {
+	var first time.Time
+	start := time.Now()
+
+	for {
+		rec, err := p.src.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if first.IsZero() {
+			first = rec.At()
+		}
+		if err := p.wait(ctx, start, rec.At().Sub(first)); err != nil {
+			return err
+		}
+
+		if rec.Gap != nil {
+			p.stats.Gaps++
+			if p.onGap != nil {
+				p.onGap(*rec.Gap)
+			}
+			continue
+		}
+		p.stats.Frames++
+		if err := handler(rec.Frame); err != nil {
+			return err
+		}
+	}
+}
+
+// PlayTo parses each frame and passes the messages to handler, like a
+// ws.Client would. Messages keep their original receive times, so the
+// recorded latency is preserved. Frames that cannot be parsed are skipped.
+func (p *Player) PlayTo(ctx context.Context, handler ws.MessageHandler) error {
+	return p.Play(ctx, func(frame ws.RawFrame) error {
+		messages, err := frame.Parse()
+		if err != nil {
+			log.Printf("Error parsing recorded frame: %v", err)
+			return nil
+		}
+		if len(messages) > 0 {
+			handler(messages)
+		}
+		return nil
+	})
+}
+
+// wait sleeps until offset into the recording, scaled by the speed, has
+// elapsed since start.
+func (p *Player) wait(ctx context.Context, start time.Time, offset time.Duration) error {
+	if p.speed == AsFastAsPossible {
+		return ctx.Err()
+	}
+	delay := time.Until(start.Add(time.Duration(float64(offset) / p.speed)))
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package replay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// spaced is a recording with frames 100ms apart.
+var spaced = []string{
+	`{"event_type":"book","market":"m","asset_id":"up","received_at":1000000000}`,
+	`{"event_type":"book","market":"m","asset_id":"up","received_at":1100000000}`,
+	`{"event_type":"book","market":"m","asset_id":"up","received_at":1200000000}`,
+}
+
+func openRecording(t *testing.T, lines []string) Source {
+	t.Helper()
+	src, err := Open(writeRecording(t, "rec.jsonl", lines))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { src.Close() })
+	return src
+}
+
+func TestPlayer_PlayTo(t *testing.T) {
+	var gaps []recording.GapRecord
+	p := NewPlayer(openRecording(t, session)).
+		WithSpeed(AsFastAsPossible).
+		OnGap(func(gap recording.GapRecord) { gaps = append(gaps, gap) })
+
+	var messages []ws.WSMessage
+	if err := p.PlayTo(context.Background(), func(msgs []ws.WSMessage) {
+		messages = append(messages, msgs...)
+	}); err != nil {
+		t.Fatalf("PlayTo failed: %v", err)
+	}
+
+	if len(messages) != 3 || len(gaps) != 1 {
+		t.Fatalf("messages = %d, gaps = %d; want 3, 1", len(messages), len(gaps))
+	}
+	// Receive times are the recorded ones
+	if got := messages[0].ReceivedAt; got != 1770364800100000000 {
+		t.Errorf("ReceivedAt = %d", got)
+	}
+	if stats := p.Stats(); stats.Frames != 2 || stats.Gaps != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPlayer_Speed(t *testing.T) {
+	for _, tc := range []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{RealTime, 200 * time.Millisecond, time.Second},
+		{10, 20 * time.Millisecond, 150 * time.Millisecond},
+		{AsFastAsPossible, 0, 50 * time.Millisecond},
+	} {
+		p := NewPlayer(openRecording(t, spaced)).WithSpeed(tc.speed)
+		start := time.Now()
+		if err := p.Play(context.Background(), func(ws.RawFrame) error { return nil }); err != nil {
+			t.Fatalf("Play failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < tc.min || elapsed > tc.max {
+			t.Errorf("speed %v took %v, want %v-%v", tc.speed, elapsed, tc.min, tc.max)
+		}
+	}
+}
+
+func TestPlayer_Cancel(t *testing.T) {
+	p := NewPlayer(openRecording(t, []string{
+		`{"event_type":"book","market":"m","asset_id":"up","received_at":1000000000}`,
+		`{"event_type":"book","market":"m","asset_id":"up","received_at":3600000000000}`,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Play(ctx, func(ws.RawFrame) error { return nil }); err != context.DeadlineExceeded {
+		t.Errorf("Play = %v, want deadline exceeded", err)
+	}
+	if frames := p.Stats().Frames; frames != 1 {
+		t.Errorf("Frames = %d, want 1", frames)
+	}
+}
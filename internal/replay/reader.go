@@ -0,0 +1,244 @@
+// Package replay reads recorded market data and plays it back, either to a
+// ws.MessageHandler or to WebSocket clients through a local server that
+// speaks the market channel protocol.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/reader"
+	"github.com/johan/polymarket-collector/internal/recording"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// Record is one item of a recording: a frame as the server sent it, or a
+// gap in the recording.
+type Record struct {
+	Frame ws.RawFrame
+	Gap   *recording.GapRecord // Set for gap records; Frame is empty
+
+	message bool // Frame holds one parsed message record
+}
+
+// At returns the time the record was received.
+func (r Record) At() time.Time {
+	if r.Gap != nil {
+		return r.Gap.Start
+	}
+	return r.Frame.ReceivedAt
+}
+
+// Source yields records in order. Next returns io.EOF at the end.
+type Source interface {
+	Next() (Record, error)
+	Close() error
+}
+
+// Reader reads a JSONL or JSONL.gz file written by MarketSession or
+// FileStorage as a sequence of frames.
+//
+// Parsed messages received together are regrouped into a single frame, and
+// the local receive fields added by the collector are removed, so frames
+// look like the server's.
+type Reader struct {
+	file    *reader.File
+	pending *Record // Next record, read ahead while grouping messages
+}
+
+// OpenFile opens a recording. Files ending in .gz are decompressed.
+func OpenFile(path string) (*Reader, error) {
+	f, err := reader.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{file: f}, nil
+}
+
+// Open opens one or more recordings. Several files are merged by receive
+// time, e.g. to replay the markets of a series side by side.
+func Open(paths ...string) (Source, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no recordings given")
+	}
+	readers := make([]Source, 0, len(paths))
+	for _, path := range paths {
+		r, err := OpenFile(path)
+		if err != nil {
+			for _, opened := range readers {
+				opened.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, r)
+	}
+	if len(readers) == 1 {
+		return readers[0], nil
+	}
+	return Merge(readers...), nil
+}
+
+// Metadata returns the session metadata of the file. It is nil for files
+// without a metadata record, e.g. from FileStorage.
+func (r *Reader) Metadata() *recording.SessionMetadata {
+	return r.file.Metadata()
+}
+
+// Next returns the next record.
+func (r *Reader) Next() (Record, error) {
+	rec, err := r.pop()
+	if err != nil || !rec.message {
+		return rec, err
+	}
+
+	// Parsed messages that share a receive time came in one frame
+	group := [][]byte{rec.Frame.Data}
+	for {
+		next, err := r.pop()
+		if err != nil {
+			if err != io.EOF {
+				return Record{}, err
+			}
+			break
+		}
+		if !next.message || !next.Frame.ReceivedAt.Equal(rec.Frame.ReceivedAt) {
+			r.pending = &next
+			break
+		}
+		group = append(group, next.Frame.Data)
+	}
+	if len(group) > 1 {
+		rec.Frame.Data = append(append([]byte{'['}, bytes.Join(group, []byte{','})...), ']')
+	}
+	return rec, nil
+}
+
+// pop returns the next frame or gap, without grouping.
+func (r *Reader) pop() (Record, error) {
+	if r.pending != nil {
+		rec := *r.pending
+		r.pending = nil
+		return rec, nil
+	}
+
+	for {
+		rec, err := r.file.NextRecord()
+		if err != nil {
+			return Record{}, err
+		}
+		switch rec.Kind {
+		case reader.KindFrame:
+			return Record{Frame: rec.Frame}, nil
+		case reader.KindGap:
+			return Record{Gap: rec.Gap}, nil
+		case reader.KindMessage:
+			frame, err := messageFrame(rec.Data)
+			if err != nil {
+				return Record{}, fmt.Errorf("line %d: %w", rec.Line, err)
+			}
+			return Record{Frame: frame, message: true}, nil
+		}
+	}
+}
+
+// messageFrame turns a parsed message record back into the frame the
+// server sent, without the local receive fields.
+func messageFrame(line []byte) (ws.RawFrame, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return ws.RawFrame{}, fmt.Errorf("invalid message: %w", err)
+	}
+	receivedAt, err := receiveTime(fields)
+	if err != nil {
+		return ws.RawFrame{}, err
+	}
+	delete(fields, "received_at")
+	delete(fields, "latency_ms")
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ws.RawFrame{}, fmt.Errorf("encoding message: %w", err)
+	}
+	return ws.RawFrame{ReceivedAt: receivedAt, Data: data}, nil
+}
+
+// receiveTime returns the local receive time of a parsed message, falling
+// back to the exchange timestamp for messages recorded without one.
+func receiveTime(fields map[string]json.RawMessage) (time.Time, error) {
+	if raw, ok := fields["received_at"]; ok {
+		var ns int64
+		if err := json.Unmarshal(raw, &ns); err != nil {
+			return time.Time{}, fmt.Errorf("invalid received_at: %w", err)
+		}
+		return time.Unix(0, ns), nil
+	}
+
+	var ts string
+	json.Unmarshal(fields["timestamp"], &ts)
+	ms, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("message has neither received_at nor a valid timestamp")
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// Close closes the file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// merged interleaves several sources by receive time.
+type merged struct {
+	sources []Source
+	heads   []*Record
+	errs    []error
+}
+
+// Merge returns a source that yields the records of all sources ordered by
+// receive time. Each source must itself be in order.
+func Merge(sources ...Source) Source {
+	return &merged{
+		sources: sources,
+		heads:   make([]*Record, len(sources)),
+		errs:    make([]error, len(sources)),
+	}
+}
+
+func (m *merged) Next() (Record, error) {
+	best := -1
+	for i, src := range m.sources {
+		if m.heads[i] == nil && m.errs[i] == nil {
+			rec, err := src.Next()
+			if err != nil {
+				m.errs[i] = err
+				if err != io.EOF {
+					return Record{}, err
+				}
+				continue
+			}
+			m.heads[i] = &rec
+		}
+		if m.heads[i] != nil && (best < 0 || m.heads[i].At().Before(m.heads[best].At())) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return Record{}, io.EOF
+	}
+	rec := *m.heads[best]
+	m.heads[best] = nil
+	return rec, nil
+}
+
+func (m *merged) Close() error {
+	var firstErr error
+	for _, src := range m.sources {
+		if err := src.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
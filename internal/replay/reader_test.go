@@ -0,0 +1,188 @@
+package replay
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// session is a MarketSession file: metadata, a two-message frame, a gap,
+// a drift record and a single message.
+var session = []string{
+	`{"type":"metadata","series_slug":"eth-up-or-down-15m","market_id":"1338378","condition_id":"m","token_ids":["up","down"],"end_date":"2026-02-06T08:15:00Z","start_time":"2026-02-06T08:00:00Z"}`,
+	`{"event_type":"book","market":"m","asset_id":"up","timestamp":"1770364800000","bids":[{"price":"0.5","size":"10"}],"asks":[],"received_at":1770364800100000000,"latency_ms":100}`,
+	`{"event_type":"book","market":"m","asset_id":"down","timestamp":"1770364800000","bids":[],"asks":[],"received_at":1770364800100000000,"latency_ms":100}`,
+	`{"type":"gap","start":"2026-02-06T08:00:01Z","end":"2026-02-06T08:00:02Z","reason":"read_error"}`,
+	`{"type":"drift","asset_id":"up"}`,
+	`{"event_type":"price_change","market":"m","timestamp":"1770364802000","price_changes":[{"asset_id":"up","price":"0.5","size":"0","side":"BUY","hash":"h","best_bid":"","best_ask":""}],"received_at":1770364802050000000}`,
+}
+
+// rawSession is the same feed recorded in raw mode.
+var rawSession = []string{
+	`{"type":"metadata","series_slug":"eth-up-or-down-15m","market_id":"1338378","token_ids":["up","down"],"raw":true}`,
+	`{"received_at":1770364800100000000,"raw":[{"event_type":"book","market":"m","asset_id":"up","bids":[],"asks":[]}]}`,
+	`{"received_at":1770364801000000000,"raw_b64":"bm90IGpzb24="}`,
+	`{"received_at":1770364802050000000,"raw":{"event_type":"price_change","market":"m","price_changes":[]}}`,
+}
+
+func writeRecording(t *testing.T, name string, lines []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if strings.HasSuffix(name, ".gz") {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	for _, line := range lines {
+		io.WriteString(w, line+"\n")
+	}
+	return path
+}
+
+func readAll(t *testing.T, src Source) []Record {
+	t.Helper()
+	var records []Record
+	for {
+		rec, err := src.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestReader_ParsedSession(t *testing.T) {
+	for _, name := range []string{"session.jsonl", "session.jsonl.gz"} {
+		t.Run(name, func(t *testing.T) {
+			r, err := OpenFile(writeRecording(t, name, session))
+			if err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			defer r.Close()
+
+			records := readAll(t, r)
+			if len(records) != 3 {
+				t.Fatalf("records = %d, want 3", len(records))
+			}
+			if meta := r.Metadata(); meta == nil || meta.MarketID != "1338378" {
+				t.Errorf("Metadata = %+v", meta)
+			}
+
+			// The two snapshots are regrouped into one frame without the
+			// local receive fields
+			books, err := records[0].Frame.Parse()
+			if err != nil || len(books) != 2 {
+				t.Fatalf("first frame = %s (%v)", records[0].Frame.Data, err)
+			}
+			if strings.Contains(string(records[0].Frame.Data), "latency_ms") {
+				t.Errorf("frame kept local fields: %s", records[0].Frame.Data)
+			}
+			if want := time.Unix(0, 1770364800100000000); !records[0].At().Equal(want) {
+				t.Errorf("At = %v, want %v", records[0].At(), want)
+			}
+
+			if gap := records[1].Gap; gap == nil || gap.Reason != "read_error" {
+				t.Errorf("second record = %+v, want read_error gap", records[1])
+			}
+			if msgs, _ := records[2].Frame.Parse(); len(msgs) != 1 || msgs[0].EventType != "price_change" {
+				t.Errorf("third frame = %s", records[2].Frame.Data)
+			}
+		})
+	}
+}
+
+func TestReader_RawSession(t *testing.T) {
+	r, err := OpenFile(writeRecording(t, "raw.jsonl", rawSession))
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer r.Close()
+
+	records := readAll(t, r)
+	if len(records) != 3 {
+		t.Fatalf("records = %d, want 3", len(records))
+	}
+	if got := string(records[0].Frame.Data); got != `[{"event_type":"book","market":"m","asset_id":"up","bids":[],"asks":[]}]` {
+		t.Errorf("frame = %s, want it byte-exact", got)
+	}
+	if got := string(records[1].Frame.Data); got != "not json" {
+		t.Errorf("base64 frame = %q", got)
+	}
+}
+
+func TestReader_TruncatedGzip(t *testing.T) {
+	path := writeRecording(t, "cut.jsonl.gz", session)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop the gzip trailer, as after a crash
+	if err := os.WriteFile(path, data[:len(data)-8], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer r.Close()
+	if records := readAll(t, r); len(records) == 0 {
+		t.Error("Expected the records before the cut")
+	}
+}
+
+func TestReader_InvalidLine(t *testing.T) {
+	r, err := OpenFile(writeRecording(t, "bad.jsonl", []string{session[1], `{"event_type":`}))
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer r.Close()
+
+	_, err = r.Next()
+	if err == nil {
+		_, err = r.Next()
+	}
+	if err == nil || !strings.Contains(err.Error(), "bad.jsonl:2") {
+		t.Errorf("err = %v, want error at line 2", err)
+	}
+}
+
+func TestOpen_MergesByTime(t *testing.T) {
+	a := writeRecording(t, "a.jsonl", []string{
+		`{"event_type":"book","market":"a","asset_id":"a","received_at":1000}`,
+		`{"event_type":"book","market":"a","asset_id":"a","received_at":3000}`,
+	})
+	b := writeRecording(t, "b.jsonl", []string{
+		`{"event_type":"book","market":"b","asset_id":"b","received_at":2000}`,
+		`{"event_type":"book","market":"b","asset_id":"b","received_at":4000}`,
+	})
+
+	src, err := Open(a, b)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer src.Close()
+
+	var order []string
+	for _, rec := range readAll(t, src) {
+		msgs, _ := rec.Frame.Parse()
+		order = append(order, msgs[0].AssetID)
+	}
+	if got := strings.Join(order, ""); got != "abab" {
+		t.Errorf("order = %s, want abab", got)
+	}
+}
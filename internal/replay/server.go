@@ -0,0 +1,192 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// Server serves a recording over the market channel protocol, so code
+// written against ws.DefaultWSURL can run unchanged against history.
+//
+// Clients subscribe as usual and receive the recorded frames for their
+// assets; PINGs are answered with PONGs. Playback starts when the first
+// client subscribes and is shared by all clients, so a client that
+// connects late misses the snapshots sent before it subscribed.
+type Server struct {
+	player   *Player
+	upgrader websocket.Upgrader
+
+	mu         sync.Mutex
+	conns      map[*serverConn]struct{}
+	subscribed chan struct{} // Closed on the first subscription
+	once       sync.Once
+}
+
+// serverConn is one client connection.
+type serverConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+
+	// Guarded by Server.mu
+	assets  map[string]bool
+	markets map[string]bool // Learned from frames sent to the client
+}
+
+// NewServer creates a server that plays player's source.
+func NewServer(player *Player) *Server {
+	return &Server{
+		player:     player,
+		upgrader:   websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+		conns:      make(map[*serverConn]struct{}),
+		subscribed: make(chan struct{}),
+	}
+}
+
+// Connections returns the number of open client connections.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Run waits for the first subscription, then plays the recording to the
+// connected clients until it ends or ctx is cancelled. Connections stay
+// open afterwards.
+func (s *Server) Run(ctx context.Context) error {
+	select {
+	case <-s.subscribed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.player.Play(ctx, func(frame ws.RawFrame) error {
+		s.broadcast(frame.Data)
+		return nil
+	})
+}
+
+// ServeHTTP accepts a WebSocket client.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &serverConn{ws: conn, assets: make(map[string]bool), markets: make(map[string]bool)}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if string(data) == "PING" {
+			c.write([]byte("PONG"))
+			continue
+		}
+
+		var msg ws.SubscribeMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("Replay: ignoring invalid client message: %s", data)
+			continue
+		}
+		s.mu.Lock()
+		for _, assetID := range msg.AssetsIDs {
+			if msg.Operation == ws.OperationUnsubscribe {
+				delete(c.assets, assetID)
+			} else {
+				c.assets[assetID] = true
+			}
+		}
+		s.mu.Unlock()
+
+		if msg.Operation != ws.OperationUnsubscribe && len(msg.AssetsIDs) > 0 {
+			s.once.Do(func() { close(s.subscribed) })
+		}
+	}
+}
+
+// broadcast sends a frame to every client, keeping only the messages for
+// the client's assets. Frames that cannot be parsed are sent to everyone.
+func (s *Server) broadcast(data []byte) {
+	messages, err := ws.Parse(data)
+
+	s.mu.Lock()
+	type delivery struct {
+		conn *serverConn
+		data []byte
+	}
+	var out []delivery
+	for c := range s.conns {
+		if err != nil {
+			out = append(out, delivery{c, data})
+			continue
+		}
+		if frame := c.filter(data, messages); frame != nil {
+			out = append(out, delivery{c, frame})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range out {
+		d.conn.write(d.data)
+	}
+}
+
+// filter returns the part of a frame the client subscribed to, or nil.
+// The frame is returned unchanged if every message is wanted. Must be
+// called with Server.mu held.
+func (c *serverConn) filter(data []byte, messages []ws.WSMessage) []byte {
+	var keep [][]byte
+	for _, msg := range messages {
+		if c.wants(msg) {
+			if msg.Market != "" {
+				c.markets[msg.Market] = true
+			}
+			keep = append(keep, msg.Raw)
+		}
+	}
+	switch {
+	case len(keep) == 0:
+		return nil
+	case len(keep) == len(messages):
+		return data
+	default:
+		return append(append([]byte{'['}, bytes.Join(keep, []byte{','})...), ']')
+	}
+}
+
+// wants reports whether a message concerns one of the client's assets.
+// Messages without an asset ID are matched by market.
+func (c *serverConn) wants(msg ws.WSMessage) bool {
+	if msg.AssetID != "" {
+		return c.assets[msg.AssetID]
+	}
+	for _, change := range msg.PriceChanges {
+		if c.assets[change.AssetID] {
+			return true
+		}
+	}
+	return len(msg.PriceChanges) == 0 && c.markets[msg.Market]
+}
+
+func (c *serverConn) write(data []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.WriteMessage(websocket.TextMessage, data)
+}
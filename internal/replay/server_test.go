@@ -0,0 +1,77 @@
+package replay
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+func TestServer_PlaysToSubscribers(t *testing.T) {
+	p := NewPlayer(openRecording(t, []string{
+		`{"event_type":"book","market":"m","asset_id":"up","received_at":1000}`,
+		`{"event_type":"book","market":"m","asset_id":"down","received_at":1000}`,
+		`{"event_type":"tick_size_change","market":"m","received_at":2000}`,
+		`{"event_type":"book","market":"other","asset_id":"x","received_at":3000}`,
+	})).WithSpeed(AsFastAsPossible)
+	srv := NewServer(p)
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	var mu sync.Mutex
+	var got []string
+	client := ws.NewWSClient(func(messages []ws.WSMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range messages {
+			got = append(got, msg.EventType+":"+msg.AssetID)
+		}
+	}).WithURL("ws" + strings.TrimPrefix(hs.URL, "http"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+	if err := client.Subscribe([]string{"up"}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	if err := srv.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Only the subscribed asset, and market events for its market
+	want := "book:up,tick_size_change:"
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		joined := strings.Join(got, ",")
+		mu.Unlock()
+		if joined == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %s, want %s", joined, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := srv.Connections(); n != 1 {
+		t.Errorf("Connections = %d, want 1", n)
+	}
+}
+
+func TestServer_RunWaitsForSubscription(t *testing.T) {
+	srv := NewServer(NewPlayer(openRecording(t, spaced)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run = %v, want deadline exceeded", err)
+	}
+}
@@ -21,6 +21,7 @@ type FileStorage struct {
 	currentPath  string
 	lastRotation time.Time
 	messageCount int64
+	bytesWritten int64
 }
 
 // NewFileStorage creates a new file storage.
@@ -43,6 +44,24 @@ func NewFileStorage(outputDir string, rotationInterval time.Duration) (*FileStor
 
 // Write writes a message to the current file.
 func (s *FileStorage) Write(msg *ws.WSMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshaling message: %w", err)
+	}
+	return s.writeLine(data)
+}
+
+// WriteRaw writes a raw frame to the current file, keeping the frame bytes unchanged.
+func (s *FileStorage) WriteRaw(frame ws.RawFrame) error {
+	data, err := frame.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("marshaling frame: %w", err)
+	}
+	return s.writeLine(data)
+}
+
+// writeLine appends a single JSONL record, rotating the file first if needed.
+func (s *FileStorage) writeLine(data []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -53,11 +72,6 @@ func (s *FileStorage) Write(msg *ws.WSMessage) error {
 		}
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("marshaling message: %w", err)
-	}
-
 	if _, err := s.currentFile.Write(data); err != nil {
 		return fmt.Errorf("writing message: %w", err)
 	}
@@ -66,6 +80,7 @@ func (s *FileStorage) Write(msg *ws.WSMessage) error {
 	}
 
 	s.messageCount++
+	s.bytesWritten += int64(len(data)) + 1
 	return nil
 }
 
@@ -109,6 +124,13 @@ func (s *FileStorage) CurrentPath() string {
 	return s.currentPath
 }
 
+// BytesWritten returns the number of bytes written to all files.
+func (s *FileStorage) BytesWritten() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytesWritten
+}
+
 // MessageCount returns the number of messages written to the current file.
 func (s *FileStorage) MessageCount() int64 {
 	s.mu.Lock()
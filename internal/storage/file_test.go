@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+func TestFileStorage_WriteRaw(t *testing.T) {
+	dir := t.TempDir()
+	stor, err := NewFileStorage(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	frame := []byte(`[{"event_type":"book","asset_id":"1", "unknown_field":true}]`)
+	if err := stor.WriteRaw(ws.RawFrame{ReceivedAt: time.Unix(0, 42), Data: frame}); err != nil {
+		t.Fatalf("WriteRaw failed: %v", err)
+	}
+	if err := stor.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(stor.CurrentPath())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := `{"received_at":42,"raw":` + string(frame) + "}\n"
+	if string(data) != want {
+		t.Errorf("File contents = %q, want %q", data, want)
+	}
+	if n := stor.BytesWritten(); n != int64(len(data)) {
+		t.Errorf("BytesWritten = %d, want file size %d", n, len(data))
+	}
+}
+
+func TestFileStorage_Write(t *testing.T) {
+	dir := t.TempDir()
+	stor, err := NewFileStorage(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+
+	msg := &ws.WSMessage{EventType: ws.EventTypeBook, AssetID: "1", Timestamp: "1000"}
+	if err := stor.Write(msg); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if stor.MessageCount() != 1 {
+		t.Errorf("MessageCount = %d, want 1", stor.MessageCount())
+	}
+	stor.Close()
+
+	data, err := os.ReadFile(stor.CurrentPath())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), `{"event_type":"book"`) {
+		t.Errorf("Unexpected file contents: %s", data)
+	}
+}
@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/johan/polymarket-collector/internal/config"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// Retry backoff while the broker is unavailable.
+const (
+	kafkaInitialBackoff = 500 * time.Millisecond
+	kafkaMaxBackoff     = 30 * time.Second
+)
+
+// kafkaWriter is the part of kafka.Writer used by KafkaStorage.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaStorage publishes messages to a Kafka (or Redpanda) topic.
+//
+// Write never blocks on the network: messages go into a bounded local
+// buffer that a background goroutine publishes in batches. While the broker
+// is unavailable, messages accumulate in the buffer and are retried with
+// backoff; once the buffer is full the oldest messages are dropped.
+type KafkaStorage struct {
+	writer     kafkaWriter
+	keyBy      string
+	batchSize  int
+	bufferSize int
+	timeout    time.Duration
+
+	mu     sync.Mutex
+	buffer []kafka.Message
+	closed bool
+	notify chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	published int64
+	dropped   int64
+	failures  int64
+}
+
+// NewKafkaStorage creates a Kafka storage. Brokers are contacted lazily,
+// so this succeeds even if they are not reachable yet.
+func NewKafkaStorage(cfg config.KafkaConfig) (*KafkaStorage, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka brokers and topic are required")
+	}
+
+	acks, err := kafkaAcks(cfg.Acks)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	batchTimeout := cfg.BatchTimeout
+	if batchTimeout <= 0 {
+		batchTimeout = 100 * time.Millisecond
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Murmur2Balancer{}, // Same partitioning as the Java client
+		BatchSize:    batchSize,
+		BatchTimeout: batchTimeout,
+		RequiredAcks: acks,
+		MaxAttempts:  1, // Retries are handled by publishLoop
+	}
+
+	return newKafkaStorage(writer, cfg.KeyBy, batchSize, cfg.BufferSize), nil
+}
+
+// newKafkaStorage wires a storage around a writer and starts publishing.
+func newKafkaStorage(writer kafkaWriter, keyBy string, batchSize, bufferSize int) *KafkaStorage {
+	if bufferSize <= 0 {
+		bufferSize = 100000
+	}
+	if bufferSize < batchSize {
+		bufferSize = batchSize
+	}
+
+	s := &KafkaStorage{
+		writer:     writer,
+		keyBy:      keyBy,
+		batchSize:  batchSize,
+		bufferSize: bufferSize,
+		timeout:    10 * time.Second,
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.publishLoop()
+
+	return s
+}
+
+// kafkaAcks maps the configured acks to the Kafka RequiredAcks value.
+func kafkaAcks(acks string) (kafka.RequiredAcks, error) {
+	switch acks {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "leader":
+		return kafka.RequireOne, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("invalid kafka acks: %s", acks)
+	}
+}
+
+// Write encodes a message and queues it for publishing. With key_by
+// asset_id, a price_change touching several assets is split into one
+// record per asset so each lands on the same partition as that asset's
+// book snapshots.
+func (s *KafkaStorage) Write(msg *ws.WSMessage) error {
+	records := []*ws.WSMessage{msg}
+	if s.keyBy == "asset_id" && msg.EventType == ws.EventTypePriceChange {
+		var err error
+		if records, err = splitPriceChange(msg); err != nil {
+			return err
+		}
+	}
+
+	batch := make([]kafka.Message, 0, len(records))
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("marshaling message: %w", err)
+		}
+		batch = append(batch, kafka.Message{Key: []byte(s.key(rec)), Value: data})
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("kafka storage is closed")
+	}
+	s.enqueue(batch...)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// key returns the partition key for a message. A price_change has no
+// top-level asset_id; after splitting it is keyed by the asset of its
+// changes. Messages without any asset fall back to the market.
+func (s *KafkaStorage) key(msg *ws.WSMessage) string {
+	if s.keyBy == "asset_id" {
+		if msg.AssetID != "" {
+			return msg.AssetID
+		}
+		if len(msg.PriceChanges) > 0 && msg.PriceChanges[0].AssetID != "" {
+			return msg.PriceChanges[0].AssetID
+		}
+	}
+	return msg.Market
+}
+
+// splitPriceChange splits a price_change into one message per asset,
+// in order of first appearance. Unmodelled fields of the raw JSON are kept
+// on every part; only price_changes is narrowed to the part's asset.
+func splitPriceChange(msg *ws.WSMessage) ([]*ws.WSMessage, error) {
+	var assets []string
+	groups := make(map[string][]int)
+	for i, pc := range msg.PriceChanges {
+		if _, ok := groups[pc.AssetID]; !ok {
+			assets = append(assets, pc.AssetID)
+		}
+		groups[pc.AssetID] = append(groups[pc.AssetID], i)
+	}
+	if len(assets) <= 1 {
+		return []*ws.WSMessage{msg}, nil
+	}
+
+	var fields map[string]json.RawMessage
+	var rawChanges []json.RawMessage
+	if len(msg.Raw) > 0 {
+		if err := json.Unmarshal(msg.Raw, &fields); err != nil {
+			return nil, fmt.Errorf("decoding price_change: %w", err)
+		}
+		if err := json.Unmarshal(fields["price_changes"], &rawChanges); err != nil {
+			return nil, fmt.Errorf("decoding price_changes: %w", err)
+		}
+		if len(rawChanges) != len(msg.PriceChanges) {
+			return nil, fmt.Errorf("price_changes has %d raw entries, %d parsed", len(rawChanges), len(msg.PriceChanges))
+		}
+	}
+
+	parts := make([]*ws.WSMessage, 0, len(assets))
+	for _, asset := range assets {
+		part := *msg
+		part.PriceChanges = make([]ws.PriceChange, 0, len(groups[asset]))
+		partRaw := make([]json.RawMessage, 0, len(groups[asset]))
+		for _, i := range groups[asset] {
+			part.PriceChanges = append(part.PriceChanges, msg.PriceChanges[i])
+			if rawChanges != nil {
+				partRaw = append(partRaw, rawChanges[i])
+			}
+		}
+
+		if fields != nil {
+			changes, err := json.Marshal(partRaw)
+			if err != nil {
+				return nil, fmt.Errorf("encoding price_changes: %w", err)
+			}
+			partFields := maps.Clone(fields)
+			partFields["price_changes"] = changes
+			if part.Raw, err = json.Marshal(partFields); err != nil {
+				return nil, fmt.Errorf("encoding price_change: %w", err)
+			}
+		}
+		parts = append(parts, &part)
+	}
+	return parts, nil
+}
+
+// enqueue appends messages to the buffer, dropping the oldest ones if it
+// overflows. The caller must hold s.mu.
+func (s *KafkaStorage) enqueue(msgs ...kafka.Message) {
+	s.buffer = append(s.buffer, msgs...)
+	if over := len(s.buffer) - s.bufferSize; over > 0 {
+		s.buffer = append(s.buffer[:0], s.buffer[over:]...)
+		s.dropped += int64(over)
+	}
+}
+
+// requeue puts a failed batch back at the front of the buffer so ordering
+// is preserved, dropping the oldest messages if the buffer overflows.
+func (s *KafkaStorage) requeue(batch []kafka.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buffer = append(batch, s.buffer...)
+	if over := len(s.buffer) - s.bufferSize; over > 0 {
+		s.buffer = s.buffer[over:]
+		s.dropped += int64(over)
+	}
+}
+
+// take removes up to batchSize messages from the front of the buffer.
+func (s *KafkaStorage) take() []kafka.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(len(s.buffer), s.batchSize)
+	if n == 0 {
+		return nil
+	}
+	batch := make([]kafka.Message, n)
+	copy(batch, s.buffer)
+	s.buffer = s.buffer[n:]
+	return batch
+}
+
+// publishLoop publishes buffered messages until the storage is closed.
+func (s *KafkaStorage) publishLoop() {
+	defer s.wg.Done()
+
+	backoff := kafkaInitialBackoff
+	for {
+		batch := s.take()
+		if batch == nil {
+			select {
+			case <-s.done:
+				return
+			case <-s.notify:
+				continue
+			}
+		}
+
+		if err := s.publish(batch); err != nil {
+			s.requeue(batch)
+			log.Printf("Kafka publish failed (%d messages buffered), retrying in %v: %v", s.Buffered(), backoff, err)
+
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, kafkaMaxBackoff)
+			continue
+		}
+		backoff = kafkaInitialBackoff
+	}
+}
+
+// publish sends a batch and updates the counters.
+func (s *KafkaStorage) publish(batch []kafka.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	err := s.writer.WriteMessages(ctx, batch...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failures++
+		return err
+	}
+	s.published += int64(len(batch))
+	return nil
+}
+
+// Close publishes what is left in the buffer (one attempt per batch) and
+// closes the writer. Messages that still cannot be published are dropped.
+// Writes after Close return an error.
+func (s *KafkaStorage) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.done)
+		s.wg.Wait()
+
+		for batch := s.take(); batch != nil; batch = s.take() {
+			if err := s.publish(batch); err != nil {
+				s.mu.Lock()
+				s.dropped += int64(len(batch) + len(s.buffer))
+				s.buffer = nil
+				s.mu.Unlock()
+				s.closeErr = fmt.Errorf("flushing kafka buffer: %w", err)
+				break
+			}
+		}
+
+		if err := s.writer.Close(); err != nil && s.closeErr == nil {
+			s.closeErr = fmt.Errorf("closing kafka writer: %w", err)
+		}
+	})
+	return s.closeErr
+}
+
+// Buffered returns the number of messages waiting to be published.
+func (s *KafkaStorage) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buffer)
+}
+
+// Published returns the number of messages acknowledged by the broker.
+func (s *KafkaStorage) Published() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.published
+}
+
+// Dropped returns the number of messages discarded because the buffer overflowed.
+func (s *KafkaStorage) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Failures returns the number of failed publish attempts.
+func (s *KafkaStorage) Failures() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// fakeKafkaWriter records published messages and fails while down is set.
+type fakeKafkaWriter struct {
+	mu       sync.Mutex
+	down     bool
+	messages []kafka.Message
+	closed   bool
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.down {
+		return errors.New("broker unavailable")
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeKafkaWriter) setDown(down bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.down = down
+}
+
+func (w *fakeKafkaWriter) published() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKafkaStorage_Keys(t *testing.T) {
+	for _, tc := range []struct {
+		keyBy string
+		msg   ws.WSMessage
+		want  string
+	}{
+		{"market", ws.WSMessage{EventType: "book", Market: "m1", AssetID: "a1"}, "m1"},
+		{"asset_id", ws.WSMessage{EventType: "book", Market: "m1", AssetID: "a1"}, "a1"},
+		{"asset_id", ws.WSMessage{EventType: "price_change", Market: "m1"}, "m1"},
+		{"asset_id", ws.WSMessage{EventType: "price_change", Market: "m1", PriceChanges: []ws.PriceChange{{AssetID: "a1"}}}, "a1"},
+	} {
+		w := &fakeKafkaWriter{}
+		s := newKafkaStorage(w, tc.keyBy, 10, 100)
+		if err := s.Write(&tc.msg); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		msgs := w.published()
+		if len(msgs) != 1 || string(msgs[0].Key) != tc.want {
+			t.Errorf("key_by %s: published %v, want key %s", tc.keyBy, msgs, tc.want)
+		}
+		if !w.closed {
+			t.Error("Expected writer to be closed")
+		}
+	}
+}
+
+func TestKafkaStorage_AssetKeyFollowsBook(t *testing.T) {
+	frame := []byte(`[
+		{"event_type":"book","market":"m1","asset_id":"a1","timestamp":"1","bids":[],"asks":[]},
+		{"event_type":"price_change","market":"m1","timestamp":"2","extra":"x","price_changes":[
+			{"asset_id":"a1","price":"0.5","size":"1","side":"BUY","hash":"h1"},
+			{"asset_id":"a2","price":"0.5","size":"2","side":"SELL","hash":"h2"},
+			{"asset_id":"a1","price":"0.6","size":"3","side":"BUY","hash":"h3"}]}
+	]`)
+	msgs, err := ws.Parse(frame)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	w := &fakeKafkaWriter{}
+	s := newKafkaStorage(w, "asset_id", 10, 100)
+	for i := range msgs {
+		if err := s.Write(&msgs[i]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	published := w.published()
+	if len(published) != 3 {
+		t.Fatalf("published %d records, want 3 (book + one price_change per asset)", len(published))
+	}
+
+	var book ws.WSMessage
+	if err := json.Unmarshal(published[0].Value, &book); err != nil {
+		t.Fatalf("decoding book: %v", err)
+	}
+	for _, rec := range published[1:] {
+		var change ws.WSMessage
+		if err := json.Unmarshal(rec.Value, &change); err != nil {
+			t.Fatalf("decoding price_change: %v", err)
+		}
+		for _, pc := range change.PriceChanges {
+			if pc.AssetID != string(rec.Key) {
+				t.Errorf("record keyed %s contains change for %s", rec.Key, pc.AssetID)
+			}
+		}
+		if !strings.Contains(string(rec.Value), `"extra":"x"`) {
+			t.Errorf("record lost unmodelled fields: %s", rec.Value)
+		}
+	}
+
+	if string(published[1].Key) != book.AssetID {
+		t.Errorf("price_change key = %s, want book key %s", published[1].Key, book.AssetID)
+	}
+	var a1 ws.WSMessage
+	json.Unmarshal(published[1].Value, &a1)
+	if len(a1.PriceChanges) != 2 || a1.PriceChanges[1].Hash != "h3" {
+		t.Errorf("a1 changes = %+v, want h1 and h3 in order", a1.PriceChanges)
+	}
+	if string(published[2].Key) != "a2" {
+		t.Errorf("second price_change key = %s, want a2", published[2].Key)
+	}
+}
+
+func TestKafkaStorage_RetriesInOrder(t *testing.T) {
+	w := &fakeKafkaWriter{down: true}
+	s := newKafkaStorage(w, "market", 2, 100)
+
+	for _, market := range []string{"m1", "m2", "m3"} {
+		if err := s.Write(&ws.WSMessage{EventType: "book", Market: market}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	waitFor(t, func() bool { return s.Failures() > 0 })
+	w.setDown(false)
+	waitFor(t, func() bool { return s.Published() == 3 })
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	msgs := w.published()
+	for i, want := range []string{"m1", "m2", "m3"} {
+		if string(msgs[i].Key) != want {
+			t.Errorf("message %d key = %s, want %s", i, msgs[i].Key, want)
+		}
+	}
+	if s.Dropped() != 0 {
+		t.Errorf("Dropped = %d, want 0", s.Dropped())
+	}
+}
+
+func TestKafkaStorage_BufferOverflow(t *testing.T) {
+	w := &fakeKafkaWriter{down: true}
+	s := newKafkaStorage(w, "market", 1, 2)
+
+	for _, market := range []string{"m1", "m2", "m3", "m4"} {
+		if err := s.Write(&ws.WSMessage{EventType: "book", Market: market}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	waitFor(t, func() bool { return s.Dropped() == 2 })
+
+	w.setDown(false)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	msgs := w.published()
+	if len(msgs) != 2 || string(msgs[0].Key) != "m3" || string(msgs[1].Key) != "m4" {
+		t.Errorf("published %v, want the two newest messages", msgs)
+	}
+}
+
+func TestKafkaStorage_CloseWhileDown(t *testing.T) {
+	w := &fakeKafkaWriter{down: true}
+	s := newKafkaStorage(w, "market", 10, 100)
+
+	if err := s.Write(&ws.WSMessage{EventType: "book", Market: "m1"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	waitFor(t, func() bool { return s.Failures() > 0 })
+
+	if err := s.Close(); err == nil {
+		t.Error("Expected error when closing with an unreachable broker")
+	}
+	if s.Dropped() != 1 || s.Buffered() != 0 {
+		t.Errorf("Dropped = %d, Buffered = %d, want 1 and 0", s.Dropped(), s.Buffered())
+	}
+}
+
+func TestKafkaStorage_WriteAfterClose(t *testing.T) {
+	w := &fakeKafkaWriter{}
+	s := newKafkaStorage(w, "market", 10, 100)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if err := s.Write(&ws.WSMessage{EventType: "book", Market: "m1"}); err == nil {
+		t.Error("Expected error writing after Close")
+	}
+	if s.Buffered() != 0 {
+		t.Errorf("Buffered = %d, want 0", s.Buffered())
+	}
+}
+
+func TestKafkaAcks(t *testing.T) {
+	for acks, want := range map[string]kafka.RequiredAcks{"all": kafka.RequireAll, "leader": kafka.RequireOne, "none": kafka.RequireNone} {
+		got, err := kafkaAcks(acks)
+		if err != nil || got != want {
+			t.Errorf("kafkaAcks(%q) = %d, %v; want %d", acks, got, err, want)
+		}
+	}
+	if _, err := kafkaAcks("2"); err == nil {
+		t.Error("Expected error for invalid acks")
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// multiErrorLogInterval is the minimum time between write error logs of a
+// sink, so a dead sink does not flood the log.
+const multiErrorLogInterval = 10 * time.Second
+
+// Sink is a named storage backend used by MultiStorage.
+type Sink struct {
+	Name    string
+	Storage Storage
+}
+
+// SinkStats are the counters of a single sink.
+type SinkStats struct {
+	Name    string `json:"name"`
+	Written int64  `json:"written"`
+	Errors  int64  `json:"errors"`
+	Dropped int64  `json:"dropped"` // Discarded because the sink's queue was full
+	Queued  int    `json:"queued"`
+}
+
+// sinkItem is a queued message or raw frame.
+type sinkItem struct {
+	msg   *ws.WSMessage
+	frame *ws.RawFrame
+}
+
+// sinkQueue feeds a single sink from its own goroutine.
+type sinkQueue struct {
+	Sink
+	queue chan sinkItem
+	done  chan struct{}
+
+	written atomic.Int64
+	errors  atomic.Int64
+	dropped atomic.Int64
+
+	// Owned by run
+	errorsSince  int64
+	lastErrorLog time.Time
+}
+
+// MultiStorage writes every message to several backends.
+//
+// Each sink has its own bounded queue and goroutine, so a slow or failing
+// sink never blocks the caller or the other sinks. When a sink's queue is
+// full, messages for that sink are dropped and counted. Messages must not be
+// modified after they are passed to Write.
+type MultiStorage struct {
+	sinks []*sinkQueue
+
+	mu     sync.RWMutex // Held for reading while enqueuing
+	closed bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewMultiStorage creates a fan-out storage and starts a writer per sink.
+func NewMultiStorage(queueSize int, sinks ...Sink) *MultiStorage {
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+
+	m := &MultiStorage{}
+	for _, sink := range sinks {
+		q := &sinkQueue{
+			Sink:  sink,
+			queue: make(chan sinkItem, queueSize),
+			done:  make(chan struct{}),
+		}
+		m.sinks = append(m.sinks, q)
+		go q.run()
+	}
+	return m
+}
+
+// Write queues a message for every sink. It never blocks.
+func (m *MultiStorage) Write(msg *ws.WSMessage) error {
+	return m.enqueue(sinkItem{msg: msg})
+}
+
+// WriteRaw queues a raw frame for every sink. It never blocks.
+// Sinks that do not support raw frames count it as an error.
+func (m *MultiStorage) WriteRaw(frame ws.RawFrame) error {
+	return m.enqueue(sinkItem{frame: &frame})
+}
+
+// enqueue offers an item to every sink queue. It fails once the storage is
+// closed, since the queues are closed then.
+func (m *MultiStorage) enqueue(item sinkItem) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return errors.New("multi storage is closed")
+	}
+	for _, q := range m.sinks {
+		select {
+		case q.queue <- item:
+		default:
+			q.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Close drains every queue and closes all sinks. Writes after Close
+// return an error.
+func (m *MultiStorage) Close() error {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		m.closed = true
+		for _, q := range m.sinks {
+			close(q.queue)
+		}
+		m.mu.Unlock()
+
+		var errs []error
+		for _, q := range m.sinks {
+			<-q.done
+			if err := q.Storage.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing sink %s: %w", q.Name, err))
+			}
+		}
+		m.closeErr = errors.Join(errs...)
+	})
+	return m.closeErr
+}
+
+// Stats returns the counters of every sink, in configuration order.
+func (m *MultiStorage) Stats() []SinkStats {
+	stats := make([]SinkStats, len(m.sinks))
+	for i, q := range m.sinks {
+		stats[i] = SinkStats{
+			Name:    q.Name,
+			Written: q.written.Load(),
+			Errors:  q.errors.Load(),
+			Dropped: q.dropped.Load(),
+			Queued:  len(q.queue),
+		}
+	}
+	return stats
+}
+
+// BytesWritten returns the bytes written by the sinks that count them.
+func (m *MultiStorage) BytesWritten() int64 {
+	var n int64
+	for _, q := range m.sinks {
+		if c, ok := q.Storage.(ByteCounter); ok {
+			n += c.BytesWritten()
+		}
+	}
+	return n
+}
+
+// run writes queued items to the sink until the queue is closed.
+func (q *sinkQueue) run() {
+	defer close(q.done)
+
+	for item := range q.queue {
+		var err error
+		if item.frame != nil {
+			rawWriter, ok := q.Storage.(RawWriter)
+			if !ok {
+				err = errors.New("raw frames not supported")
+			} else {
+				err = rawWriter.WriteRaw(*item.frame)
+			}
+		} else {
+			err = q.Storage.Write(item.msg)
+		}
+
+		if err != nil {
+			q.logError(err)
+			continue
+		}
+		q.written.Add(1)
+	}
+}
+
+// logError counts a failed write and logs it at most once per
+// multiErrorLogInterval.
+func (q *sinkQueue) logError(err error) {
+	total := q.errors.Add(1)
+	q.errorsSince++
+	if time.Since(q.lastErrorLog) < multiErrorLogInterval {
+		return
+	}
+	log.Printf("Error writing to sink %s (%d errors since last report, %d total): %v", q.Name, q.errorsSince, total, err)
+	q.errorsSince = 0
+	q.lastErrorLog = time.Now()
+}
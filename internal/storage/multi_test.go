@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// recordingStorage records messages and can fail or block on demand.
+type recordingStorage struct {
+	mu       sync.Mutex
+	messages []*ws.WSMessage
+	fail     bool
+	block    chan struct{} // Write waits on this channel if set
+	closed   bool
+}
+
+func (s *recordingStorage) Write(msg *ws.WSMessage) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("write failed")
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *recordingStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestMultiStorage_FanOut(t *testing.T) {
+	a, b := &recordingStorage{}, &recordingStorage{}
+	m := NewMultiStorage(10, Sink{"a", a}, Sink{"b", b})
+
+	for i := 0; i < 3; i++ {
+		if err := m.Write(&ws.WSMessage{EventType: "book"}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for _, s := range []*recordingStorage{a, b} {
+		if len(s.messages) != 3 || !s.closed {
+			t.Errorf("sink got %d messages (closed=%v), want 3 and closed", len(s.messages), s.closed)
+		}
+	}
+	for _, st := range m.Stats() {
+		if st.Written != 3 || st.Errors != 0 || st.Dropped != 0 {
+			t.Errorf("stats = %+v", st)
+		}
+	}
+}
+
+func TestMultiStorage_BytesWritten(t *testing.T) {
+	file, err := NewFileStorage(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	m := NewMultiStorage(10, Sink{"file", file}, Sink{"other", &recordingStorage{}})
+
+	if err := m.Write(&ws.WSMessage{EventType: "book", AssetID: "1"}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	info, err := os.Stat(file.CurrentPath())
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if n := m.BytesWritten(); n != info.Size() {
+		t.Errorf("BytesWritten = %d, want file size %d", n, info.Size())
+	}
+}
+
+func TestMultiStorage_WriteAfterClose(t *testing.T) {
+	a := &recordingStorage{}
+	m := NewMultiStorage(10, Sink{"a", a})
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if err := m.Write(&ws.WSMessage{EventType: "book"}); err == nil {
+		t.Error("Expected error from Write after Close")
+	}
+	if err := m.WriteRaw(ws.RawFrame{Data: []byte("{}")}); err == nil {
+		t.Error("Expected error from WriteRaw after Close")
+	}
+}
+
+func TestMultiStorage_FailureIsolation(t *testing.T) {
+	failing := &recordingStorage{fail: true}
+	slow := &recordingStorage{block: make(chan struct{})}
+	healthy := &recordingStorage{}
+	m := NewMultiStorage(2, Sink{"failing", failing}, Sink{"slow", slow}, Sink{"healthy", healthy})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// The slow sink holds one message in Write and two in its queue; the
+	// remaining two are dropped without blocking the caller.
+	for i := 0; i < 5; i++ {
+		m.Write(&ws.WSMessage{EventType: "book"})
+		waitFor(t, func() bool {
+			drained := len(m.sinks[0].queue) == 0 && len(m.sinks[2].queue) == 0
+			return drained && (i > 0 || len(m.sinks[1].queue) == 0)
+		})
+	}
+	waitFor(t, func() bool { return m.Stats()[2].Written == 5 })
+
+	close(slow.block)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	stats := m.Stats()
+	if stats[0].Errors != 5 || stats[0].Written != 0 {
+		t.Errorf("failing stats = %+v", stats[0])
+	}
+	if n := strings.Count(logs.String(), "Error writing to sink failing"); n != 1 {
+		t.Errorf("logged %d sink errors, want 1:\n%s", n, logs.String())
+	}
+	if stats[1].Written != 3 || stats[1].Dropped != 2 {
+		t.Errorf("slow stats = %+v", stats[1])
+	}
+	if stats[2].Written != 5 || stats[2].Dropped != 0 {
+		t.Errorf("healthy stats = %+v", stats[2])
+	}
+}
+
+func TestMultiStorage_WriteRaw(t *testing.T) {
+	dir := t.TempDir()
+	file, err := NewFileStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	m := NewMultiStorage(10, Sink{"file", file}, Sink{"plain", &recordingStorage{}})
+
+	m.WriteRaw(ws.RawFrame{Data: []byte(`[]`)})
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	stats := m.Stats()
+	if stats[0].Written != 1 {
+		t.Errorf("file stats = %+v", stats[0])
+	}
+	if stats[1].Errors != 1 {
+		t.Errorf("plain stats = %+v, want one error for unsupported raw frame", stats[1])
+	}
+}
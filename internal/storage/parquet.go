@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/johan/polymarket-collector/internal/types"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// parquetRowGroupSize is the maximum number of rows in a row group.
+const parquetRowGroupSize = 50000
+
+// parquetRow is the flattened schema: one row per price level.
+// Book snapshots produce one row per level (an empty book produces a single
+// row with null side/price/size), price changes one row per change, and
+// last_trade_price events one row per trade. Other events are not stored.
+type parquetRow struct {
+	EventType  string   `parquet:"event_type"`
+	AssetID    string   `parquet:"asset_id"`
+	Market     string   `parquet:"market"`
+	Ts         int64    `parquet:"ts,timestamp(millisecond)"`
+	ReceivedAt *int64   `parquet:"received_at,optional"` // Unix nanoseconds
+	Side       *string  `parquet:"side,optional"`
+	Price      *float64 `parquet:"price,optional"`
+	Size       *float64 `parquet:"size,optional"`
+	BestBid    *float64 `parquet:"best_bid,optional"`
+	BestAsk    *float64 `parquet:"best_ask,optional"`
+}
+
+// ParquetStorage writes messages to Parquet files with rotation.
+// A file is only readable once it has been rotated or closed, since the
+// Parquet footer is written last.
+type ParquetStorage struct {
+	outputDir        string
+	rotationInterval time.Duration
+
+	mu           sync.Mutex
+	currentFile  *os.File
+	bufWriter    *bufio.Writer
+	writer       *parquet.GenericWriter[parquetRow]
+	currentPath  string
+	lastRotation time.Time
+	messageCount int64
+}
+
+// NewParquetStorage creates a new Parquet storage.
+func NewParquetStorage(outputDir string, rotationInterval time.Duration) (*ParquetStorage, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	s := &ParquetStorage{
+		outputDir:        outputDir,
+		rotationInterval: rotationInterval,
+	}
+
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Write flattens a message into rows and buffers them in the current file.
+func (s *ParquetStorage) Write(msg *ws.WSMessage) error {
+	rows, err := flattenMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		return fmt.Errorf("parquet storage is closed")
+	}
+
+	// Check if rotation is needed
+	if s.rotationInterval > 0 && time.Since(s.lastRotation) > s.rotationInterval {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.writer.Write(rows); err != nil {
+		return fmt.Errorf("writing rows: %w", err)
+	}
+
+	s.messageCount++
+	return nil
+}
+
+// Close writes the footer and closes the current file.
+func (s *ParquetStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFile()
+}
+
+// closeFile finishes the current file. The caller must hold s.mu.
+func (s *ParquetStorage) closeFile() error {
+	if s.currentFile == nil {
+		return nil
+	}
+
+	err := s.writer.Close()
+	if flushErr := s.bufWriter.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := s.currentFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	s.currentFile = nil
+	s.bufWriter = nil
+	s.writer = nil
+	if err != nil {
+		return fmt.Errorf("closing parquet file: %w", err)
+	}
+	return nil
+}
+
+// rotate finishes the current file and creates a new one.
+func (s *ParquetStorage) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("orderbook_%s.parquet", time.Now().UTC().Format("2006-01-02_15-04-05"))
+	path := filepath.Join(s.outputDir, filename)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+
+	bw := bufio.NewWriter(f)
+	pw := parquet.NewGenericWriter[parquetRow](bw,
+		parquet.Compression(&parquet.Gzip),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+	)
+
+	s.currentFile = f
+	s.bufWriter = bw
+	s.writer = pw
+	s.currentPath = path
+	s.lastRotation = time.Now()
+	s.messageCount = 0
+
+	return nil
+}
+
+// CurrentPath returns the path to the current output file.
+func (s *ParquetStorage) CurrentPath() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentPath
+}
+
+// MessageCount returns the number of messages written to the current file.
+func (s *ParquetStorage) MessageCount() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messageCount
+}
+
+// flattenMessage converts a message into Parquet rows. Event types that are
+// not stored produce no rows. A missing or invalid exchange timestamp falls
+// back to the local receive time rather than dropping the message.
+func flattenMessage(msg *ws.WSMessage) ([]parquetRow, error) {
+	switch msg.EventType {
+	case ws.EventTypeBook, ws.EventTypePriceChange, ws.EventTypeLastTradePrice:
+	default:
+		return nil, nil
+	}
+
+	ts, err := strconv.ParseInt(msg.Timestamp, 10, 64)
+	if err != nil {
+		ts = time.Duration(msg.ReceivedAt).Milliseconds()
+	}
+
+	var receivedAt *int64
+	if msg.ReceivedAt != 0 {
+		receivedAt = &msg.ReceivedAt
+	}
+
+	row := func(assetID, side string, price, size, bestBid, bestAsk *float64) parquetRow {
+		r := parquetRow{
+			EventType:  msg.EventType,
+			AssetID:    assetID,
+			Market:     msg.Market,
+			Ts:         ts,
+			ReceivedAt: receivedAt,
+			Price:      price,
+			Size:       size,
+			BestBid:    bestBid,
+			BestAsk:    bestAsk,
+		}
+		if side != "" {
+			r.Side = &side
+		}
+		return r
+	}
+
+	var rows []parquetRow
+	switch msg.EventType {
+	case ws.EventTypeBook:
+		bestBid, err := topOfBook(msg.Bids, true)
+		if err != nil {
+			return nil, err
+		}
+		bestAsk, err := topOfBook(msg.Asks, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, side := range []struct {
+			name   string
+			levels []types.PriceLevel
+		}{{"BUY", msg.Bids}, {"SELL", msg.Asks}} {
+			for _, l := range side.levels {
+				price, size, err := parseLevel(l.Price, l.Size)
+				if err != nil {
+					return nil, err
+				}
+				rows = append(rows, row(msg.AssetID, side.name, &price, &size, bestBid, bestAsk))
+			}
+		}
+		if len(rows) == 0 {
+			rows = append(rows, row(msg.AssetID, "", nil, nil, nil, nil))
+		}
+
+	case ws.EventTypePriceChange:
+		for _, pc := range msg.PriceChanges {
+			price, size, err := parseLevel(pc.Price, pc.Size)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row(pc.AssetID, pc.Side, &price, &size, floatPtr(pc.BestBid), floatPtr(pc.BestAsk)))
+		}
+
+	case ws.EventTypeLastTradePrice:
+		price, size, err := parseLevel(msg.Price, msg.Size)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row(msg.AssetID, msg.Side, &price, &size, nil, nil))
+	}
+
+	return rows, nil
+}
+
+// parseLevel parses a price and size pair.
+func parseLevel(price, size string) (float64, float64, error) {
+	p, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing price %q: %w", price, err)
+	}
+	s, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing size %q: %w", size, err)
+	}
+	return p, s, nil
+}
+
+// topOfBook returns the best price on one side of a snapshot, or nil if empty.
+func topOfBook(levels []types.PriceLevel, highest bool) (*float64, error) {
+	var best *float64
+	for _, l := range levels {
+		p, err := strconv.ParseFloat(l.Price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing price %q: %w", l.Price, err)
+		}
+		if best == nil || (highest && p > *best) || (!highest && p < *best) {
+			best = &p
+		}
+	}
+	return best, nil
+}
+
+// floatPtr parses a float into a nullable Parquet value, returning nil for
+// empty or invalid values.
+func floatPtr(v string) *float64 {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/johan/polymarket-collector/internal/types"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+func TestFlattenMessage_Book(t *testing.T) {
+	msg := &ws.WSMessage{
+		EventType: ws.EventTypeBook,
+		Market:    "0xmarket",
+		AssetID:   "token1",
+		Timestamp: "1000",
+		Bids:      []types.PriceLevel{{Price: "0.48", Size: "10"}, {Price: "0.49", Size: "20"}},
+		Asks:      []types.PriceLevel{{Price: "0.52", Size: "5"}},
+	}
+
+	rows, err := flattenMessage(msg)
+	if err != nil {
+		t.Fatalf("flattenMessage failed: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("rows = %d, want 3", len(rows))
+	}
+
+	first := rows[0]
+	if *first.Side != "BUY" || *first.Price != 0.48 || *first.Size != 10.0 {
+		t.Errorf("first row = %+v", first)
+	}
+	if *first.BestBid != 0.49 || *first.BestAsk != 0.52 {
+		t.Errorf("best bid/ask = %v/%v, want 0.49/0.52", *first.BestBid, *first.BestAsk)
+	}
+	if first.Ts != 1000 || first.ReceivedAt != nil {
+		t.Errorf("ts/received_at = %v/%v, want 1000/nil", first.Ts, first.ReceivedAt)
+	}
+	if *rows[2].Side != "SELL" {
+		t.Errorf("last row side = %v, want SELL", *rows[2].Side)
+	}
+}
+
+func TestFlattenMessage_EmptyBook(t *testing.T) {
+	rows, err := flattenMessage(&ws.WSMessage{EventType: ws.EventTypeBook, AssetID: "token1", Timestamp: "1"})
+	if err != nil {
+		t.Fatalf("flattenMessage failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Price != nil {
+		t.Errorf("rows = %+v, want a single row with null price", rows)
+	}
+}
+
+func TestFlattenMessage_PriceChange(t *testing.T) {
+	msg := &ws.WSMessage{
+		EventType:  ws.EventTypePriceChange,
+		Market:     "0xmarket",
+		Timestamp:  "2000",
+		ReceivedAt: 2000000042,
+		PriceChanges: []ws.PriceChange{
+			{AssetID: "token1", Price: "0.5", Size: "0", Side: "BUY", BestBid: "0.49", BestAsk: "0.51"},
+			{AssetID: "token2", Price: "0.5", Size: "3", Side: "SELL"},
+		},
+	}
+
+	rows, err := flattenMessage(msg)
+	if err != nil {
+		t.Fatalf("flattenMessage failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %d, want 2", len(rows))
+	}
+	if rows[0].AssetID != "token1" || *rows[0].BestBid != 0.49 || *rows[0].ReceivedAt != 2000000042 {
+		t.Errorf("rows[0] = %+v", rows[0])
+	}
+	if rows[1].BestBid != nil || rows[1].BestAsk != nil {
+		t.Errorf("rows[1] best bid/ask = %v/%v, want nil", rows[1].BestBid, rows[1].BestAsk)
+	}
+}
+
+func TestFlattenMessage_Timestamp(t *testing.T) {
+	rows, err := flattenMessage(&ws.WSMessage{EventType: ws.EventTypeTickSizeChange})
+	if err != nil || len(rows) != 0 {
+		t.Errorf("tick_size_change: rows = %+v, err = %v, want no rows and no error", rows, err)
+	}
+
+	rows, err = flattenMessage(&ws.WSMessage{
+		EventType:  ws.EventTypeLastTradePrice,
+		ReceivedAt: 5000123456,
+		Price:      "0.5",
+		Size:       "1",
+	})
+	if err != nil {
+		t.Fatalf("flattenMessage failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Ts != 5000 {
+		t.Errorf("rows = %+v, want ts 5000 from received_at", rows)
+	}
+}
+
+func TestParquetStorage_WriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+	stor, err := NewParquetStorage(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewParquetStorage failed: %v", err)
+	}
+
+	msgs := []*ws.WSMessage{
+		{
+			EventType: ws.EventTypeBook,
+			Market:    "0xmarket",
+			AssetID:   "token1",
+			Timestamp: "1000",
+			Bids:      []types.PriceLevel{{Price: "0.5", Size: "1"}},
+			Asks:      []types.PriceLevel{{Price: "0.6", Size: "2"}},
+		},
+		{EventType: ws.EventTypeTickSizeChange, AssetID: "token1"},
+		{
+			EventType:    ws.EventTypePriceChange,
+			Market:       "0xmarket",
+			Timestamp:    "2000",
+			ReceivedAt:   2000000042,
+			PriceChanges: []ws.PriceChange{{AssetID: "token1", Price: "0.55", Size: "3", Side: "BUY"}},
+		},
+	}
+	for _, msg := range msgs {
+		if err := stor.Write(msg); err != nil {
+			t.Fatalf("Write(%s) failed: %v", msg.EventType, err)
+		}
+	}
+	if err := stor.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := stor.Write(msgs[0]); err == nil {
+		t.Error("Expected error writing after Close")
+	}
+
+	rows, err := parquet.ReadFile[parquetRow](stor.CurrentPath())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("rows = %d, want 3", len(rows))
+	}
+	if *rows[1].Side != "SELL" || *rows[1].Price != 0.6 || *rows[1].BestBid != 0.5 {
+		t.Errorf("rows[1] = %+v", rows[1])
+	}
+	if rows[2].EventType != ws.EventTypePriceChange || rows[2].Ts != 2000 || *rows[2].ReceivedAt != 2000000042 {
+		t.Errorf("rows[2] = %+v", rows[2])
+	}
+}
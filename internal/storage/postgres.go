@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/johan/polymarket-collector/internal/config"
+	"github.com/johan/polymarket-collector/internal/types"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// postgresSchema creates the normalized tables. Every primary key contains
+// (asset_id, ts, hash) so that replaying a batch after a failed commit
+// inserts nothing twice.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS book_snapshots (
+	asset_id    TEXT        NOT NULL,
+	ts          TIMESTAMPTZ NOT NULL,
+	hash        TEXT        NOT NULL,
+	market      TEXT        NOT NULL,
+	received_at TIMESTAMPTZ,
+	PRIMARY KEY (asset_id, ts, hash)
+);
+
+CREATE TABLE IF NOT EXISTS book_snapshot_levels (
+	asset_id TEXT             NOT NULL,
+	ts       TIMESTAMPTZ      NOT NULL,
+	hash     TEXT             NOT NULL,
+	side     TEXT             NOT NULL,
+	price    DOUBLE PRECISION NOT NULL,
+	size     DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (asset_id, ts, hash, side, price)
+);
+
+CREATE TABLE IF NOT EXISTS price_changes (
+	asset_id    TEXT             NOT NULL,
+	ts          TIMESTAMPTZ      NOT NULL,
+	hash        TEXT             NOT NULL,
+	market      TEXT             NOT NULL,
+	side        TEXT             NOT NULL,
+	price       DOUBLE PRECISION NOT NULL,
+	size        DOUBLE PRECISION NOT NULL,
+	best_bid    DOUBLE PRECISION,
+	best_ask    DOUBLE PRECISION,
+	received_at TIMESTAMPTZ,
+	PRIMARY KEY (asset_id, ts, hash)
+);
+`
+
+// postgresTable describes a table written with COPY.
+type postgresTable struct {
+	name    string
+	columns []string
+}
+
+var (
+	tableSnapshots = postgresTable{"book_snapshots",
+		[]string{"asset_id", "ts", "hash", "market", "received_at"}}
+	tableLevels = postgresTable{"book_snapshot_levels",
+		[]string{"asset_id", "ts", "hash", "side", "price", "size"}}
+	tablePriceChanges = postgresTable{"price_changes",
+		[]string{"asset_id", "ts", "hash", "market", "side", "price", "size", "best_bid", "best_ask", "received_at"}}
+)
+
+// postgresMaxPendingBatches bounds the buffer while the database is slow or
+// unreachable, in multiples of the flush size.
+const postgresMaxPendingBatches = 10
+
+// postgresDropLogInterval rate-limits the warning logged while rows are
+// dropped because the buffer is full.
+const postgresDropLogInterval = 10 * time.Second
+
+// postgresRetryBackoff is the delay before the first retry; it doubles per attempt.
+const postgresRetryBackoff = 500 * time.Millisecond
+
+// postgresBatch holds buffered rows for each table, in COPY column order.
+type postgresBatch struct {
+	snapshots    [][]any
+	levels       [][]any
+	priceChanges [][]any
+}
+
+func (b *postgresBatch) len() int {
+	return len(b.snapshots) + len(b.levels) + len(b.priceChanges)
+}
+
+func (b *postgresBatch) append(other postgresBatch) {
+	b.snapshots = append(b.snapshots, other.snapshots...)
+	b.levels = append(b.levels, other.levels...)
+	b.priceChanges = append(b.priceChanges, other.priceChanges...)
+}
+
+// PostgresStorage writes book snapshots and price changes to normalized
+// PostgreSQL tables. Rows are buffered and flushed with COPY once FlushSize
+// rows are pending or FlushInterval has passed. If the timescaledb extension
+// is installed, the tables are turned into hypertables.
+type PostgresStorage struct {
+	pool          *pgxpool.Pool
+	flushSize     int
+	flushInterval time.Duration
+	maxRetries    int
+
+	mu      sync.Mutex
+	pending postgresBatch
+	closed  bool
+
+	flushMu sync.Mutex // Serializes flushes
+	flushCh chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	statsMu      sync.Mutex
+	rowsWritten  int64
+	rowsDropped  int64
+	dropsSince   int64 // Rows dropped since the last buffer-full warning
+	lastDropWarn time.Time
+}
+
+// NewPostgresStorage connects to the database, creates the tables if needed
+// and starts the background flusher.
+func NewPostgresStorage(ctx context.Context, cfg config.PostgresConfig) (*PostgresStorage, error) {
+	pool, err := pgxpool.New(ctx, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	if err := createPostgresSchema(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	s := &PostgresStorage{
+		pool:          pool,
+		flushSize:     cfg.FlushSize,
+		flushInterval: cfg.FlushInterval,
+		maxRetries:    cfg.MaxRetries,
+		flushCh:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	if s.flushSize <= 0 {
+		s.flushSize = 1000
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = time.Second
+	}
+	if s.maxRetries <= 0 {
+		s.maxRetries = 1
+	}
+
+	s.wg.Add(1)
+	go s.flushLoop()
+
+	return s, nil
+}
+
+// createPostgresSchema creates the tables and, on TimescaleDB, the hypertables.
+func createPostgresSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+		return fmt.Errorf("creating postgres schema: %w", err)
+	}
+
+	var timescale bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&timescale)
+	if err != nil {
+		return fmt.Errorf("checking for timescaledb: %w", err)
+	}
+	if !timescale {
+		return nil
+	}
+
+	for _, table := range []postgresTable{tableSnapshots, tableLevels, tablePriceChanges} {
+		_, err := pool.Exec(ctx, fmt.Sprintf(`SELECT create_hypertable('%s', 'ts', if_not_exists => TRUE, migrate_data => TRUE)`, table.name))
+		if err != nil {
+			return fmt.Errorf("creating hypertable %s: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// Write buffers the rows for a message. Messages other than book and
+// price_change are ignored. While the buffer is full, rows are dropped and
+// counted in RowsDropped rather than failing every write.
+func (s *PostgresStorage) Write(msg *ws.WSMessage) error {
+	batch, err := postgresRows(msg)
+	if err != nil {
+		return err
+	}
+	if batch.len() == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("postgres storage is closed")
+	}
+	if s.pending.len()+batch.len() > s.flushSize*postgresMaxPendingBatches {
+		s.mu.Unlock()
+		s.recordDropped(int64(batch.len()))
+		return nil
+	}
+	s.pending.append(batch)
+	full := s.pending.len() >= s.flushSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// recordDropped counts rows discarded because the buffer was full and logs
+// a warning at most once per postgresDropLogInterval.
+func (s *PostgresStorage) recordDropped(rows int64) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	s.rowsDropped += rows
+	s.dropsSince += rows
+	if time.Since(s.lastDropWarn) < postgresDropLogInterval {
+		return
+	}
+	log.Printf("Postgres buffer full, dropped %d rows since last warning (%d total)", s.dropsSince, s.rowsDropped)
+	s.dropsSince = 0
+	s.lastDropWarn = time.Now()
+}
+
+// Close flushes the remaining rows and closes the connection pool.
+// Writes after Close return an error.
+func (s *PostgresStorage) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.done)
+		s.wg.Wait()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		s.closeErr = s.Flush(ctx)
+
+		s.pool.Close()
+	})
+	return s.closeErr
+}
+
+// Flush writes all buffered rows to the database, retrying failed batches.
+// Batches that still fail after MaxRetries attempts are dropped.
+func (s *PostgresStorage) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = postgresBatch{}
+	s.mu.Unlock()
+
+	if batch.len() == 0 {
+		return nil
+	}
+
+	backoff := postgresRetryBackoff
+	var err error
+retry:
+	for attempt := 1; attempt <= s.maxRetries; attempt++ {
+		if err = s.writeBatch(ctx, batch); err == nil {
+			s.statsMu.Lock()
+			s.rowsWritten += int64(batch.len())
+			s.statsMu.Unlock()
+			return nil
+		}
+		if attempt == s.maxRetries {
+			break
+		}
+
+		log.Printf("Postgres flush attempt %d/%d failed: %v", attempt, s.maxRetries, err)
+		select {
+		case <-ctx.Done():
+			break retry
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+
+	s.statsMu.Lock()
+	s.rowsDropped += int64(batch.len())
+	s.statsMu.Unlock()
+	return fmt.Errorf("writing %d rows to postgres: %w", batch.len(), err)
+}
+
+// flushLoop flushes on the interval and whenever the buffer fills up.
+func (s *PostgresStorage) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.flushCh:
+		}
+
+		if err := s.Flush(context.Background()); err != nil {
+			log.Printf("Error flushing to postgres: %v", err)
+		}
+	}
+}
+
+// writeBatch writes a batch in a single transaction. Each table is copied
+// into a temporary table first and then merged with ON CONFLICT DO NOTHING,
+// so retrying a batch that was partially committed is safe.
+func (s *PostgresStorage) writeBatch(ctx context.Context, batch postgresBatch) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, t := range []struct {
+		table postgresTable
+		rows  [][]any
+	}{
+		{tableSnapshots, batch.snapshots},
+		{tableLevels, batch.levels},
+		{tablePriceChanges, batch.priceChanges},
+	} {
+		if len(t.rows) == 0 {
+			continue
+		}
+		if err := copyRows(ctx, tx, t.table, t.rows); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// copyRows bulk loads rows into a table, skipping rows that already exist.
+func copyRows(ctx context.Context, tx pgx.Tx, table postgresTable, rows [][]any) error {
+	tmp := "tmp_" + table.name
+	columnList := strings.Join(table.columns, ", ")
+
+	_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TEMP TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP`, tmp, table.name))
+	if err != nil {
+		return fmt.Errorf("creating temp table for %s: %w", table.name, err)
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{tmp}, table.columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("copying into %s: %w", table.name, err)
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT DO NOTHING`, table.name, columnList, columnList, tmp))
+	if err != nil {
+		return fmt.Errorf("inserting into %s: %w", table.name, err)
+	}
+	return nil
+}
+
+// RowsWritten returns the number of rows committed to the database.
+func (s *PostgresStorage) RowsWritten() int64 {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.rowsWritten
+}
+
+// RowsDropped returns the number of rows discarded because the buffer was
+// full or a batch failed after all retries.
+func (s *PostgresStorage) RowsDropped() int64 {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.rowsDropped
+}
+
+// postgresRows converts a message into table rows.
+func postgresRows(msg *ws.WSMessage) (postgresBatch, error) {
+	var batch postgresBatch
+
+	if msg.EventType != ws.EventTypeBook && msg.EventType != ws.EventTypePriceChange {
+		return batch, nil
+	}
+
+	tsMs, err := strconv.ParseInt(msg.Timestamp, 10, 64)
+	if err != nil {
+		return batch, fmt.Errorf("parsing timestamp %q: %w", msg.Timestamp, err)
+	}
+	ts := time.UnixMilli(tsMs).UTC()
+
+	var receivedAt any
+	if msg.ReceivedAt != 0 {
+		receivedAt = time.Unix(0, msg.ReceivedAt).UTC()
+	}
+
+	switch msg.EventType {
+	case ws.EventTypeBook:
+		batch.snapshots = append(batch.snapshots, []any{msg.AssetID, ts, msg.Hash, msg.Market, receivedAt})
+		for _, side := range []struct {
+			name   string
+			levels []types.PriceLevel
+		}{{"BUY", msg.Bids}, {"SELL", msg.Asks}} {
+			for _, l := range side.levels {
+				price, size, err := parseLevel(l.Price, l.Size)
+				if err != nil {
+					return postgresBatch{}, err
+				}
+				batch.levels = append(batch.levels, []any{msg.AssetID, ts, msg.Hash, side.name, price, size})
+			}
+		}
+
+	case ws.EventTypePriceChange:
+		for _, pc := range msg.PriceChanges {
+			price, size, err := parseLevel(pc.Price, pc.Size)
+			if err != nil {
+				return postgresBatch{}, err
+			}
+			batch.priceChanges = append(batch.priceChanges, []any{
+				pc.AssetID, ts, pc.Hash, msg.Market, pc.Side, price, size,
+				optionalFloat(pc.BestBid), optionalFloat(pc.BestAsk), receivedAt,
+			})
+		}
+	}
+
+	return batch, nil
+}
+
+// optionalFloat parses a float, returning nil for empty or invalid values.
+func optionalFloat(v string) any {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil
+	}
+	return f
+}
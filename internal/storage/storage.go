@@ -14,6 +14,21 @@ type Storage interface {
 	Close() error
 }
 
+// RawWriter is implemented by storage backends that can archive raw
+// WebSocket frames byte-for-byte, without parsing them first.
+type RawWriter interface {
+	// WriteRaw writes a raw frame and its receive time to storage.
+	WriteRaw(frame ws.RawFrame) error
+}
+
+// ByteCounter is implemented by storage backends that count the bytes
+// they write.
+type ByteCounter interface {
+	// BytesWritten returns the total number of bytes written, across
+	// rotations.
+	BytesWritten() int64
+}
+
 // NullStorage is a no-op storage that discards all data.
 type NullStorage struct{}
 
@@ -27,6 +42,11 @@ func (s *NullStorage) Write(msg *ws.WSMessage) error {
 	return nil
 }
 
+// WriteRaw does nothing.
+func (s *NullStorage) WriteRaw(frame ws.RawFrame) error {
+	return nil
+}
+
 // Close does nothing.
 func (s *NullStorage) Close() error {
 	return nil
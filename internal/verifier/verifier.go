@@ -0,0 +1,224 @@
+// Package verifier cross-checks locally reconstructed order books against the CLOB REST API.
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/clob"
+	"github.com/johan/polymarket-collector/internal/orderbook"
+	"github.com/johan/polymarket-collector/internal/types"
+)
+
+const (
+	// DefaultInterval is the default time between verification passes.
+	DefaultInterval = 120 * time.Second
+
+	// DefaultMismatchThreshold is the default number of consecutive
+	// mismatches before a book is reported as drifted. A single mismatch
+	// is often just the REST snapshot and the feed being a few updates apart.
+	DefaultMismatchThreshold = 2
+)
+
+// Drift describes a divergence between a local book and the REST snapshot.
+type Drift struct {
+	Type            string    `json:"type"` // Always "drift"
+	AssetID         string    `json:"asset_id"`
+	Market          string    `json:"market"`
+	DetectedAt      time.Time `json:"detected_at"`
+	LocalTimestamp  string    `json:"local_timestamp"`
+	RemoteTimestamp string    `json:"remote_timestamp"`
+	LocalHash       string    `json:"local_hash"`
+	RemoteHash      string    `json:"remote_hash"`
+	BidMismatches   int       `json:"bid_mismatches"`
+	AskMismatches   int       `json:"ask_mismatches"`
+	LocalBestBid    string    `json:"local_best_bid,omitempty"`
+	RemoteBestBid   string    `json:"remote_best_bid,omitempty"`
+	LocalBestAsk    string    `json:"local_best_ask,omitempty"`
+	RemoteBestAsk   string    `json:"remote_best_ask,omitempty"`
+}
+
+// DriftHandler is called when a book is confirmed to have drifted.
+type DriftHandler func(drift Drift)
+
+// RESTVerifier periodically compares local books against /book snapshots.
+type RESTVerifier struct {
+	client    *clob.Client
+	interval  time.Duration
+	threshold int
+}
+
+// NewRESTVerifier creates a new verifier.
+func NewRESTVerifier(client *clob.Client, interval time.Duration) *RESTVerifier {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &RESTVerifier{
+		client:    client,
+		interval:  interval,
+		threshold: DefaultMismatchThreshold,
+	}
+}
+
+// WithMismatchThreshold sets how many consecutive mismatches are needed to report drift.
+func (v *RESTVerifier) WithMismatchThreshold(n int) *RESTVerifier {
+	if n < 1 {
+		n = 1
+	}
+	v.threshold = n
+	return v
+}
+
+// Verify fetches the REST snapshot for a token and compares it with the local book.
+// It returns nil if the books match or the local book has not been seeded yet.
+func (v *RESTVerifier) Verify(ctx context.Context, tokenID string, local *orderbook.Book) (*Drift, error) {
+	if local == nil || !local.Seeded() {
+		return nil, nil
+	}
+
+	remote, err := v.client.FetchBook(ctx, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching book: %w", err)
+	}
+
+	return Compare(local.Snapshot(), remote), nil
+}
+
+// Run verifies the given tokens every interval until the context is cancelled.
+// Drift is only reported once a token has mismatched on consecutive passes.
+func (v *RESTVerifier) Run(ctx context.Context, books *orderbook.Store, tokenIDs []string, onDrift DriftHandler) {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	mismatches := make(map[string]int)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, tokenID := range tokenIDs {
+			drift, err := v.Verify(ctx, tokenID, books.Book(tokenID))
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Warning: verifying book for %s: %v", shortID(tokenID), err)
+				continue
+			}
+
+			if drift == nil {
+				mismatches[tokenID] = 0
+				continue
+			}
+
+			mismatches[tokenID]++
+			if mismatches[tokenID] >= v.threshold {
+				mismatches[tokenID] = 0
+				if onDrift != nil {
+					onDrift(*drift)
+				}
+			}
+		}
+	}
+}
+
+// Compare compares a local snapshot with a REST snapshot.
+// It returns nil if every price level matches.
+func Compare(local orderbook.Snapshot, remote *clob.BookSnapshot) *Drift {
+	bidMismatches := diffLevels(local.Bids, remote.Bids)
+	askMismatches := diffLevels(local.Asks, remote.Asks)
+	if bidMismatches == 0 && askMismatches == 0 {
+		return nil
+	}
+
+	market := local.Market
+	if market == "" {
+		market = remote.Market
+	}
+
+	return &Drift{
+		Type:            "drift",
+		AssetID:         local.AssetID,
+		Market:          market,
+		DetectedAt:      time.Now().UTC(),
+		LocalTimestamp:  local.Timestamp,
+		RemoteTimestamp: remote.Timestamp,
+		LocalHash:       local.Hash,
+		RemoteHash:      remote.Hash,
+		BidMismatches:   bidMismatches,
+		AskMismatches:   askMismatches,
+		LocalBestBid:    bestPrice(local.Bids, true),
+		RemoteBestBid:   bestPrice(remote.Bids, true),
+		LocalBestAsk:    bestPrice(local.Asks, false),
+		RemoteBestAsk:   bestPrice(remote.Asks, false),
+	}
+}
+
+// diffLevels counts price levels that are missing or have a different size on either side.
+// Prices and sizes are compared numerically so "0.5" and "0.50" are equal.
+func diffLevels(local, remote []types.PriceLevel) int {
+	localLevels := levelMap(local)
+	remoteLevels := levelMap(remote)
+
+	mismatches := 0
+	for price, size := range localLevels {
+		if remoteSize, ok := remoteLevels[price]; !ok || remoteSize != size {
+			mismatches++
+		}
+	}
+	for price := range remoteLevels {
+		if _, ok := localLevels[price]; !ok {
+			mismatches++
+		}
+	}
+	return mismatches
+}
+
+// levelMap converts price levels to a price -> size map, skipping unparseable and empty levels.
+func levelMap(levels []types.PriceLevel) map[float64]float64 {
+	m := make(map[float64]float64, len(levels))
+	for _, l := range levels {
+		price, err := strconv.ParseFloat(l.Price, 64)
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseFloat(l.Size, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+		m[price] = size
+	}
+	return m
+}
+
+// bestPrice returns the highest (bids) or lowest (asks) price, regardless of input order.
+func bestPrice(levels []types.PriceLevel, highest bool) string {
+	var (
+		best    float64
+		bestStr string
+	)
+	for _, l := range levels {
+		p, err := strconv.ParseFloat(l.Price, 64)
+		if err != nil {
+			continue
+		}
+		if bestStr == "" || (highest && p > best) || (!highest && p < best) {
+			best, bestStr = p, l.Price
+		}
+	}
+	return bestStr
+}
+
+// shortID shortens a token ID for logging.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12] + "..."
+	}
+	return id
+}
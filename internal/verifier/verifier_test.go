@@ -0,0 +1,93 @@
+package verifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/johan/polymarket-collector/internal/clob"
+	"github.com/johan/polymarket-collector/internal/orderbook"
+	"github.com/johan/polymarket-collector/internal/types"
+)
+
+func localSnapshot() orderbook.Snapshot {
+	return orderbook.Snapshot{
+		AssetID: "token1",
+		Market:  "0xmarket",
+		Bids:    []types.PriceLevel{{Price: "0.50", Size: "100"}, {Price: "0.49", Size: "50"}},
+		Asks:    []types.PriceLevel{{Price: "0.51", Size: "20"}},
+	}
+}
+
+func TestCompare_Match(t *testing.T) {
+	// REST returns levels in a different order and with different formatting
+	remote := &clob.BookSnapshot{
+		Bids: []types.PriceLevel{{Price: "0.49", Size: "50"}, {Price: "0.5", Size: "100.00"}},
+		Asks: []types.PriceLevel{{Price: "0.51", Size: "20"}},
+	}
+
+	if drift := Compare(localSnapshot(), remote); drift != nil {
+		t.Errorf("Expected no drift, got %+v", drift)
+	}
+}
+
+func TestCompare_Mismatch(t *testing.T) {
+	remote := &clob.BookSnapshot{
+		Bids: []types.PriceLevel{{Price: "0.50", Size: "90"}, {Price: "0.49", Size: "50"}},
+		Asks: []types.PriceLevel{{Price: "0.51", Size: "20"}, {Price: "0.52", Size: "10"}},
+	}
+
+	drift := Compare(localSnapshot(), remote)
+	if drift == nil {
+		t.Fatal("Expected drift, got nil")
+	}
+	if drift.Type != "drift" {
+		t.Errorf("Type = %q, want %q", drift.Type, "drift")
+	}
+	if drift.BidMismatches != 1 {
+		t.Errorf("BidMismatches = %d, want 1", drift.BidMismatches)
+	}
+	if drift.AskMismatches != 1 {
+		t.Errorf("AskMismatches = %d, want 1", drift.AskMismatches)
+	}
+	if drift.RemoteBestBid != "0.50" || drift.RemoteBestAsk != "0.51" {
+		t.Errorf("Remote best = %s/%s, want 0.50/0.51", drift.RemoteBestBid, drift.RemoteBestAsk)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/book" || r.URL.Query().Get("token_id") != "token1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"market":"0xmarket","asset_id":"token1","bids":[{"price":"0.50","size":"100"}],"asks":[]}`))
+	}))
+	defer server.Close()
+
+	v := NewRESTVerifier(clob.NewClient(server.Client()).WithBaseURL(server.URL), 0)
+	ctx := context.Background()
+
+	// Unseeded books are never reported
+	drift, err := v.Verify(ctx, "token1", orderbook.NewBook("token1"))
+	if err != nil || drift != nil {
+		t.Fatalf("Verify(unseeded) = %v, %v; want nil, nil", drift, err)
+	}
+
+	book := orderbook.NewBook("token1")
+	book.Seed("0xmarket", "1", "h", []types.PriceLevel{{Price: "0.50", Size: "100"}}, nil)
+	drift, err = v.Verify(ctx, "token1", book)
+	if err != nil || drift != nil {
+		t.Fatalf("Verify(matching) = %v, %v; want nil, nil", drift, err)
+	}
+
+	book.Apply(orderbook.SideSell, "0.60", "5", "2", "")
+	drift, err = v.Verify(ctx, "token1", book)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if drift == nil || drift.AskMismatches != 1 {
+		t.Errorf("Expected 1 ask mismatch, got %+v", drift)
+	}
+}
@@ -3,8 +3,11 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"sync"
 	"time"
 
@@ -19,17 +22,99 @@ const (
 	defaultInitialBackoff = 1 * time.Second
 	defaultMaxBackoff     = 30 * time.Second
 	defaultBackoffFactor  = 2.0
+	defaultBackoffJitter  = 0.2
+	maxBackoffJitter      = 0.9
+
+	// Default heartbeat parameters
+	defaultPingInterval = 10 * time.Second
+	defaultReadTimeout  = 30 * time.Second
+
+	// pingMessage and pongMessage are the market channel's text heartbeat.
+	pingMessage = "PING"
+	pongMessage = "PONG"
+)
+
+// ErrNotConnected is returned when a subscription message cannot be sent
+// because the client is not connected. The token list is kept, so the
+// message takes effect once the client (re)connects.
+var ErrNotConnected = errors.New("not connected")
+
+// DisconnectReason describes why a connection was dropped and re-established.
+type DisconnectReason string
+
+// Disconnect reasons.
+const (
+	// ReasonReadError is an I/O error on the socket.
+	ReasonReadError DisconnectReason = "read_error"
+
+	// ReasonReadTimeout means no frame (not even a PONG) arrived within ReadTimeout.
+	ReasonReadTimeout DisconnectReason = "read_timeout"
+
+	// ReasonServerClose means the server closed the connection.
+	ReasonServerClose DisconnectReason = "server_close"
+
+	// ReasonStaleFeed means a subscribed token had no messages for StaleTimeout.
+	ReasonStaleFeed DisconnectReason = "stale_feed"
+)
+
+// State is the lifecycle state of a Client.
+type State int
+
+// Client states. A client moves from disconnected to connecting and
+// connected, back to connecting whenever the connection drops, and ends in
+// closed once Close is called or the context passed to Connect is cancelled.
+// It returns to disconnected if it gives up after MaxRetries.
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+	StateClosing
+	StateClosed
 )
 
+var stateNames = [...]string{"disconnected", "connecting", "connected", "closing", "closed"}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
 // MessageHandler is a callback function for handling parsed WebSocket messages.
 type MessageHandler func(messages []WSMessage)
 
+// RawHandler is a callback function for handling raw WebSocket frames.
+type RawHandler func(frame RawFrame)
+
+// FrameHandler is called with each frame and the messages parsed from it.
+type FrameHandler func(frame RawFrame, messages []WSMessage)
+
+// DisconnectHandler is called when an established connection drops and the
+// client starts reconnecting.
+type DisconnectHandler func(at time.Time, reason DisconnectReason, err error)
+
+// ReconnectHandler is called once the client has reconnected after a drop,
+// before any message from the new connection is delivered.
+type ReconnectHandler func(gap Gap)
+
+// ParseErrorHandler is called for each frame that cannot be parsed.
+type ParseErrorHandler func(frame RawFrame, err error)
+
+// Gap is a period during which the client was not receiving the feed.
+type Gap struct {
+	Start  time.Time
+	End    time.Time
+	Reason DisconnectReason
+}
+
 // ReconnectConfig configures the reconnection behavior.
 type ReconnectConfig struct {
 	InitialBackoff time.Duration
 	MaxBackoff     time.Duration
 	BackoffFactor  float64
-	MaxRetries     int // 0 = infinite
+	MaxRetries     int     // 0 = infinite
+	Jitter         float64 // Randomize each wait by ±Jitter (0.2 = ±20%)
 }
 
 // DefaultReconnectConfig returns the default reconnection configuration.
@@ -39,6 +124,30 @@ func DefaultReconnectConfig() ReconnectConfig {
 		MaxBackoff:     defaultMaxBackoff,
 		BackoffFactor:  defaultBackoffFactor,
 		MaxRetries:     0,
+		Jitter:         defaultBackoffJitter,
+	}
+}
+
+// HeartbeatConfig configures liveness checks on the connection.
+// A zero duration disables the corresponding check.
+type HeartbeatConfig struct {
+	// Send a PING text frame at this interval; the server answers PONG
+	PingInterval time.Duration
+
+	// Reconnect if no frame at all arrives within this time
+	ReadTimeout time.Duration
+
+	// Reconnect if a subscribed token has no messages for this long
+	StaleTimeout time.Duration
+}
+
+// DefaultHeartbeatConfig returns the default heartbeat configuration.
+// The stale-feed watchdog is disabled by default, since quiet markets can
+// legitimately go minutes without an update.
+func DefaultHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{
+		PingInterval: defaultPingInterval,
+		ReadTimeout:  defaultReadTimeout,
 	}
 }
 
@@ -46,12 +155,32 @@ func DefaultReconnectConfig() ReconnectConfig {
 type Client struct {
 	url             string
 	handler         MessageHandler
+	rawHandler      RawHandler
+	frameHandler    FrameHandler
 	reconnectConfig ReconnectConfig
+	heartbeat       HeartbeatConfig
+	onDisconnect    DisconnectHandler
+	onReconnect     ReconnectHandler
+	onParseError    ParseErrorHandler
+	logger          *slog.Logger
+
+	mu       sync.Mutex
+	state    State
+	conn     *websocket.Conn // Set while connected
+	tokenIDs []string
+
+	// The goroutine that owns the connection (see run)
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when it exits
+
+	// Last time a message was seen per subscribed token (stale-feed watchdog)
+	lastSeen map[string]time.Time
 
-	mu          sync.Mutex
-	conn        *websocket.Conn
-	tokenIDs    []string
-	isConnected bool
+	// Number of reconnects per reason
+	reconnects map[DisconnectReason]int64
+
+	// gorilla/websocket supports one concurrent writer
+	writeMu sync.Mutex
 }
 
 // NewWSClient creates a new WebSocket client.
@@ -60,6 +189,10 @@ func NewWSClient(handler MessageHandler) *Client {
 		url:             DefaultWSURL,
 		handler:         handler,
 		reconnectConfig: DefaultReconnectConfig(),
+		heartbeat:       DefaultHeartbeatConfig(),
+		lastSeen:        make(map[string]time.Time),
+		reconnects:      make(map[DisconnectReason]int64),
+		logger:          slog.Default(),
 	}
 }
 
@@ -69,65 +202,207 @@ func (c *Client) WithURL(url string) *Client {
 	return c
 }
 
+// WithLogger sets the logger. At debug level every received frame and
+// parsed message is logged.
+func (c *Client) WithLogger(logger *slog.Logger) *Client {
+	c.logger = logger
+	return c
+}
+
+// WithRawHandler sets a handler that receives every frame exactly as read
+// from the socket. If no message handler is set, frames are not parsed.
+func (c *Client) WithRawHandler(handler RawHandler) *Client {
+	c.rawHandler = handler
+	return c
+}
+
+// WithFrameHandler sets a handler that receives every frame that parses,
+// along with its messages, so callers needing both parse it only once.
+// Frames that cannot be parsed go to the OnParseError callback.
+func (c *Client) WithFrameHandler(handler FrameHandler) *Client {
+	c.frameHandler = handler
+	return c
+}
+
 // WithReconnectConfig sets the reconnection configuration.
 func (c *Client) WithReconnectConfig(config ReconnectConfig) *Client {
 	c.reconnectConfig = config
 	return c
 }
 
-// Connect establishes the WebSocket connection and starts the read loop.
+// WithHeartbeat sets the heartbeat and stale-feed detection configuration.
+func (c *Client) WithHeartbeat(config HeartbeatConfig) *Client {
+	c.heartbeat = config
+	return c
+}
+
+// OnDisconnect sets a callback for dropped connections.
+func (c *Client) OnDisconnect(handler DisconnectHandler) *Client {
+	c.onDisconnect = handler
+	return c
+}
+
+// OnReconnect sets a callback for successful reconnects.
+func (c *Client) OnReconnect(handler ReconnectHandler) *Client {
+	c.onReconnect = handler
+	return c
+}
+
+// OnParseError sets a callback for frames that cannot be parsed. Frames
+// are only parsed if a message or frame handler or stale_timeout is set.
+func (c *Client) OnParseError(handler ParseErrorHandler) *Client {
+	c.onParseError = handler
+	return c
+}
+
+// Connect establishes the WebSocket connection and starts the goroutine
+// that owns it. It returns once connected; from then on the client
+// reconnects by itself until Close is called or ctx is cancelled.
 func (c *Client) Connect(ctx context.Context) error {
 	c.mu.Lock()
-	if c.isConnected {
+	switch c.state {
+	case StateClosing, StateClosed:
+		c.mu.Unlock()
+		return fmt.Errorf("client is closed")
+	case StateConnecting, StateConnected:
 		c.mu.Unlock()
 		return nil
 	}
+	runCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.state = StateConnecting
 	c.mu.Unlock()
 
-	return c.connectWithBackoff(ctx)
+	ready := make(chan error, 1)
+	go c.run(runCtx, c.done, ready)
+	return <-ready
 }
 
-func (c *Client) connectWithBackoff(ctx context.Context) error {
+// run owns the connection. It is the only goroutine that dials, starts
+// and stops the reader, sends PINGs and moves the client between states
+// (Close only marks it closing). The outcome of the first dial is sent on
+// ready.
+func (c *Client) run(ctx context.Context, done chan struct{}, ready chan<- error) {
+	defer close(done)
+
+	var gap *Gap
+	for {
+		conn, err := c.dial(ctx, gap)
+		if err != nil {
+			if ready != nil {
+				ready <- err
+			} else if ctx.Err() == nil {
+				c.logger.Error("WebSocket reconnection failed", "err", err)
+			}
+			c.finish(ctx)
+			return
+		}
+		if ready != nil {
+			ready <- nil
+			ready = nil
+		}
+
+		// Report the outage before the reader delivers anything new
+		if gap != nil {
+			gap.End = time.Now()
+			c.logger.Info("WebSocket reconnected",
+				"reason", gap.Reason, "outage", gap.End.Sub(gap.Start).Round(time.Millisecond))
+			if c.onReconnect != nil {
+				c.onReconnect(*gap)
+			}
+		}
+
+		reason, err := c.serve(ctx, conn)
+		if ctx.Err() != nil {
+			c.finish(ctx)
+			return
+		}
+
+		at := time.Now()
+		c.mu.Lock()
+		c.transition(StateDisconnected)
+		c.reconnects[reason]++
+		c.mu.Unlock()
+
+		c.logger.Warn("WebSocket disconnected, reconnecting", "reason", reason, "err", err)
+		if c.onDisconnect != nil {
+			c.onDisconnect(at, reason, err)
+		}
+		gap = &Gap{Start: at, Reason: reason}
+	}
+}
+
+// transition changes the state unless the client is closing. Must be
+// called with c.mu held.
+func (c *Client) transition(to State) bool {
+	if c.state == StateClosing || c.state == StateClosed {
+		return false
+	}
+	c.state = to
+	return true
+}
+
+// finish sets the final state when run exits.
+func (c *Client) finish(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = nil
+	if ctx.Err() != nil || c.state == StateClosing {
+		c.state = StateClosed
+	} else {
+		c.state = StateDisconnected
+	}
+}
+
+// dial connects with backoff and subscribes to the current tokens. When
+// reconnecting after a drop, gap describes the outage; the first attempt
+// is then delayed by a random fraction of the initial backoff so that
+// clients dropped together spread out.
+func (c *Client) dial(ctx context.Context, gap *Gap) (*websocket.Conn, error) {
+	c.mu.Lock()
+	c.transition(StateConnecting)
+	c.mu.Unlock()
+
 	backoff := c.reconnectConfig.InitialBackoff
 	retries := 0
 
-	for {
+	if gap != nil && c.reconnectConfig.Jitter > 0 {
+		delay := time.Duration(rand.Float64() * c.reconnectConfig.Jitter * float64(backoff))
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
+			return nil, ctx.Err()
+		case <-time.After(delay):
 		}
+	}
 
+	for {
 		conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.url, nil)
 		if err == nil {
-			c.mu.Lock()
-			c.conn = conn
-			c.isConnected = true
-			c.mu.Unlock()
-
-			// Re-subscribe to any previously subscribed tokens
-			if len(c.tokenIDs) > 0 {
-				if err := c.sendSubscribe(c.tokenIDs); err != nil {
-					log.Printf("Warning: failed to resubscribe: %v", err)
-				}
+			if err := c.attach(conn); err != nil {
+				conn.Close()
+				return nil, err
 			}
-
-			// Start the read loop
-			go c.readLoop(ctx)
-			return nil
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
 
 		retries++
 		if c.reconnectConfig.MaxRetries > 0 && retries >= c.reconnectConfig.MaxRetries {
-			return fmt.Errorf("max retries (%d) exceeded: %w", c.reconnectConfig.MaxRetries, err)
+			return nil, fmt.Errorf("max retries (%d) exceeded: %w", c.reconnectConfig.MaxRetries, err)
 		}
 
-		log.Printf("WebSocket connection failed (attempt %d): %v. Retrying in %v...", retries, err, backoff)
+		wait := c.jittered(backoff)
+		c.logger.Warn("WebSocket connection failed",
+			"attempt", retries, "retry_in", wait.Round(time.Millisecond), "err", err)
 
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(backoff):
+			return nil, ctx.Err()
+		case <-time.After(wait):
 		}
 
 		backoff = time.Duration(float64(backoff) * c.reconnectConfig.BackoffFactor)
@@ -137,104 +412,417 @@ func (c *Client) connectWithBackoff(ctx context.Context) error {
 	}
 }
 
+// attach makes a new connection current and re-subscribes to the tokens.
+// The write lock is held throughout, so a concurrent AddAssets cannot
+// reach the server before the initial subscription.
+func (c *Client) attach(conn *websocket.Conn) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	if !c.transition(StateConnected) {
+		c.mu.Unlock()
+		return fmt.Errorf("client is closed")
+	}
+	c.conn = conn
+	now := time.Now()
+	for tokenID := range c.lastSeen {
+		c.lastSeen[tokenID] = now
+	}
+	tokenIDs := c.tokenIDs
+	c.mu.Unlock()
+
+	if len(tokenIDs) > 0 {
+		data, err := json.Marshal(SubscribeMessage{AssetsIDs: tokenIDs})
+		if err == nil {
+			err = conn.WriteMessage(websocket.TextMessage, data)
+		}
+		if err != nil {
+			c.logger.Warn("Failed to resubscribe", "err", err)
+		}
+	}
+	return nil
+}
+
+// serve runs the reader for an established connection and sends PINGs and
+// checks for a stale feed until the connection fails or ctx is cancelled.
+// The reader has exited when serve returns.
+func (c *Client) serve(ctx context.Context, conn *websocket.Conn) (DisconnectReason, error) {
+	readErr := make(chan error, 1)
+	go c.readLoop(conn, readErr)
+
+	var pingC, staleC <-chan time.Time
+	if c.heartbeat.PingInterval > 0 {
+		ticker := time.NewTicker(c.heartbeat.PingInterval)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
+	if c.heartbeat.StaleTimeout > 0 {
+		ticker := time.NewTicker(max(c.heartbeat.StaleTimeout/4, 10*time.Millisecond))
+		defer ticker.Stop()
+		staleC = ticker.C
+	}
+
+	var reason DisconnectReason
+	ctxDone := ctx.Done()
+	for {
+		select {
+		case err := <-readErr:
+			c.mu.Lock()
+			c.conn = nil
+			c.mu.Unlock()
+			conn.Close()
+			if reason == "" {
+				reason = classifyReadError(err)
+			}
+			return reason, err
+
+		case <-ctxDone:
+			// Unblock the reader and wait for it
+			conn.Close()
+			ctxDone = nil
+
+		case <-pingC:
+			if err := c.write(conn, []byte(pingMessage)); err != nil {
+				c.logger.Warn("Error sending ping", "err", err)
+			}
+
+		case <-staleC:
+			if tokenID, idle := c.stalestToken(); idle > c.heartbeat.StaleTimeout {
+				c.logger.Warn("No messages for token, dropping connection",
+					"asset_id", tokenID, "idle", idle.Round(time.Second))
+				reason = ReasonStaleFeed
+				conn.Close()
+				staleC = nil
+			}
+		}
+	}
+}
+
+// jittered randomizes a backoff by ±Jitter. Jitter is capped below 1 so
+// the wait never drops to zero, which would reconnect in a tight loop.
+func (c *Client) jittered(d time.Duration) time.Duration {
+	j := min(c.reconnectConfig.Jitter, maxBackoffJitter)
+	if j <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + j*(2*rand.Float64()-1)))
+}
+
 // Subscribe subscribes to updates for the given token IDs.
 func (c *Client) Subscribe(tokenIDs []string) error {
 	c.mu.Lock()
 	c.tokenIDs = tokenIDs
+	lastSeen := make(map[string]time.Time, len(tokenIDs))
+	now := time.Now()
+	for _, tokenID := range tokenIDs {
+		if t, ok := c.lastSeen[tokenID]; ok {
+			lastSeen[tokenID] = t
+		} else {
+			lastSeen[tokenID] = now
+		}
+	}
+	c.lastSeen = lastSeen
 	c.mu.Unlock()
 
 	return c.sendSubscribe(tokenIDs)
 }
 
+// AddAssets subscribes to the given tokens that are not subscribed yet,
+// leaving the rest of the subscription untouched. It returns the tokens
+// that were added.
+func (c *Client) AddAssets(tokenIDs []string) ([]string, error) {
+	c.mu.Lock()
+	initial := len(c.tokenIDs) == 0
+	var added []string
+	now := time.Now()
+	for _, tokenID := range tokenIDs {
+		if _, ok := c.lastSeen[tokenID]; ok {
+			continue
+		}
+		c.lastSeen[tokenID] = now
+		added = append(added, tokenID)
+	}
+	// Copy so a reconnect never sees a slice that is being appended to
+	c.tokenIDs = append(append([]string(nil), c.tokenIDs...), added...)
+	c.mu.Unlock()
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if initial {
+		return added, c.sendSubscribe(added)
+	}
+	return added, c.send(SubscribeMessage{AssetsIDs: added, Operation: OperationSubscribe})
+}
+
+// Refresh subscribes to the given tokens again, adding those that are not
+// subscribed yet, so the server sends fresh book snapshots for them only.
+// The rest of the subscription is left untouched.
+func (c *Client) Refresh(tokenIDs []string) error {
+	c.mu.Lock()
+	initial := len(c.tokenIDs) == 0
+	var added []string
+	now := time.Now()
+	for _, tokenID := range tokenIDs {
+		if _, ok := c.lastSeen[tokenID]; ok {
+			continue
+		}
+		c.lastSeen[tokenID] = now
+		added = append(added, tokenID)
+	}
+	c.tokenIDs = append(append([]string(nil), c.tokenIDs...), added...)
+	c.mu.Unlock()
+
+	if len(tokenIDs) == 0 {
+		return nil
+	}
+	if initial {
+		return c.sendSubscribe(tokenIDs)
+	}
+	return c.send(SubscribeMessage{AssetsIDs: tokenIDs, Operation: OperationSubscribe})
+}
+
+// RemoveAssets unsubscribes from the given tokens that are subscribed and
+// returns them.
+func (c *Client) RemoveAssets(tokenIDs []string) ([]string, error) {
+	remove := make(map[string]bool, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		remove[tokenID] = true
+	}
+
+	c.mu.Lock()
+	var removed, kept []string
+	for _, tokenID := range c.tokenIDs {
+		if remove[tokenID] {
+			removed = append(removed, tokenID)
+			delete(c.lastSeen, tokenID)
+		} else {
+			kept = append(kept, tokenID)
+		}
+	}
+	c.tokenIDs = kept
+	c.mu.Unlock()
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, c.send(SubscribeMessage{AssetsIDs: removed, Operation: OperationUnsubscribe})
+}
+
+// Assets returns the currently subscribed token IDs.
+func (c *Client) Assets() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.tokenIDs...)
+}
+
 func (c *Client) sendSubscribe(tokenIDs []string) error {
+	return c.send(SubscribeMessage{AssetsIDs: tokenIDs})
+}
+
+// send writes a subscription message. The token list is kept even if this
+// fails, so the next reconnect subscribes to the right set.
+func (c *Client) send(msg SubscribeMessage) error {
 	c.mu.Lock()
 	conn := c.conn
 	c.mu.Unlock()
 
 	if conn == nil {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
-	msg := SubscribeMessage{AssetsIDs: tokenIDs}
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("marshaling subscribe message: %w", err)
 	}
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	if err := c.write(conn, data); err != nil {
 		return fmt.Errorf("writing subscribe message: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Client) readLoop(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
+// write sends a text frame, serializing concurrent writers.
+func (c *Client) write(conn *websocket.Conn, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
 
-		c.mu.Lock()
-		conn := c.conn
-		c.mu.Unlock()
+// readLoop reads frames and calls the handlers until the connection fails.
+func (c *Client) readLoop(conn *websocket.Conn, readErr chan<- error) {
+	// Any frame, including a PONG, proves the connection is alive
+	if c.heartbeat.ReadTimeout > 0 {
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(c.heartbeat.ReadTimeout))
+		})
+	}
+	parse := c.handler != nil || c.frameHandler != nil || c.heartbeat.StaleTimeout > 0
 
-		if conn == nil {
-			return
+	for {
+		if c.heartbeat.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(c.heartbeat.ReadTimeout))
 		}
 
 		_, data, err := conn.ReadMessage()
+		receivedAt := time.Now()
 		if err != nil {
-			c.mu.Lock()
-			c.isConnected = false
-			c.mu.Unlock()
+			readErr <- err
+			return
+		}
 
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				log.Printf("WebSocket closed normally")
-				return
-			}
+		if string(data) == pongMessage {
+			continue
+		}
 
-			log.Printf("WebSocket read error: %v. Attempting reconnect...", err)
+		frame := RawFrame{ReceivedAt: receivedAt, Data: data}
+		trace := c.logger.Enabled(context.Background(), slog.LevelDebug)
+		if trace {
+			c.logger.Debug("Frame received", "bytes", len(data))
+		}
+		if c.rawHandler != nil {
+			c.rawHandler(frame)
+		}
 
-			// Attempt to reconnect
-			go func() {
-				if reconnErr := c.connectWithBackoff(ctx); reconnErr != nil {
-					log.Printf("Reconnection failed: %v", reconnErr)
-				}
-			}()
-			return
+		if !parse {
+			continue
 		}
 
-		messages, err := Parse(data)
+		messages, err := frame.Parse()
 		if err != nil {
-			log.Printf("Error parsing WebSocket message: %v", err)
+			c.logger.Warn("Error parsing WebSocket message", "err", err)
+			if c.onParseError != nil {
+				c.onParseError(frame, err)
+			}
 			continue
 		}
+		c.markSeen(messages, receivedAt)
+		if trace {
+			traceMessages(c.logger, messages)
+		}
 
-		if c.handler != nil && len(messages) > 0 {
+		if c.frameHandler != nil {
+			c.frameHandler(frame, messages)
+		}
+		if len(messages) > 0 && c.handler != nil {
 			c.handler(messages)
 		}
 	}
 }
 
-// Close closes the WebSocket connection.
-func (c *Client) Close() error {
+// traceMessages logs each message at debug level.
+func traceMessages(logger *slog.Logger, messages []WSMessage) {
+	for _, msg := range messages {
+		assetID := msg.AssetID
+		if assetID == "" && len(msg.PriceChanges) > 0 {
+			assetID = msg.PriceChanges[0].AssetID
+		}
+		logger.Debug("Message received",
+			"event_type", msg.EventType,
+			"asset_id", assetID,
+			"market", msg.Market,
+			"changes", len(msg.PriceChanges))
+	}
+}
+
+// classifyReadError maps a read error to a disconnect reason.
+func classifyReadError(err error) DisconnectReason {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ReasonReadTimeout
+	}
+	// 1006 is reported locally when the connection drops without a close frame
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+		return ReasonServerClose
+	}
+	return ReasonReadError
+}
+
+// markSeen records activity for the tokens in the messages.
+func (c *Client) markSeen(messages []WSMessage, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	touch := func(tokenID string) {
+		if _, ok := c.lastSeen[tokenID]; ok {
+			c.lastSeen[tokenID] = at
+		}
+	}
+	for _, msg := range messages {
+		if msg.AssetID != "" {
+			touch(msg.AssetID)
+		}
+		for _, pc := range msg.PriceChanges {
+			touch(pc.AssetID)
+		}
+	}
+}
+
+// stalestToken returns the subscribed token that has been quiet the longest.
+func (c *Client) stalestToken() (string, time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.isConnected = false
-	if c.conn != nil {
-		err := c.conn.Close()
-		c.conn = nil
-		return err
+	var stalest string
+	var idle time.Duration
+	now := time.Now()
+	for tokenID, seen := range c.lastSeen {
+		if d := now.Sub(seen); d > idle {
+			stalest, idle = tokenID, d
+		}
+	}
+	return stalest, idle
+}
+
+// Reconnects returns the number of dropped connections per reason.
+func (c *Client) Reconnects() map[DisconnectReason]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[DisconnectReason]int64, len(c.reconnects))
+	for reason, n := range c.reconnects {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// Close stops the client and closes the connection. It waits for the read
+// loop to exit, so no handler runs after Close returns; it must therefore
+// not be called from a handler.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	if done == nil {
+		c.state = StateClosed
+	} else if c.state != StateClosed {
+		c.state = StateClosing
+	}
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if done != nil {
+		<-done
 	}
+
+	c.mu.Lock()
+	c.state = StateClosed
+	c.mu.Unlock()
 	return nil
 }
 
-// IsConnected returns whether the client is currently connected.
-func (c *Client) IsConnected() bool {
+// State returns the client's lifecycle state.
+func (c *Client) State() State {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.isConnected
+	return c.state
+}
+
+// IsConnected returns whether the client is currently connected.
+func (c *Client) IsConnected() bool {
+	return c.State() == StateConnected
 }
@@ -0,0 +1,566 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeServer is a market channel endpoint that counts connections and PINGs.
+// If answerPing is false it never writes anything, like a half-open connection.
+type fakeServer struct {
+	*httptest.Server
+	answerPing  bool
+	connections atomic.Int64
+	pings       atomic.Int64
+}
+
+func newFakeServer(t *testing.T, answerPing bool) *fakeServer {
+	t.Helper()
+	fs := &fakeServer{answerPing: answerPing}
+	upgrader := websocket.Upgrader{}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fs.connections.Add(1)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == pingMessage {
+				fs.pings.Add(1)
+				if fs.answerPing {
+					conn.WriteMessage(websocket.TextMessage, []byte(pongMessage))
+				}
+			}
+		}
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *fakeServer) wsURL() string {
+	return "ws" + strings.TrimPrefix(fs.URL, "http")
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestClient(url string, hb HeartbeatConfig) *Client {
+	return NewWSClient(nil).
+		WithURL(url).
+		WithReconnectConfig(ReconnectConfig{
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			BackoffFactor:  2,
+		}).
+		WithHeartbeat(hb)
+}
+
+func TestClient_SendsPing(t *testing.T) {
+	fs := newFakeServer(t, true)
+	c := newTestClient(fs.wsURL(), HeartbeatConfig{PingInterval: 20 * time.Millisecond, ReadTimeout: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	waitUntil(t, func() bool { return fs.pings.Load() >= 3 })
+
+	// PONGs keep the connection alive
+	if got := c.Reconnects(); len(got) != 0 {
+		t.Errorf("Unexpected reconnects: %v", got)
+	}
+}
+
+func TestClient_ReadTimeoutReconnects(t *testing.T) {
+	fs := newFakeServer(t, false)
+	c := newTestClient(fs.wsURL(), HeartbeatConfig{ReadTimeout: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	waitUntil(t, func() bool { return fs.connections.Load() >= 2 })
+	if got := c.Reconnects()[ReasonReadTimeout]; got == 0 {
+		t.Errorf("Expected a read_timeout reconnect, got %v", c.Reconnects())
+	}
+}
+
+func TestClient_StaleFeedReconnects(t *testing.T) {
+	fs := newFakeServer(t, true)
+	c := newTestClient(fs.wsURL(), HeartbeatConfig{
+		PingInterval: 10 * time.Millisecond,
+		ReadTimeout:  time.Second,
+		StaleTimeout: 100 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.Subscribe([]string{"token-1"}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// The connection is alive (PONGs arrive) but the token never updates
+	waitUntil(t, func() bool { return fs.connections.Load() >= 2 })
+	counts := c.Reconnects()
+	if counts[ReasonStaleFeed] == 0 {
+		t.Errorf("Expected a stale_feed reconnect, got %v", counts)
+	}
+	if counts[ReasonReadTimeout] != 0 {
+		t.Errorf("Unexpected read_timeout reconnect: %v", counts)
+	}
+}
+
+func TestClient_MarkSeen(t *testing.T) {
+	c := NewWSClient(nil)
+	c.lastSeen = map[string]time.Time{"a": {}, "b": {}}
+
+	now := time.Now()
+	c.markSeen([]WSMessage{
+		{EventType: EventTypeBook, AssetID: "a"},
+		{EventType: EventTypePriceChange, PriceChanges: []PriceChange{{AssetID: "b"}, {AssetID: "other"}}},
+	}, now)
+
+	if !c.lastSeen["a"].Equal(now) || !c.lastSeen["b"].Equal(now) {
+		t.Errorf("lastSeen = %v", c.lastSeen)
+	}
+	if _, ok := c.lastSeen["other"]; ok {
+		t.Error("Unsubscribed token should not be tracked")
+	}
+}
+
+func TestClient_CloseDoesNotReconnect(t *testing.T) {
+	fs := newFakeServer(t, true)
+	c := newTestClient(fs.wsURL(), DefaultHeartbeatConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	c.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if got := fs.connections.Load(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+}
+
+func TestClient_Jittered(t *testing.T) {
+	c := NewWSClient(nil).WithReconnectConfig(ReconnectConfig{Jitter: 0.2})
+	for range 100 {
+		if d := c.jittered(time.Second); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("jittered(1s) = %v, want within ±20%%", d)
+		}
+	}
+
+	c.WithReconnectConfig(ReconnectConfig{Jitter: 3})
+	for range 100 {
+		if d := c.jittered(time.Second); d < 100*time.Millisecond {
+			t.Fatalf("jittered(1s) with jitter 3 = %v, want capped", d)
+		}
+	}
+
+	c.WithReconnectConfig(ReconnectConfig{})
+	if d := c.jittered(time.Second); d != time.Second {
+		t.Errorf("jittered without jitter = %v, want 1s", d)
+	}
+}
+
+func TestClient_ReconnectHooks(t *testing.T) {
+	fs := newFakeServer(t, false)
+	var disconnects atomic.Int64
+	gaps := make(chan Gap, 10)
+	c := newTestClient(fs.wsURL(), HeartbeatConfig{ReadTimeout: 50 * time.Millisecond}).
+		OnDisconnect(func(at time.Time, reason DisconnectReason, err error) {
+			disconnects.Add(1)
+		}).
+		OnReconnect(func(gap Gap) {
+			select {
+			case gaps <- gap:
+			default:
+			}
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	select {
+	case gap := <-gaps:
+		if gap.Reason != ReasonReadTimeout {
+			t.Errorf("gap.Reason = %s, want %s", gap.Reason, ReasonReadTimeout)
+		}
+		if !gap.End.After(gap.Start) {
+			t.Errorf("gap end %v not after start %v", gap.End, gap.Start)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for reconnect")
+	}
+	if disconnects.Load() == 0 {
+		t.Error("OnDisconnect was not called")
+	}
+}
+
+func TestClient_AddRemoveAssets(t *testing.T) {
+	received := make(chan SubscribeMessage, 10)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg SubscribeMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			received <- msg
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient("ws"+strings.TrimPrefix(srv.URL, "http"), HeartbeatConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	next := func() SubscribeMessage {
+		t.Helper()
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for subscribe message")
+			return SubscribeMessage{}
+		}
+	}
+
+	// The first subscription on a connection is a plain subscribe
+	if added, err := c.AddAssets([]string{"a", "b"}); err != nil || len(added) != 2 {
+		t.Fatalf("AddAssets = %v, %v", added, err)
+	}
+	if msg := next(); msg.Operation != "" || strings.Join(msg.AssetsIDs, ",") != "a,b" {
+		t.Errorf("initial message = %+v", msg)
+	}
+
+	// Only the new token is sent
+	if added, err := c.AddAssets([]string{"a", "b", "c"}); err != nil || strings.Join(added, ",") != "c" {
+		t.Fatalf("AddAssets = %v, %v", added, err)
+	}
+	if msg := next(); msg.Operation != OperationSubscribe || strings.Join(msg.AssetsIDs, ",") != "c" {
+		t.Errorf("add message = %+v", msg)
+	}
+
+	if removed, err := c.RemoveAssets([]string{"a", "x"}); err != nil || strings.Join(removed, ",") != "a" {
+		t.Fatalf("RemoveAssets = %v, %v", removed, err)
+	}
+	if msg := next(); msg.Operation != OperationUnsubscribe || strings.Join(msg.AssetsIDs, ",") != "a" {
+		t.Errorf("remove message = %+v", msg)
+	}
+
+	// No-ops send nothing
+	if added, _ := c.AddAssets([]string{"b"}); added != nil {
+		t.Errorf("AddAssets of subscribed token = %v", added)
+	}
+	if removed, _ := c.RemoveAssets([]string{"a"}); removed != nil {
+		t.Errorf("RemoveAssets of unsubscribed token = %v", removed)
+	}
+	if got := strings.Join(c.Assets(), ","); got != "b,c" {
+		t.Errorf("Assets() = %s, want b,c", got)
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("Unexpected message %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// newServer starts a WebSocket server that runs serve for each connection
+// and counts connections.
+func newServer(t *testing.T, serve func(conn *websocket.Conn)) (string, *atomic.Int64) {
+	t.Helper()
+	var connections atomic.Int64
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connections.Add(1)
+		serve(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), &connections
+}
+
+func TestClient_FrameHandler(t *testing.T) {
+	ms := newMarketServer(t)
+	var mu sync.Mutex
+	var frames []string
+	var parsed [][]WSMessage
+	var parseErrors int
+	c := newTestClient(ms.wsURL(), HeartbeatConfig{}).
+		WithFrameHandler(func(frame RawFrame, messages []WSMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			frames = append(frames, string(frame.Data))
+			parsed = append(parsed, messages)
+		}).
+		OnParseError(func(frame RawFrame, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			parseErrors++
+		})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Subscribe([]string{"a1"}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(frames) == 1
+	})
+	ms.broadcast("not json")
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return parseErrors == 1
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(frames) != 1 || len(parsed[0]) != 1 || parsed[0][0].AssetID != "a1" || !strings.Contains(frames[0], `"a1"`) {
+		t.Errorf("frames = %v, messages = %+v", frames, parsed)
+	}
+}
+
+func TestClient_States(t *testing.T) {
+	fs := newFakeServer(t, true)
+	c := newTestClient(fs.wsURL(), HeartbeatConfig{})
+	if got := c.State(); got != StateDisconnected {
+		t.Errorf("initial state = %s", got)
+	}
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if got := c.State(); got != StateConnected || !c.IsConnected() {
+		t.Errorf("state after Connect = %s", got)
+	}
+
+	c.Close()
+	if got := c.State(); got != StateClosed || c.IsConnected() {
+		t.Errorf("state after Close = %s", got)
+	}
+	if err := c.Connect(context.Background()); err == nil {
+		t.Error("Expected error connecting a closed client")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close returned %v", err)
+	}
+}
+
+func TestClient_ContextCancelClosesClient(t *testing.T) {
+	fs := newFakeServer(t, true)
+	c := newTestClient(fs.wsURL(), HeartbeatConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	cancel()
+	waitUntil(t, func() bool { return c.State() == StateClosed })
+}
+
+func TestClient_ConnectGivesUp(t *testing.T) {
+	// Nothing listens on the closed server's address
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	srv.Close()
+
+	c := NewWSClient(nil).WithURL(url).WithReconnectConfig(ReconnectConfig{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		BackoffFactor:  2,
+		MaxRetries:     3,
+	})
+	if err := c.Connect(context.Background()); err == nil {
+		t.Fatal("Expected Connect to fail")
+	}
+	if got := c.State(); got != StateDisconnected {
+		t.Errorf("state = %s, want disconnected", got)
+	}
+	c.Close()
+}
+
+func TestClient_CloseWaitsForReader(t *testing.T) {
+	url, _ := newServer(t, func(conn *websocket.Conn) {
+		for {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"event_type":"book","asset_id":"a"}`)); err != nil {
+				return
+			}
+		}
+	})
+
+	var inHandler, calls atomic.Int64
+	c := newTestClient(url, HeartbeatConfig{}).WithRawHandler(func(RawFrame) {
+		inHandler.Add(1)
+		calls.Add(1)
+		time.Sleep(time.Millisecond)
+		inHandler.Add(-1)
+	})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	waitUntil(t, func() bool { return calls.Load() > 10 })
+
+	c.Close()
+	if inHandler.Load() != 0 {
+		t.Fatal("Handler still running after Close")
+	}
+	n := calls.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := calls.Load(); got != n {
+		t.Errorf("Handler called %d times after Close", got-n)
+	}
+}
+
+func TestClient_CloseDuringReconnect(t *testing.T) {
+	// The server hangs up on every connection straight away
+	url, connections := newServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye"))
+	})
+
+	for range 20 {
+		c := newTestClient(url, HeartbeatConfig{})
+		if err := c.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		time.Sleep(time.Duration(rand.IntN(20)) * time.Millisecond)
+		c.Close()
+
+		n := connections.Load()
+		time.Sleep(30 * time.Millisecond)
+		if got := connections.Load(); got != n {
+			t.Fatalf("%d connections opened after Close", got-n)
+		}
+		if got := c.State(); got != StateClosed {
+			t.Fatalf("state = %s, want closed", got)
+		}
+	}
+}
+
+func TestClient_ConcurrentUse(t *testing.T) {
+	// Connections are dropped every few milliseconds while the client is used
+	url, _ := newServer(t, func(conn *websocket.Conn) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Millisecond))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	c := newTestClient(url, HeartbeatConfig{PingInterval: time.Millisecond, ReadTimeout: time.Second})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token := strconv.Itoa(i)
+			for range 50 {
+				c.AddAssets([]string{token})
+				c.Subscribe([]string{token, "shared"})
+				c.RemoveAssets([]string{token})
+				c.State()
+				c.Reconnects()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Close()
+
+	if got := c.State(); got != StateClosed {
+		t.Errorf("state = %s, want closed", got)
+	}
+}
+
+func TestTraceMessages(t *testing.T) {
+	var buf bytes.Buffer
+	messages := []WSMessage{
+		{EventType: EventTypeBook, AssetID: "up"},
+		{EventType: EventTypePriceChange, PriceChanges: []PriceChange{{AssetID: "down"}, {AssetID: "up"}}},
+	}
+
+	info := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	traceMessages(info, messages)
+	if buf.Len() != 0 {
+		t.Errorf("traced at info level: %q", buf.String())
+	}
+
+	debug := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	traceMessages(debug, messages)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2: %q", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], "event_type=book asset_id=up") {
+		t.Errorf("book record = %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "event_type=price_change asset_id=down") || !strings.Contains(lines[1], "changes=2") {
+		t.Errorf("price_change record = %q", lines[1])
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 // Parse parses a WebSocket message payload.
 // The WebSocket returns messages either as JSON arrays or single objects.
+// Each message keeps its original JSON in Raw so unmodelled fields are not lost.
 func Parse(data []byte) ([]WSMessage, error) {
 	if len(data) == 0 {
 		return nil, nil
@@ -20,10 +21,20 @@ func Parse(data []byte) ([]WSMessage, error) {
 
 	if data[0] == '[' {
 		// Array format
-		var messages []WSMessage
-		if err := json.Unmarshal(data, &messages); err != nil {
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
 			return nil, fmt.Errorf("parsing websocket message array: %w (data: %s)", err, truncate(data, 100))
 		}
+
+		messages := make([]WSMessage, 0, len(items))
+		for _, item := range items {
+			var msg WSMessage
+			if err := json.Unmarshal(item, &msg); err != nil {
+				return nil, fmt.Errorf("parsing websocket message: %w (data: %s)", err, truncate(item, 100))
+			}
+			msg.Raw = item
+			messages = append(messages, msg)
+		}
 		return messages, nil
 	}
 
@@ -32,6 +43,7 @@ func Parse(data []byte) ([]WSMessage, error) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, fmt.Errorf("parsing websocket message: %w (data: %s)", err, truncate(data, 100))
 	}
+	msg.Raw = data
 	return []WSMessage{msg}, nil
 }
 
@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -202,3 +203,102 @@ func TestParse_SingleObjectBook(t *testing.T) {
 		t.Errorf("EventType = %q, want %q", messages[0].EventType, EventTypeBook)
 	}
 }
+
+func TestParse_LastTradePrice(t *testing.T) {
+	data := []byte(`[{
+		"asset_id": "token1",
+		"event_type": "last_trade_price",
+		"fee_rate_bps": "0",
+		"market": "0xmarket",
+		"price": "0.456",
+		"side": "BUY",
+		"size": "219.217767",
+		"timestamp": "1750428146322"
+	}]`)
+
+	messages, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	msg := messages[0]
+	if msg.EventType != EventTypeLastTradePrice {
+		t.Errorf("EventType = %q, want %q", msg.EventType, EventTypeLastTradePrice)
+	}
+	if msg.Price != "0.456" || msg.Size != "219.217767" || msg.Side != "BUY" || msg.FeeRateBps != "0" {
+		t.Errorf("Unexpected trade fields: price=%q size=%q side=%q fee=%q", msg.Price, msg.Size, msg.Side, msg.FeeRateBps)
+	}
+
+	event, err := msg.Event()
+	if err != nil {
+		t.Fatalf("Event failed: %v", err)
+	}
+	trade, ok := event.(*LastTradePriceEvent)
+	if !ok {
+		t.Fatalf("Event() returned %T, want *LastTradePriceEvent", event)
+	}
+	if trade.Size != "219.217767" {
+		t.Errorf("trade.Size = %q, want %q", trade.Size, "219.217767")
+	}
+}
+
+func TestParse_TickSizeChange(t *testing.T) {
+	data := []byte(`{
+		"event_type": "tick_size_change",
+		"asset_id": "token1",
+		"market": "0xmarket",
+		"old_tick_size": "0.01",
+		"new_tick_size": "0.001",
+		"timestamp": "100000000"
+	}`)
+
+	messages, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	event, err := messages[0].Event()
+	if err != nil {
+		t.Fatalf("Event failed: %v", err)
+	}
+	change, ok := event.(*TickSizeChangeEvent)
+	if !ok {
+		t.Fatalf("Event() returned %T, want *TickSizeChangeEvent", event)
+	}
+	if change.OldTickSize != "0.01" || change.NewTickSize != "0.001" {
+		t.Errorf("Tick sizes = %s -> %s, want 0.01 -> 0.001", change.OldTickSize, change.NewTickSize)
+	}
+}
+
+func TestParse_UnknownFieldsPreserved(t *testing.T) {
+	data := []byte(`[{"event_type":"something_new","market":"0xmarket","timestamp":"1","extra":{"a":1}}]`)
+
+	messages, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	msg := messages[0]
+	msg.ReceivedAt = 5
+
+	out, err := json.Marshal(&msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"event_type":"something_new","market":"0xmarket","timestamp":"1","extra":{"a":1},"received_at":5}`
+	if string(out) != want {
+		t.Errorf("Marshal = %s, want %s", out, want)
+	}
+
+	event, err := msg.Event()
+	if err != nil {
+		t.Fatalf("Event failed: %v", err)
+	}
+	generic, ok := event.(*GenericEvent)
+	if !ok {
+		t.Fatalf("Event() returned %T, want *GenericEvent", event)
+	}
+	if _, ok := generic.Fields["extra"]; !ok {
+		t.Error("Expected unknown field to be available on GenericEvent")
+	}
+}
@@ -0,0 +1,523 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// PoolSubscriber receives the feed for one subscriber's tokens. Handler
+// gets the parsed messages for those tokens; RawHandler gets every frame
+// that contains at least one of them, narrowed to those messages when the
+// frame also carries other subscribers' messages. Either may be nil. A frame
+// that cannot be parsed is reported to every subscriber of the connection.
+type PoolSubscriber struct {
+	Handler      MessageHandler
+	RawHandler   RawHandler
+	OnDisconnect DisconnectHandler
+	OnReconnect  ReconnectHandler
+	OnParseError ParseErrorHandler
+}
+
+// PoolStats describes the pool's connections.
+type PoolStats struct {
+	Connections int `json:"connections"`
+	Subscribers int `json:"subscribers"`
+	Assets      int `json:"assets"`
+}
+
+// Pool multiplexes the subscriptions of many subscribers over a bounded
+// number of connections. Incoming messages are routed to subscribers by
+// asset_id, or by market for messages without a known asset.
+type Pool struct {
+	url             string
+	reconnectConfig ReconnectConfig
+	heartbeat       HeartbeatConfig
+	maxConns        int // 0 = unlimited
+	maxAssets       int // Per connection, 0 = unlimited
+	logger          *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	conns  []*poolConn
+	subs   map[string]*Subscription
+	closed bool
+	opened int // Connections opened so far, to number them in logs
+}
+
+// poolConn is one pooled connection and its routing table.
+type poolConn struct {
+	client *Client
+	logger *slog.Logger
+
+	// dialed is closed once the first dial has finished; dialErr is its
+	// outcome. Subscribers attach while the dial is still in progress.
+	dialed  chan struct{}
+	dialErr error
+
+	mu      sync.RWMutex
+	subs    map[string]*Subscription // key: subscriber ID
+	assets  map[string]*Subscription // key: asset ID
+	markets map[string]*Subscription // key: market (learned from messages)
+}
+
+// Subscription is one subscriber's share of a pooled connection.
+type Subscription struct {
+	id       string
+	pool     *Pool
+	conn     *poolConn
+	handlers PoolSubscriber
+	tokenIDs []string
+}
+
+// NewPool creates a connection pool. Connections are opened on demand, each
+// carrying at most maxAssetsPerConn assets, up to maxConns connections.
+// Zero means unlimited for either.
+func NewPool(maxConns, maxAssetsPerConn int) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		url:             DefaultWSURL,
+		reconnectConfig: DefaultReconnectConfig(),
+		heartbeat:       DefaultHeartbeatConfig(),
+		maxConns:        maxConns,
+		maxAssets:       maxAssetsPerConn,
+		logger:          slog.Default(),
+		ctx:             ctx,
+		cancel:          cancel,
+		subs:            make(map[string]*Subscription),
+	}
+}
+
+// WithURL sets a custom WebSocket URL for new connections.
+func (p *Pool) WithURL(url string) *Pool {
+	p.url = url
+	return p
+}
+
+// WithLogger sets the logger for new connections. Their records carry a
+// conn attribute numbering the connection.
+func (p *Pool) WithLogger(logger *slog.Logger) *Pool {
+	p.logger = logger
+	return p
+}
+
+// WithReconnectConfig sets the reconnection configuration for new connections.
+func (p *Pool) WithReconnectConfig(config ReconnectConfig) *Pool {
+	p.reconnectConfig = config
+	return p
+}
+
+// WithHeartbeat sets the heartbeat configuration for new connections.
+func (p *Pool) WithHeartbeat(config HeartbeatConfig) *Pool {
+	p.heartbeat = config
+	return p
+}
+
+// Subscribe adds a subscriber for the given tokens. All of a subscriber's
+// tokens share one connection; a new connection is opened if none has room.
+// Dialing happens without holding the pool lock, so other subscriptions can
+// be inspected and closed meanwhile. If the connection is reconnecting, the
+// tokens are queued and subscribed once it is back.
+func (p *Pool) Subscribe(id string, tokenIDs []string, handlers PoolSubscriber) (*Subscription, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("pool is closed")
+	}
+	if _, exists := p.subs[id]; exists {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("subscriber %s already exists", id)
+	}
+	if p.maxAssets > 0 && len(tokenIDs) > p.maxAssets {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%d tokens exceed the limit of %d per connection", len(tokenIDs), p.maxAssets)
+	}
+
+	pc := p.findConn(len(tokenIDs))
+	dial := false
+	if pc == nil {
+		if p.maxConns > 0 && len(p.conns) >= p.maxConns {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("all %d connections are full", p.maxConns)
+		}
+		// Registered before dialing so its capacity is reserved
+		pc = p.newConn()
+		p.conns = append(p.conns, pc)
+		dial = true
+	}
+
+	sub := &Subscription{
+		id:       id,
+		pool:     p,
+		conn:     pc,
+		handlers: handlers,
+		tokenIDs: tokenIDs,
+	}
+	pc.add(sub)
+	p.subs[id] = sub
+	p.mu.Unlock()
+
+	if dial {
+		p.connect(pc)
+	}
+	<-pc.dialed
+	if pc.dialErr != nil {
+		sub.Close()
+		return nil, pc.dialErr
+	}
+
+	if _, err := pc.client.AddAssets(tokenIDs); err != nil {
+		if !errors.Is(err, ErrNotConnected) {
+			sub.Close()
+			return nil, fmt.Errorf("subscribing to tokens: %w", err)
+		}
+		pc.logger.Info("Connection is not up, tokens queued until it reconnects",
+			"subscriber", id, "tokens", len(tokenIDs))
+	}
+	return sub, nil
+}
+
+// findConn returns the first connection with room for n more assets.
+func (p *Pool) findConn(n int) *poolConn {
+	for _, pc := range p.conns {
+		if p.maxAssets <= 0 || pc.assetCount()+n <= p.maxAssets {
+			return pc
+		}
+	}
+	return nil
+}
+
+// newConn creates a pooled connection that has not been dialed yet.
+// Must be called with p.mu held.
+func (p *Pool) newConn() *poolConn {
+	p.opened++
+	pc := &poolConn{
+		logger:  p.logger.With("conn", p.opened),
+		dialed:  make(chan struct{}),
+		subs:    make(map[string]*Subscription),
+		assets:  make(map[string]*Subscription),
+		markets: make(map[string]*Subscription),
+	}
+	pc.client = NewWSClient(nil).
+		WithLogger(pc.logger).
+		WithURL(p.url).
+		WithReconnectConfig(p.reconnectConfig).
+		WithHeartbeat(p.heartbeat).
+		WithFrameHandler(pc.dispatch).
+		OnParseError(pc.parseFailed).
+		OnDisconnect(pc.disconnected).
+		OnReconnect(pc.reconnected)
+	return pc
+}
+
+// connect dials a new connection and publishes the outcome to everyone
+// waiting on pc.dialed. A connection that fails to dial is taken out of the
+// pool so no new subscriber picks it. Must not be called with p.mu held.
+func (p *Pool) connect(pc *poolConn) {
+	defer close(pc.dialed)
+
+	if err := pc.client.Connect(p.ctx); err != nil {
+		pc.dialErr = fmt.Errorf("connecting WebSocket: %w", err)
+		p.mu.Lock()
+		p.dropConn(pc)
+		p.mu.Unlock()
+		return
+	}
+	pc.logger.Info("Opened pooled WebSocket connection")
+}
+
+// remove detaches a subscriber. A connection left without subscribers is
+// closed. Must be called with p.mu held.
+func (p *Pool) remove(sub *Subscription) {
+	delete(p.subs, sub.id)
+	pc := sub.conn
+	if pc.remove(sub) > 0 {
+		return
+	}
+
+	pc.client.Close()
+	p.dropConn(pc)
+}
+
+// dropConn removes a connection from the pool. Must be called with p.mu held.
+func (p *Pool) dropConn(pc *poolConn) {
+	for i, c := range p.conns {
+		if c == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+}
+
+// Stats returns the number of connections, subscribers and assets.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{Connections: len(p.conns), Subscribers: len(p.subs)}
+	for _, pc := range p.conns {
+		stats.Assets += pc.assetCount()
+	}
+	return stats
+}
+
+// Close closes every connection. Subscriptions become inert.
+func (p *Pool) Close() error {
+	// Cancel first so that pending dials give up
+	p.cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for _, pc := range p.conns {
+		pc.client.Close()
+	}
+	p.conns = nil
+	return nil
+}
+
+// Subscribe replaces the subscriber's tokens and resubscribes to them, which
+// makes the server send fresh book snapshots for this subscriber only;
+// other subscribers on the connection are not resent anything. While the
+// connection is down the new tokens are subscribed when it reconnects.
+func (s *Subscription) Subscribe(tokenIDs []string) error {
+	p := s.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.subs[s.id] != s {
+		return fmt.Errorf("subscription %s is closed", s.id)
+	}
+	pc := s.conn
+	if p.maxAssets > 0 && pc.assetCount()-len(s.tokenIDs)+len(tokenIDs) > p.maxAssets {
+		return fmt.Errorf("%d tokens do not fit on the connection", len(tokenIDs))
+	}
+
+	old := s.tokenIDs
+	pc.remove(s)
+	s.tokenIDs = tokenIDs
+	pc.add(s)
+	if stale := pc.unrouted(old); len(stale) > 0 {
+		if _, err := pc.client.RemoveAssets(stale); err != nil && !errors.Is(err, ErrNotConnected) {
+			return err
+		}
+	}
+	if err := pc.client.Refresh(tokenIDs); err != nil && !errors.Is(err, ErrNotConnected) {
+		return err
+	}
+	return nil
+}
+
+// State returns the state of the subscriber's connection, or StateClosed
+// once the subscription is closed.
+func (s *Subscription) State() State {
+	p := s.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.subs[s.id] != s {
+		return StateClosed
+	}
+	return s.conn.client.State()
+}
+
+// Close removes the subscriber from the pool.
+func (s *Subscription) Close() error {
+	p := s.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.subs[s.id] != s {
+		return nil
+	}
+	p.remove(s)
+	if pc := s.conn; pc.assetCount() > 0 {
+		if _, err := pc.client.RemoveAssets(s.tokenIDs); err != nil && !errors.Is(err, ErrNotConnected) {
+			pc.logger.Warn("Failed to unsubscribe pooled tokens", "subscriber", s.id, "err", err)
+		}
+	}
+	return nil
+}
+
+// add registers a subscriber's routes.
+func (pc *poolConn) add(sub *Subscription) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.subs[sub.id] = sub
+	for _, tokenID := range sub.tokenIDs {
+		pc.assets[tokenID] = sub
+	}
+}
+
+// remove drops a subscriber's routes and returns the remaining subscriber count.
+func (pc *poolConn) remove(sub *Subscription) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	delete(pc.subs, sub.id)
+	for _, tokenID := range sub.tokenIDs {
+		if pc.assets[tokenID] == sub {
+			delete(pc.assets, tokenID)
+		}
+	}
+	for market, s := range pc.markets {
+		if s == sub {
+			delete(pc.markets, market)
+		}
+	}
+	return len(pc.subs)
+}
+
+func (pc *poolConn) assetCount() int {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return len(pc.assets)
+}
+
+func (pc *poolConn) assetIDs() []string {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	ids := make([]string, 0, len(pc.assets))
+	for id := range pc.assets {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// unrouted returns the tokens that no subscriber on the connection uses.
+func (pc *poolConn) unrouted(tokenIDs []string) []string {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	var ids []string
+	for _, id := range tokenIDs {
+		if _, ok := pc.assets[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// route returns the subscriber for a message, learning the market of each
+// asset as messages arrive.
+func (pc *poolConn) route(msg *WSMessage) *Subscription {
+	assetID := msg.AssetID
+	if assetID == "" && len(msg.PriceChanges) > 0 {
+		assetID = msg.PriceChanges[0].AssetID
+	}
+
+	pc.mu.RLock()
+	sub := pc.assets[assetID]
+	known := msg.Market == "" || pc.markets[msg.Market] == sub
+	if sub == nil {
+		sub = pc.markets[msg.Market]
+	}
+	pc.mu.RUnlock()
+
+	if sub != nil && !known {
+		pc.mu.Lock()
+		if pc.subs[sub.id] == sub {
+			pc.markets[msg.Market] = sub
+		}
+		pc.mu.Unlock()
+	}
+	return sub
+}
+
+// parseFailed passes a frame that cannot be parsed to every subscriber,
+// so raw archives stay complete.
+func (pc *poolConn) parseFailed(frame RawFrame, err error) {
+	for _, sub := range pc.subscribers() {
+		if sub.handlers.RawHandler != nil {
+			sub.handlers.RawHandler(frame)
+		}
+		if sub.handlers.OnParseError != nil {
+			sub.handlers.OnParseError(frame, err)
+		}
+	}
+}
+
+// dispatch routes a frame's messages, parsed once by the client, to their
+// subscribers.
+func (pc *poolConn) dispatch(frame RawFrame, messages []WSMessage) {
+	// Group by subscriber, in order of first appearance
+	var order []*Subscription
+	routed := make(map[*Subscription][]WSMessage)
+	for i := range messages {
+		sub := pc.route(&messages[i])
+		if sub == nil {
+			continue
+		}
+		if _, ok := routed[sub]; !ok {
+			order = append(order, sub)
+		}
+		routed[sub] = append(routed[sub], messages[i])
+	}
+
+	for _, sub := range order {
+		if sub.handlers.RawHandler != nil {
+			if len(routed[sub]) == len(messages) {
+				sub.handlers.RawHandler(frame)
+			} else {
+				sub.handlers.RawHandler(narrowFrame(frame, routed[sub]))
+			}
+		}
+		if sub.handlers.Handler != nil {
+			sub.handlers.Handler(routed[sub])
+		}
+	}
+}
+
+// narrowFrame builds a frame holding only the given messages of a frame,
+// as a JSON array of their original encodings.
+func narrowFrame(frame RawFrame, messages []WSMessage) RawFrame {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := range messages {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(messages[i].Raw)
+	}
+	buf.WriteByte(']')
+	return RawFrame{ReceivedAt: frame.ReceivedAt, Data: buf.Bytes()}
+}
+
+func (pc *poolConn) subscribers() []*Subscription {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	subs := make([]*Subscription, 0, len(pc.subs))
+	for _, sub := range pc.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+func (pc *poolConn) disconnected(at time.Time, reason DisconnectReason, err error) {
+	for _, sub := range pc.subscribers() {
+		if sub.handlers.OnDisconnect != nil {
+			sub.handlers.OnDisconnect(at, reason, err)
+		}
+	}
+}
+
+func (pc *poolConn) reconnected(gap Gap) {
+	for _, sub := range pc.subscribers() {
+		if sub.handlers.OnReconnect != nil {
+			sub.handlers.OnReconnect(gap)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// marketServer answers every subscribe message with one book snapshot per
+// asset, using "market-<asset>" as the market, and can broadcast frames.
+type marketServer struct {
+	*httptest.Server
+
+	down  atomic.Bool // Reject connections while set
+	mu    sync.Mutex
+	conns []*websocket.Conn
+}
+
+func newMarketServer(t *testing.T) *marketServer {
+	t.Helper()
+	ms := &marketServer{}
+	upgrader := websocket.Upgrader{}
+	ms.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ms.down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ms.mu.Lock()
+		ms.conns = append(ms.conns, conn)
+		ms.mu.Unlock()
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var sub SubscribeMessage
+			if json.Unmarshal(data, &sub) != nil || sub.Operation == OperationUnsubscribe {
+				continue
+			}
+			var books []string
+			for _, id := range sub.AssetsIDs {
+				books = append(books, fmt.Sprintf(`{"event_type":"book","asset_id":%q,"market":"market-%s","bids":[],"asks":[]}`, id, id))
+			}
+			ms.mu.Lock()
+			conn.WriteMessage(websocket.TextMessage, []byte("["+strings.Join(books, ",")+"]"))
+			ms.mu.Unlock()
+		}
+	}))
+	t.Cleanup(ms.Close)
+	return ms
+}
+
+func (ms *marketServer) wsURL() string {
+	return "ws" + strings.TrimPrefix(ms.URL, "http")
+}
+
+func (ms *marketServer) broadcast(frame string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, conn := range ms.conns {
+		conn.WriteMessage(websocket.TextMessage, []byte(frame))
+	}
+}
+
+// dropAll closes every open connection.
+func (ms *marketServer) dropAll() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, conn := range ms.conns {
+		conn.Close()
+	}
+	ms.conns = nil
+}
+
+// inbox records the messages delivered to one subscriber.
+type inbox struct {
+	mu       sync.Mutex
+	messages []WSMessage
+}
+
+func (in *inbox) handle(messages []WSMessage) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.messages = append(in.messages, messages...)
+}
+
+func (in *inbox) assets() map[string]int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	counts := make(map[string]int)
+	for _, msg := range in.messages {
+		counts[msg.AssetID+msg.Market]++
+	}
+	return counts
+}
+
+func newTestPool(url string, maxConns, maxAssets int) *Pool {
+	return NewPool(maxConns, maxAssets).
+		WithURL(url).
+		WithHeartbeat(HeartbeatConfig{})
+}
+
+func TestPool_RoutesByAsset(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 10)
+	defer p.Close()
+
+	var a, b inbox
+	if _, err := p.Subscribe("a", []string{"a1", "a2"}, PoolSubscriber{Handler: a.handle}); err != nil {
+		t.Fatalf("Subscribe a failed: %v", err)
+	}
+	if _, err := p.Subscribe("b", []string{"b1"}, PoolSubscriber{Handler: b.handle}); err != nil {
+		t.Fatalf("Subscribe b failed: %v", err)
+	}
+
+	waitUntil(t, func() bool { return len(b.assets()) > 0 })
+	for key := range a.assets() {
+		if !strings.HasPrefix(key, "a") {
+			t.Errorf("Subscriber a got %s", key)
+		}
+	}
+	for key := range b.assets() {
+		if !strings.HasPrefix(key, "b") {
+			t.Errorf("Subscriber b got %s", key)
+		}
+	}
+
+	if stats := p.Stats(); stats.Connections != 1 || stats.Subscribers != 2 || stats.Assets != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPool_ResubscribeOnlySendsOwnTokens(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 10)
+	defer p.Close()
+
+	var a, b inbox
+	subA, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{Handler: a.handle})
+	if err != nil {
+		t.Fatalf("Subscribe a failed: %v", err)
+	}
+	if _, err := p.Subscribe("b", []string{"b1"}, PoolSubscriber{Handler: b.handle}); err != nil {
+		t.Fatalf("Subscribe b failed: %v", err)
+	}
+	waitUntil(t, func() bool { return a.assets()["a1market-a1"] == 1 && b.assets()["b1market-b1"] == 1 })
+
+	// A resync of a sends a fresh snapshot to a only
+	if err := subA.Subscribe([]string{"a1"}); err != nil {
+		t.Fatalf("Resubscribe failed: %v", err)
+	}
+	waitUntil(t, func() bool { return a.assets()["a1market-a1"] == 2 })
+	if n := b.assets()["b1market-b1"]; n != 1 {
+		t.Errorf("b got %d snapshots, want 1", n)
+	}
+}
+
+func TestPool_RoutesByMarket(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 0)
+	defer p.Close()
+
+	var a inbox
+	if _, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{Handler: a.handle}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	waitUntil(t, func() bool { return a.assets()["a1market-a1"] == 1 })
+
+	// No asset ID: routed by the market learned from the snapshot
+	ms.broadcast(`{"event_type":"tick_size_change","market":"market-a1"}`)
+	ms.broadcast(`{"event_type":"tick_size_change","market":"market-unknown"}`)
+	waitUntil(t, func() bool { return a.assets()["market-a1"] == 1 })
+
+	time.Sleep(50 * time.Millisecond)
+	if n := a.assets()["market-unknown"]; n != 0 {
+		t.Errorf("Unroutable message delivered %d times", n)
+	}
+}
+
+func TestPool_ParseErrorReachesEverySubscriber(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 0)
+	defer p.Close()
+
+	var a, b inbox
+	var errs atomic.Int64
+	onParseError := func(frame RawFrame, err error) { errs.Add(1) }
+	if _, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{Handler: a.handle, OnParseError: onParseError}); err != nil {
+		t.Fatalf("Subscribe a failed: %v", err)
+	}
+	if _, err := p.Subscribe("b", []string{"b1"}, PoolSubscriber{Handler: b.handle, OnParseError: onParseError}); err != nil {
+		t.Fatalf("Subscribe b failed: %v", err)
+	}
+	waitUntil(t, func() bool { return len(a.assets()) > 0 && len(b.assets()) > 0 })
+
+	ms.broadcast(`{not json`)
+	waitUntil(t, func() bool { return errs.Load() == 2 })
+}
+
+func TestPool_AssetCap(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 2, 2)
+	defer p.Close()
+
+	handlers := PoolSubscriber{Handler: func([]WSMessage) {}}
+	if _, err := p.Subscribe("a", []string{"a1", "a2"}, handlers); err != nil {
+		t.Fatalf("Subscribe a failed: %v", err)
+	}
+	b, err := p.Subscribe("b", []string{"b1"}, handlers)
+	if err != nil {
+		t.Fatalf("Subscribe b failed: %v", err)
+	}
+	if _, err := p.Subscribe("c", []string{"c1"}, handlers); err != nil {
+		t.Fatalf("Subscribe c failed: %v", err)
+	}
+	if stats := p.Stats(); stats.Connections != 2 {
+		t.Errorf("Connections = %d, want 2", stats.Connections)
+	}
+
+	// Both connections are full
+	if _, err := p.Subscribe("d", []string{"d1"}, handlers); err == nil {
+		t.Error("Expected error when all connections are full")
+	}
+	if _, err := p.Subscribe("e", []string{"e1", "e2", "e3"}, handlers); err == nil {
+		t.Error("Expected error for more tokens than fit on a connection")
+	}
+
+	// Freeing a slot makes room again
+	b.Close()
+	if _, err := p.Subscribe("d", []string{"d1"}, handlers); err != nil {
+		t.Errorf("Subscribe d after close failed: %v", err)
+	}
+}
+
+func TestPool_CloseLastSubscriberClosesConnection(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 0)
+	defer p.Close()
+
+	sub, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if _, err := p.Subscribe("a", []string{"a2"}, PoolSubscriber{}); err == nil {
+		t.Error("Expected error for duplicate subscriber ID")
+	}
+
+	sub.Close()
+	if stats := p.Stats(); stats.Connections != 0 || stats.Subscribers != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if err := sub.Subscribe([]string{"a1"}); err == nil {
+		t.Error("Expected error resubscribing a closed subscription")
+	}
+}
+
+func TestPool_RawFrameNarrowedToSubscriber(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 0)
+	defer p.Close()
+
+	var mu sync.Mutex
+	var frames []string
+	rawA := func(frame RawFrame) {
+		mu.Lock()
+		defer mu.Unlock()
+		frames = append(frames, string(frame.Data))
+	}
+	var b inbox
+	if _, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{RawHandler: rawA}); err != nil {
+		t.Fatalf("Subscribe a failed: %v", err)
+	}
+	if _, err := p.Subscribe("b", []string{"b1"}, PoolSubscriber{Handler: b.handle}); err != nil {
+		t.Fatalf("Subscribe b failed: %v", err)
+	}
+	waitUntil(t, func() bool { return len(b.assets()) > 0 })
+
+	ms.broadcast(`[{"event_type":"last_trade_price","asset_id":"b1","market":"market-b1"},{"event_type":"last_trade_price","asset_id":"a1","market":"market-a1"}]`)
+	want := `[{"event_type":"last_trade_price","asset_id":"a1","market":"market-a1"}]`
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(frames) > 0 && frames[len(frames)-1] == want
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, frame := range frames {
+		if strings.Contains(frame, "b1") {
+			t.Errorf("Subscriber a archived a frame with b1: %s", frame)
+		}
+	}
+}
+
+func TestPool_DialDoesNotHoldLock(t *testing.T) {
+	ms := newMarketServer(t)
+	ms.down.Store(true)
+	p := newTestPool(ms.wsURL(), 0, 0).WithReconnectConfig(ReconnectConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		BackoffFactor:  1,
+	})
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{})
+		result <- err
+	}()
+
+	// Stats takes the pool lock; it must not wait for the dial
+	waitUntil(t, func() bool { return p.Stats().Subscribers == 1 })
+
+	p.Close()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected Subscribe to fail once the pool is closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe did not return after Close")
+	}
+	if stats := p.Stats(); stats.Connections != 0 || stats.Subscribers != 0 {
+		t.Errorf("stats = %+v, want no connections or subscribers", stats)
+	}
+}
+
+func TestPool_SubscribeWhileReconnecting(t *testing.T) {
+	ms := newMarketServer(t)
+	p := newTestPool(ms.wsURL(), 0, 0).WithReconnectConfig(ReconnectConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		BackoffFactor:  1,
+	})
+	defer p.Close()
+
+	var a, b inbox
+	subA, err := p.Subscribe("a", []string{"a1"}, PoolSubscriber{Handler: a.handle})
+	if err != nil {
+		t.Fatalf("Subscribe a failed: %v", err)
+	}
+	waitUntil(t, func() bool { return len(a.assets()) > 0 })
+
+	ms.down.Store(true)
+	ms.dropAll()
+	waitUntil(t, func() bool { return subA.State() != StateConnected })
+
+	if _, err := p.Subscribe("b", []string{"b1"}, PoolSubscriber{Handler: b.handle}); err != nil {
+		t.Fatalf("Subscribe b while reconnecting failed: %v", err)
+	}
+
+	ms.down.Store(false)
+	waitUntil(t, func() bool { return b.assets()["b1market-b1"] > 0 })
+}
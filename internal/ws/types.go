@@ -2,16 +2,34 @@
 package ws
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
 	"github.com/johan/polymarket-collector/internal/types"
 )
 
 // SubscribeMessage is the message sent to subscribe to token updates.
+// The initial subscription on a connection has no operation; later changes
+// set Operation to add or remove tokens without resending the whole list.
 type SubscribeMessage struct {
 	AssetsIDs []string `json:"assets_ids"`
 	Type      string   `json:"type,omitempty"`
+	Operation string   `json:"operation,omitempty"`
 }
 
+// Subscription operations.
+const (
+	OperationSubscribe   = "subscribe"
+	OperationUnsubscribe = "unsubscribe"
+)
+
 // WSMessage represents a message received from the WebSocket.
+// It is a union of every market channel event; only the fields relevant
+// to EventType are populated. Use Event to get a typed view.
 type WSMessage struct {
 	EventType      string             `json:"event_type"`
 	Market         string             `json:"market"`
@@ -22,6 +40,30 @@ type WSMessage struct {
 	Asks           []types.PriceLevel `json:"asks,omitempty"`
 	LastTradePrice string             `json:"last_trade_price,omitempty"`
 	PriceChanges   []PriceChange      `json:"price_changes,omitempty"`
+
+	// last_trade_price fields
+	Price      string `json:"price,omitempty"`
+	Size       string `json:"size,omitempty"`
+	Side       string `json:"side,omitempty"` // "BUY" or "SELL"
+	FeeRateBps string `json:"fee_rate_bps,omitempty"`
+
+	// tick_size_change fields
+	OldTickSize string `json:"old_tick_size,omitempty"`
+	NewTickSize string `json:"new_tick_size,omitempty"`
+
+	// best_bid_ask fields
+	BestBid string `json:"best_bid,omitempty"`
+	BestAsk string `json:"best_ask,omitempty"`
+	Spread  string `json:"spread,omitempty"`
+
+	// Local receive metadata, set by the client (not sent by the server)
+	ReceivedAt int64   `json:"received_at,omitempty"` // Unix nanoseconds
+	LatencyMs  float64 `json:"latency_ms,omitempty"`  // ReceivedAt minus exchange Timestamp
+
+	// Raw is the original JSON object as received from the server.
+	// When set, it takes precedence over the fields above when marshaling,
+	// so fields that are not modelled yet are preserved.
+	Raw json.RawMessage `json:"-"`
 }
 
 // PriceChange represents a single price level change.
@@ -35,8 +77,286 @@ type PriceChange struct {
 	BestAsk string `json:"best_ask"`
 }
 
-// EventTypeBook is the event type for a full order book snapshot.
-const EventTypeBook = "book"
+// Market channel event types.
+const (
+	// EventTypeBook is the event type for a full order book snapshot.
+	EventTypeBook = "book"
+
+	// EventTypePriceChange is the event type for price level changes.
+	EventTypePriceChange = "price_change"
+
+	// EventTypeTickSizeChange is the event type for a change of the minimum tick size.
+	EventTypeTickSizeChange = "tick_size_change"
+
+	// EventTypeLastTradePrice is the event type for a trade execution.
+	EventTypeLastTradePrice = "last_trade_price"
+
+	// EventTypeBestBidAsk is the event type for top-of-book updates.
+	EventTypeBestBidAsk = "best_bid_ask"
+
+	// EventTypeNewMarket is the event type for a newly created market.
+	EventTypeNewMarket = "new_market"
+
+	// EventTypeMarketResolved is the event type for a resolved market.
+	EventTypeMarketResolved = "market_resolved"
+)
+
+// BookEvent is a full order book snapshot.
+type BookEvent struct {
+	EventType      string             `json:"event_type"`
+	Market         string             `json:"market"`
+	AssetID        string             `json:"asset_id"`
+	Timestamp      string             `json:"timestamp"`
+	Hash           string             `json:"hash"`
+	Bids           []types.PriceLevel `json:"bids"`
+	Asks           []types.PriceLevel `json:"asks"`
+	LastTradePrice string             `json:"last_trade_price,omitempty"`
+}
+
+// PriceChangeEvent is a batch of price level changes for one market.
+type PriceChangeEvent struct {
+	EventType    string        `json:"event_type"`
+	Market       string        `json:"market"`
+	Timestamp    string        `json:"timestamp"`
+	PriceChanges []PriceChange `json:"price_changes"`
+}
+
+// TickSizeChangeEvent is emitted when the minimum tick size of a market changes.
+type TickSizeChangeEvent struct {
+	EventType   string `json:"event_type"`
+	Market      string `json:"market"`
+	AssetID     string `json:"asset_id"`
+	Timestamp   string `json:"timestamp"`
+	OldTickSize string `json:"old_tick_size"`
+	NewTickSize string `json:"new_tick_size"`
+}
+
+// LastTradePriceEvent is emitted when a trade is executed.
+type LastTradePriceEvent struct {
+	EventType  string `json:"event_type"`
+	Market     string `json:"market"`
+	AssetID    string `json:"asset_id"`
+	Timestamp  string `json:"timestamp"`
+	Price      string `json:"price"`
+	Size       string `json:"size"`
+	Side       string `json:"side"`
+	FeeRateBps string `json:"fee_rate_bps"`
+}
+
+// BestBidAskEvent is a top-of-book update.
+type BestBidAskEvent struct {
+	EventType string `json:"event_type"`
+	Market    string `json:"market"`
+	AssetID   string `json:"asset_id"`
+	Timestamp string `json:"timestamp"`
+	BestBid   string `json:"best_bid"`
+	BestAsk   string `json:"best_ask"`
+	Spread    string `json:"spread"`
+}
+
+// GenericEvent holds any event without a dedicated struct (new_market,
+// market_resolved and event types we don't know about yet).
+type GenericEvent struct {
+	EventType string
+	Fields    map[string]json.RawMessage
+}
+
+// Event decodes the message into the typed struct for its event type:
+// *BookEvent, *PriceChangeEvent, *TickSizeChangeEvent, *LastTradePriceEvent,
+// *BestBidAskEvent, or *GenericEvent for anything else.
+func (m *WSMessage) Event() (any, error) {
+	data := m.Raw
+	if len(data) == 0 {
+		var err error
+		if data, err = json.Marshal(m); err != nil {
+			return nil, fmt.Errorf("marshaling message: %w", err)
+		}
+	}
+
+	var event any
+	switch m.EventType {
+	case EventTypeBook:
+		event = &BookEvent{}
+	case EventTypePriceChange:
+		event = &PriceChangeEvent{}
+	case EventTypeTickSizeChange:
+		event = &TickSizeChangeEvent{}
+	case EventTypeLastTradePrice:
+		event = &LastTradePriceEvent{}
+	case EventTypeBestBidAsk:
+		event = &BestBidAskEvent{}
+	default:
+		generic := &GenericEvent{EventType: m.EventType}
+		if err := json.Unmarshal(data, &generic.Fields); err != nil {
+			return nil, fmt.Errorf("decoding %s event: %w", m.EventType, err)
+		}
+		return generic, nil
+	}
+
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("decoding %s event: %w", m.EventType, err)
+	}
+	return event, nil
+}
+
+// MarshalJSON encodes the message. If the original server JSON is available
+// it is written unchanged, with the local receive metadata appended.
+// Receive metadata already present in Raw (a record read back from disk) is
+// replaced by the values on the message, so keys are never duplicated.
+func (m WSMessage) MarshalJSON() ([]byte, error) {
+	type plain WSMessage
+	if len(m.Raw) == 0 {
+		return json.Marshal(plain(m))
+	}
+
+	raw := bytes.TrimSpace(m.Raw)
+	if len(raw) < 2 || raw[0] != '{' || raw[len(raw)-1] != '}' {
+		return nil, fmt.Errorf("raw message is not a JSON object: %s", truncate(raw, 100))
+	}
+	if bytes.Contains(raw, []byte(`"received_at"`)) || bytes.Contains(raw, []byte(`"latency_ms"`)) {
+		var err error
+		if raw, err = stripFields(raw, "received_at", "latency_ms"); err != nil {
+			return nil, fmt.Errorf("raw message: %w", err)
+		}
+	}
 
-// EventTypePriceChange is the event type for price level changes.
-const EventTypePriceChange = "price_change"
+	body := bytes.TrimSpace(raw[1 : len(raw)-1])
+	buf := make([]byte, 0, len(raw)+64)
+	buf = append(buf, '{')
+	buf = append(buf, body...)
+
+	appendField := func(name, value string) {
+		if len(buf) > 1 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '"')
+		buf = append(buf, name...)
+		buf = append(buf, `":`...)
+		buf = append(buf, value...)
+	}
+	if m.ReceivedAt != 0 {
+		appendField("received_at", strconv.FormatInt(m.ReceivedAt, 10))
+	}
+	if m.LatencyMs != 0 {
+		appendField("latency_ms", strconv.FormatFloat(m.LatencyMs, 'f', -1, 64))
+	}
+
+	buf = append(buf, '}')
+	return buf, nil
+}
+
+// stripFields removes the named top-level keys from a JSON object, keeping
+// the remaining fields and their values byte for byte in their original order.
+func stripFields(obj []byte, names ...string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(obj))
+	out = append(out, '{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if slices.Contains(names, key) {
+			continue
+		}
+
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, name...)
+		out = append(out, ':')
+		out = append(out, value...)
+	}
+	out = append(out, '}')
+	return out, nil
+}
+
+// Stamp records the local receive time on the message and computes the feed
+// latency from the exchange timestamp (milliseconds since epoch). Latency is
+// left unset if the exchange timestamp is missing or invalid.
+func (m *WSMessage) Stamp(receivedAt time.Time) {
+	m.ReceivedAt = receivedAt.UnixNano()
+	m.LatencyMs = 0
+
+	exchangeMs, err := strconv.ParseInt(m.Timestamp, 10, 64)
+	if err != nil || exchangeMs <= 0 {
+		return
+	}
+	m.LatencyMs = float64(m.ReceivedAt-exchangeMs*int64(time.Millisecond)) / float64(time.Millisecond)
+}
+
+// RawFrame is a WebSocket frame exactly as received from the server,
+// together with its local receive time. Parsing can be deferred until later.
+type RawFrame struct {
+	ReceivedAt time.Time
+	Data       []byte
+}
+
+// rawRecord is the on-disk representation of a RawFrame.
+// Frames that are single-line JSON are embedded verbatim in Raw;
+// anything else is base64 encoded in RawBase64.
+type rawRecord struct {
+	ReceivedAt int64           `json:"received_at"`
+	Raw        json.RawMessage `json:"raw,omitempty"`
+	RawBase64  []byte          `json:"raw_b64,omitempty"`
+}
+
+// Parse parses the frame and stamps each message with the frame's receive time.
+func (f RawFrame) Parse() ([]WSMessage, error) {
+	messages, err := Parse(f.Data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Stamp(f.ReceivedAt)
+	}
+	return messages, nil
+}
+
+// MarshalJSON encodes the frame as a single-line JSON record with the frame
+// bytes embedded unchanged. Note that json.Marshal re-compacts the output of
+// MarshalJSON; call this method directly to keep the frame byte-exact.
+func (f RawFrame) MarshalJSON() ([]byte, error) {
+	if json.Valid(f.Data) && bytes.IndexAny(f.Data, "\r\n") < 0 {
+		buf := make([]byte, 0, len(f.Data)+48)
+		buf = append(buf, `{"received_at":`...)
+		buf = strconv.AppendInt(buf, f.ReceivedAt.UnixNano(), 10)
+		buf = append(buf, `,"raw":`...)
+		buf = append(buf, f.Data...)
+		buf = append(buf, '}')
+		return buf, nil
+	}
+
+	return json.Marshal(rawRecord{
+		ReceivedAt: f.ReceivedAt.UnixNano(),
+		RawBase64:  f.Data,
+	})
+}
+
+// UnmarshalJSON decodes a record written by MarshalJSON.
+func (f *RawFrame) UnmarshalJSON(data []byte) error {
+	var rec rawRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	f.ReceivedAt = time.Unix(0, rec.ReceivedAt)
+	if len(rec.Raw) > 0 {
+		f.Data = rec.Raw
+	} else {
+		f.Data = rec.RawBase64
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package ws
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWSMessage_Stamp(t *testing.T) {
+	msg := WSMessage{EventType: EventTypeBook, Timestamp: "1770358715148"}
+	receivedAt := time.UnixMilli(1770358715148).Add(42*time.Millisecond + 500*time.Microsecond)
+
+	msg.Stamp(receivedAt)
+
+	if msg.ReceivedAt != receivedAt.UnixNano() {
+		t.Errorf("ReceivedAt = %d, want %d", msg.ReceivedAt, receivedAt.UnixNano())
+	}
+	if msg.LatencyMs != 42.5 {
+		t.Errorf("LatencyMs = %v, want 42.5", msg.LatencyMs)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"received_at":`) || !strings.Contains(string(data), `"latency_ms":42.5`) {
+		t.Errorf("Marshaled message missing receive metadata: %s", data)
+	}
+}
+
+func TestWSMessage_StampInvalidTimestamp(t *testing.T) {
+	msg := WSMessage{EventType: EventTypeBook, Timestamp: ""}
+	msg.Stamp(time.Now())
+
+	if msg.ReceivedAt == 0 {
+		t.Error("Expected ReceivedAt to be set")
+	}
+	if msg.LatencyMs != 0 {
+		t.Errorf("LatencyMs = %v, want 0 for missing timestamp", msg.LatencyMs)
+	}
+}
+
+func TestWSMessage_MarshalRecordReadBack(t *testing.T) {
+	record := `{"event_type":"book","asset_id":"1","timestamp":"1000","received_at":1010000000,"latency_ms":10}`
+
+	var msg WSMessage
+	if err := json.Unmarshal([]byte(record), &msg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	msg.Raw = json.RawMessage(record)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != record {
+		t.Errorf("Marshal = %s, want %s", data, record)
+	}
+
+	msg.Stamp(time.UnixMilli(1025))
+	data, err = json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"event_type":"book","asset_id":"1","timestamp":"1000","received_at":1025000000,"latency_ms":25}`
+	if string(data) != want {
+		t.Errorf("Marshal after restamp = %s, want %s", data, want)
+	}
+}
+
+func TestRawFrame_MarshalByteExact(t *testing.T) {
+	data := []byte(`[{"event_type":"book","asset_id":"1","bids":[ ],"note":"a<b&c"}]`)
+	frame := RawFrame{ReceivedAt: time.Unix(0, 1770358715148000000), Data: data}
+
+	out, err := frame.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	want := `{"received_at":1770358715148000000,"raw":` + string(data) + `}`
+	if string(out) != want {
+		t.Errorf("MarshalJSON = %s, want %s", out, want)
+	}
+
+	var decoded RawFrame
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if string(decoded.Data) != string(data) {
+		t.Errorf("Round trip Data = %s, want %s", decoded.Data, data)
+	}
+	if !decoded.ReceivedAt.Equal(frame.ReceivedAt) {
+		t.Errorf("Round trip ReceivedAt = %v, want %v", decoded.ReceivedAt, frame.ReceivedAt)
+	}
+}
+
+func TestRawFrame_NonJSONFallback(t *testing.T) {
+	for _, data := range [][]byte{[]byte("PONG"), []byte("[{\"a\":1},\n{\"b\":2}]")} {
+		frame := RawFrame{ReceivedAt: time.Unix(0, 1), Data: data}
+
+		out, err := frame.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON(%q) failed: %v", data, err)
+		}
+		if strings.Contains(string(out), "\n") {
+			t.Errorf("MarshalJSON(%q) produced a multi-line record: %s", data, out)
+		}
+
+		var decoded RawFrame
+		if err := json.Unmarshal(out, &decoded); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if string(decoded.Data) != string(data) {
+			t.Errorf("Round trip Data = %q, want %q", decoded.Data, data)
+		}
+	}
+}
+
+func TestRawFrame_Parse(t *testing.T) {
+	frame := RawFrame{
+		ReceivedAt: time.UnixMilli(1010),
+		Data:       []byte(`[{"event_type":"book","asset_id":"1","timestamp":"1000"}]`),
+	}
+
+	messages, err := frame.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].LatencyMs != 10 {
+		t.Errorf("Parse = %+v, want one message with 10ms latency", messages)
+	}
+}
@@ -0,0 +1,353 @@
+// Package wstest provides an in-process Polymarket market channel server
+// for tests.
+//
+// The server accepts subscribe messages, answers PINGs and replies to each
+// subscription with a book snapshot per new asset. Tests script further
+// traffic with Play: events, raw or malformed frames, delays and
+// disconnects.
+package wstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/johan/polymarket-collector/internal/types"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// SubscribeHandler returns the steps to play on a connection after it
+// receives a subscription message.
+type SubscribeHandler func(msg ws.SubscribeMessage) []Step
+
+// Server is a fake market channel endpoint.
+type Server struct {
+	// URL is the ws:// URL of the server
+	URL string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	conns         map[*conn]struct{}
+	accepted      int
+	subscriptions []ws.SubscribeMessage
+	onSubscribe   SubscribeHandler
+	pong          bool
+}
+
+// conn is one client connection.
+type conn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+	assets  map[string]bool // Guarded by Server.mu
+}
+
+// NewServer starts a server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		conns:       make(map[*conn]struct{}),
+		onSubscribe: SnapshotOnSubscribe,
+		pong:        true,
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+// SetSubscribeHandler replaces the reply to subscription messages.
+// A nil handler sends nothing.
+func (s *Server) SetSubscribeHandler(handler SubscribeHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSubscribe = handler
+}
+
+// SetPong sets whether PINGs are answered. Without PONGs and other traffic
+// the connection looks half-open to the client.
+func (s *Server) SetPong(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pong = enabled
+}
+
+// Close disconnects all clients and stops the server.
+func (s *Server) Close() {
+	// Hijacked connections are not closed by httptest, and Close waits for
+	// their handlers to return
+	s.mu.Lock()
+	for c := range s.conns {
+		c.ws.NetConn().Close()
+	}
+	s.mu.Unlock()
+	s.srv.Close()
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// Open returns the number of open connections.
+func (s *Server) Open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Subscriptions returns every subscription message received, in order.
+func (s *Server) Subscriptions() []ws.SubscribeMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ws.SubscribeMessage(nil), s.subscriptions...)
+}
+
+// Assets returns the sorted assets subscribed on open connections.
+func (s *Server) Assets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for c := range s.conns {
+		for assetID := range c.assets {
+			seen[assetID] = true
+		}
+	}
+	assets := make([]string, 0, len(seen))
+	for assetID := range seen {
+		assets = append(assets, assetID)
+	}
+	sort.Strings(assets)
+	return assets
+}
+
+// Play runs the steps in order against every open connection.
+func (s *Server) Play(steps ...Step) error {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, step := range steps {
+		if step.delay > 0 {
+			time.Sleep(step.delay)
+			continue
+		}
+		for _, c := range conns {
+			if err := c.play(step); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WaitFor polls cond until it holds or the timeout expires.
+func (s *Server) WaitFor(timeout time.Duration, cond func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("condition not met within %v", timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{ws: wsConn, assets: make(map[string]bool)}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.accepted++
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		wsConn.Close()
+	}()
+
+	for {
+		_, data, err := wsConn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if string(data) == "PING" {
+			s.mu.Lock()
+			pong := s.pong
+			s.mu.Unlock()
+			if pong {
+				c.play(Raw([]byte("PONG")))
+			}
+			continue
+		}
+
+		var msg ws.SubscribeMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		s.subscriptions = append(s.subscriptions, msg)
+		var added []string
+		for _, assetID := range msg.AssetsIDs {
+			if msg.Operation == ws.OperationUnsubscribe {
+				delete(c.assets, assetID)
+			} else if !c.assets[assetID] {
+				c.assets[assetID] = true
+				added = append(added, assetID)
+			}
+		}
+		handler := s.onSubscribe
+		s.mu.Unlock()
+
+		if handler == nil || msg.Operation == ws.OperationUnsubscribe {
+			continue
+		}
+		// Like the real server, only new assets get a snapshot
+		reply := msg
+		reply.AssetsIDs = added
+		for _, step := range handler(reply) {
+			if step.delay > 0 {
+				time.Sleep(step.delay)
+				continue
+			}
+			if err := c.play(step); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) play(step Step) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	switch {
+	case step.disconnect:
+		// Drop the TCP connection without a close frame
+		return c.ws.NetConn().Close()
+	case step.closeCode != 0:
+		msg := websocket.FormatCloseMessage(step.closeCode, "")
+		c.ws.WriteMessage(websocket.CloseMessage, msg)
+		return c.ws.Close()
+	default:
+		return c.ws.WriteMessage(websocket.TextMessage, step.data)
+	}
+}
+
+// Step is one action of a script.
+type Step struct {
+	data       []byte
+	delay      time.Duration
+	disconnect bool
+	closeCode  int
+}
+
+// Send sends v encoded as JSON, e.g. an event or a slice of events.
+func Send(v any) Step {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("wstest: marshaling %T: %v", v, err))
+	}
+	return Step{data: data}
+}
+
+// Raw sends a frame as is.
+func Raw(data []byte) Step {
+	return Step{data: data}
+}
+
+// Malformed sends a truncated JSON frame.
+func Malformed() Step {
+	return Raw([]byte(`[{"event_type":"book","asset_id":`))
+}
+
+// Delay pauses the script.
+func Delay(d time.Duration) Step {
+	return Step{delay: d}
+}
+
+// Disconnect drops the connection abruptly, like a network failure.
+func Disconnect() Step {
+	return Step{disconnect: true}
+}
+
+// CloseWith closes the connection with a close frame and status code.
+func CloseWith(code int) Step {
+	return Step{closeCode: code}
+}
+
+// SnapshotOnSubscribe is the default subscribe handler. It replies with an
+// empty book snapshot for every newly subscribed asset.
+func SnapshotOnSubscribe(msg ws.SubscribeMessage) []Step {
+	if len(msg.AssetsIDs) == 0 {
+		return nil
+	}
+	books := make([]ws.BookEvent, 0, len(msg.AssetsIDs))
+	for _, assetID := range msg.AssetsIDs {
+		books = append(books, Book(assetID, "", nil, nil))
+	}
+	return []Step{Send(books)}
+}
+
+// Book returns a book snapshot event timestamped now.
+func Book(assetID, market string, bids, asks []types.PriceLevel) ws.BookEvent {
+	if bids == nil {
+		bids = []types.PriceLevel{}
+	}
+	if asks == nil {
+		asks = []types.PriceLevel{}
+	}
+	return ws.BookEvent{
+		EventType: ws.EventTypeBook,
+		Market:    market,
+		AssetID:   assetID,
+		Timestamp: now(),
+		Hash:      "wstest",
+		Bids:      bids,
+		Asks:      asks,
+	}
+}
+
+// PriceChange returns a price_change event timestamped now.
+func PriceChange(market string, changes ...ws.PriceChange) ws.PriceChangeEvent {
+	return ws.PriceChangeEvent{
+		EventType:    ws.EventTypePriceChange,
+		Market:       market,
+		Timestamp:    now(),
+		PriceChanges: changes,
+	}
+}
+
+// Change returns a single level change for PriceChange.
+func Change(assetID, side, price, size string) ws.PriceChange {
+	return ws.PriceChange{AssetID: assetID, Side: side, Price: price, Size: size, Hash: "wstest"}
+}
+
+// Level returns a price level.
+func Level(price, size string) types.PriceLevel {
+	return types.PriceLevel{Price: price, Size: size}
+}
+
+func now() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
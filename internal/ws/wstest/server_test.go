@@ -0,0 +1,159 @@
+package wstest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johan/polymarket-collector/internal/types"
+	"github.com/johan/polymarket-collector/internal/ws"
+)
+
+// recorder collects the messages delivered to a ws.Client.
+type recorder struct {
+	mu       sync.Mutex
+	messages []ws.WSMessage
+}
+
+func (r *recorder) handle(messages []ws.WSMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, messages...)
+}
+
+func (r *recorder) count(eventType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, msg := range r.messages {
+		if msg.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func connect(t *testing.T, srv *Server, handler ws.MessageHandler) *ws.Client {
+	t.Helper()
+	c := ws.NewWSClient(handler).
+		WithURL(srv.URL).
+		WithReconnectConfig(ws.ReconnectConfig{
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			BackoffFactor:  2,
+		})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestServer_SnapshotsAndScript(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	var rec recorder
+	c := connect(t, srv, rec.handle)
+	if err := c.Subscribe([]string{"a", "b"}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := srv.WaitFor(time.Second, func() bool { return rec.count(ws.EventTypeBook) == 2 }); err != nil {
+		t.Fatalf("snapshots: %v", err)
+	}
+
+	err := srv.Play(
+		Send(PriceChange("m", Change("a", "BUY", "0.5", "10"))),
+		Malformed(),
+		Delay(10*time.Millisecond),
+		Send([]ws.BookEvent{Book("a", "m", []types.PriceLevel{Level("0.5", "10")}, nil)}),
+	)
+	if err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	if err := srv.WaitFor(time.Second, func() bool { return rec.count(ws.EventTypeBook) == 3 }); err != nil {
+		t.Fatalf("scripted book: %v", err)
+	}
+	if got := rec.count(ws.EventTypePriceChange); got != 1 {
+		t.Errorf("price changes = %d, want 1", got)
+	}
+}
+
+func TestServer_DisconnectAndResubscribe(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	var rec recorder
+	c := connect(t, srv, rec.handle)
+	if err := c.Subscribe([]string{"a"}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := srv.WaitFor(time.Second, func() bool { return rec.count(ws.EventTypeBook) == 1 }); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Play(Disconnect())
+
+	// The client reconnects and gets a fresh snapshot
+	if err := srv.WaitFor(5*time.Second, func() bool { return rec.count(ws.EventTypeBook) == 2 }); err != nil {
+		t.Fatalf("resubscribe: %v", err)
+	}
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("Connections = %d, want 2", got)
+	}
+	if got := c.Reconnects()[ws.ReasonReadError]; got != 1 {
+		t.Errorf("read_error reconnects = %d, want 1", got)
+	}
+}
+
+func TestServer_TracksAssets(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := connect(t, srv, nil)
+	c.AddAssets([]string{"a", "b"})
+	c.AddAssets([]string{"c"})
+	c.RemoveAssets([]string{"a"})
+
+	if err := srv.WaitFor(time.Second, func() bool { return len(srv.Subscriptions()) == 3 }); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(srv.Assets(), ","); got != "b,c" {
+		t.Errorf("Assets = %s, want b,c", got)
+	}
+}
+
+func TestServer_NoPong(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetPong(false)
+
+	c := ws.NewWSClient(nil).
+		WithURL(srv.URL).
+		WithHeartbeat(ws.HeartbeatConfig{PingInterval: 10 * time.Millisecond, ReadTimeout: 50 * time.Millisecond})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := srv.WaitFor(5*time.Second, func() bool { return c.Reconnects()[ws.ReasonReadTimeout] > 0 }); err != nil {
+		t.Fatalf("read timeout: %v", err)
+	}
+}
+
+func TestServer_CloseWith(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := connect(t, srv, nil)
+	srv.Play(CloseWith(1001))
+
+	if err := srv.WaitFor(5*time.Second, func() bool { return srv.Connections() == 2 }); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if got := c.Reconnects()[ws.ReasonServerClose]; got != 1 {
+		t.Errorf("server_close reconnects = %d, want 1", got)
+	}
+}